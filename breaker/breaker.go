@@ -0,0 +1,204 @@
+package breaker
+
+import (
+	"expvar"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// states publishes the current state of every breaker on /debug/vars.
+var states = expvar.NewMap("breakers")
+
+type State int
+
+const (
+	Closed State = iota
+	Open
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("State(%d)", int(s))
+	}
+}
+
+type Settings struct {
+	// Window is the period over which the failure rate is measured while
+	// the breaker is closed.
+	Window time.Duration
+	// MinRequests is the number of calls needed in a window before the
+	// failure rate can open the breaker.
+	MinRequests int
+	// FailureRate (0-1) opens the breaker when reached.
+	FailureRate float64
+	// OpenTimeout is how long the breaker stays open before letting trial
+	// calls through.
+	OpenTimeout time.Duration
+	// HalfOpenRequests is the number of trial calls that must succeed to
+	// close the breaker again.
+	HalfOpenRequests int
+}
+
+var DefaultSettings = Settings{
+	Window:           time.Minute,
+	MinRequests:      10,
+	FailureRate:      0.5,
+	OpenTimeout:      30 * time.Second,
+	HalfOpenRequests: 3,
+}
+
+// OpenError is returned by Allow while the breaker rejects calls.
+type OpenError struct {
+	Name  string
+	Until time.Time
+}
+
+func (e *OpenError) Error() string {
+	return fmt.Sprintf("circuit breaker %s is open until %s", e.Name, e.Until.Format(time.RFC3339))
+}
+
+// Breaker tracks the failure rate of one provider and rejects calls while
+// the provider looks down.
+type Breaker struct {
+	name     string
+	settings Settings
+	now      func() time.Time
+
+	mu          sync.Mutex
+	state       State
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	trials      int
+	successes   int
+}
+
+func New(name string, settings Settings) *Breaker {
+	if settings.Window <= 0 {
+		settings.Window = DefaultSettings.Window
+	}
+	if settings.MinRequests <= 0 {
+		settings.MinRequests = DefaultSettings.MinRequests
+	}
+	if settings.FailureRate <= 0 || settings.FailureRate > 1 {
+		settings.FailureRate = DefaultSettings.FailureRate
+	}
+	if settings.OpenTimeout <= 0 {
+		settings.OpenTimeout = DefaultSettings.OpenTimeout
+	}
+	if settings.HalfOpenRequests <= 0 {
+		settings.HalfOpenRequests = DefaultSettings.HalfOpenRequests
+	}
+	b := &Breaker{name: name, settings: settings, now: time.Now}
+	states.Set(name, expvar.Func(func() any { return b.State().String() }))
+	return b
+}
+
+func (b *Breaker) Name() string { return b.name }
+
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance(b.now())
+	return b.state
+}
+
+// Allow reports whether a call may go ahead. Every allowed call must be
+// followed by Record or Release.
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	b.advance(now)
+
+	switch b.state {
+	case Open:
+		return &OpenError{Name: b.name, Until: b.openedAt.Add(b.settings.OpenTimeout)}
+	case HalfOpen:
+		if b.trials >= b.settings.HalfOpenRequests {
+			// All trial slots are taken; check back shortly.
+			return &OpenError{Name: b.name, Until: now.Add(b.settings.OpenTimeout / 10)}
+		}
+		b.trials++
+	}
+	return nil
+}
+
+// Record reports the outcome of an allowed call.
+func (b *Breaker) Record(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	b.advance(now)
+
+	switch b.state {
+	case HalfOpen:
+		if !success {
+			b.trip(now)
+			return
+		}
+		b.successes++
+		if b.successes >= b.settings.HalfOpenRequests {
+			b.reset(Closed, now)
+		}
+	case Closed:
+		b.requests++
+		if !success {
+			b.failures++
+		}
+		if b.requests >= b.settings.MinRequests &&
+			float64(b.failures)/float64(b.requests) >= b.settings.FailureRate {
+			b.trip(now)
+		}
+	}
+}
+
+// Release frees an allowed call that ended without an outcome, such as one
+// cancelled by a shutdown. It counts neither as a success nor as a failure.
+func (b *Breaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == HalfOpen && b.trials > b.successes {
+		b.trials--
+	}
+}
+
+// advance moves an open breaker to half-open after OpenTimeout and starts a
+// new measurement window for a closed one.
+func (b *Breaker) advance(now time.Time) {
+	switch b.state {
+	case Open:
+		if now.Sub(b.openedAt) >= b.settings.OpenTimeout {
+			b.reset(HalfOpen, now)
+		}
+	case Closed:
+		if now.Sub(b.windowStart) >= b.settings.Window {
+			b.reset(Closed, now)
+		}
+	}
+}
+
+func (b *Breaker) trip(now time.Time) {
+	b.reset(Open, now)
+	b.openedAt = now
+}
+
+func (b *Breaker) reset(state State, now time.Time) {
+	b.state = state
+	b.windowStart = now
+	b.requests, b.failures = 0, 0
+	b.trials, b.successes = 0, 0
+}
@@ -0,0 +1,129 @@
+package breaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time          { return c.t }
+func (c *clock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestBreaker(s Settings) (*Breaker, *clock) {
+	c := &clock{t: time.Unix(1700000000, 0)}
+	b := New("test", s)
+	b.now = c.now
+	return b, c
+}
+
+func call(t *testing.T, b *Breaker, success bool) {
+	t.Helper()
+	if err := b.Allow(); err != nil {
+		t.Fatalf("Expected call to be allowed, got: %v", err)
+	}
+	b.Record(success)
+}
+
+// TestBreaker_OpensOnFailureRate tests that the breaker opens once the failure rate is reached
+func TestBreaker_OpensOnFailureRate(t *testing.T) {
+	b, _ := newTestBreaker(Settings{MinRequests: 4, FailureRate: 0.5, OpenTimeout: time.Minute})
+
+	call(t, b, true)
+	call(t, b, false)
+	call(t, b, true)
+	if b.State() != Closed {
+		t.Fatalf("Expected closed below MinRequests, got: %s", b.State())
+	}
+	call(t, b, false)
+
+	if b.State() != Open {
+		t.Fatalf("Expected open at 50%% failures, got: %s", b.State())
+	}
+
+	err := b.Allow()
+	var open *OpenError
+	if !errors.As(err, &open) || open.Name != "test" {
+		t.Errorf("Expected OpenError, got: %v", err)
+	}
+}
+
+// TestBreaker_WindowResets tests that old failures age out of the window
+func TestBreaker_WindowResets(t *testing.T) {
+	b, c := newTestBreaker(Settings{Window: time.Minute, MinRequests: 2, FailureRate: 1})
+
+	call(t, b, false)
+	c.advance(2 * time.Minute)
+	call(t, b, false)
+
+	if b.State() != Closed {
+		t.Errorf("Expected failures in different windows not to open the breaker, got: %s", b.State())
+	}
+}
+
+// TestBreaker_HalfOpenCloses tests recovery through the half-open state
+func TestBreaker_HalfOpenCloses(t *testing.T) {
+	b, c := newTestBreaker(Settings{MinRequests: 1, FailureRate: 1, OpenTimeout: time.Minute, HalfOpenRequests: 2})
+
+	call(t, b, false)
+	c.advance(time.Minute)
+
+	if b.State() != HalfOpen {
+		t.Fatalf("Expected half-open after OpenTimeout, got: %s", b.State())
+	}
+	call(t, b, true)
+	call(t, b, true)
+
+	if b.State() != Closed {
+		t.Errorf("Expected closed after successful trials, got: %s", b.State())
+	}
+}
+
+// TestBreaker_HalfOpenFailureReopens tests that a failed trial opens the breaker again
+func TestBreaker_HalfOpenFailureReopens(t *testing.T) {
+	b, c := newTestBreaker(Settings{MinRequests: 1, FailureRate: 1, OpenTimeout: time.Minute, HalfOpenRequests: 2})
+
+	call(t, b, false)
+	c.advance(time.Minute)
+	call(t, b, false)
+
+	if b.State() != Open {
+		t.Errorf("Expected open after failed trial, got: %s", b.State())
+	}
+}
+
+// TestBreaker_HalfOpenLimitsTrials tests that only HalfOpenRequests calls are let through
+func TestBreaker_HalfOpenLimitsTrials(t *testing.T) {
+	b, c := newTestBreaker(Settings{MinRequests: 1, FailureRate: 1, OpenTimeout: time.Minute, HalfOpenRequests: 1})
+
+	call(t, b, false)
+	c.advance(time.Minute)
+
+	if err := b.Allow(); err != nil {
+		t.Fatalf("Expected first trial to be allowed, got: %v", err)
+	}
+	if err := b.Allow(); err == nil {
+		t.Error("Expected second concurrent trial to be rejected")
+	}
+}
+
+// TestBreaker_ReleaseFreesTrial tests that a released call neither counts nor keeps its trial slot
+func TestBreaker_ReleaseFreesTrial(t *testing.T) {
+	b, c := newTestBreaker(Settings{MinRequests: 1, FailureRate: 1, OpenTimeout: time.Minute, HalfOpenRequests: 1})
+
+	call(t, b, false)
+	c.advance(time.Minute)
+
+	if err := b.Allow(); err != nil {
+		t.Fatalf("Expected first trial to be allowed, got: %v", err)
+	}
+	b.Release()
+	if b.State() != HalfOpen {
+		t.Fatalf("Expected the breaker to stay half-open, got: %s", b.State())
+	}
+	call(t, b, true)
+	if b.State() != Closed {
+		t.Errorf("Expected the breaker to close, got: %s", b.State())
+	}
+}
@@ -0,0 +1,29 @@
+package breaker
+
+import (
+	"boh/notification-service/env"
+	"log"
+	"os"
+	"strconv"
+)
+
+// FromEnv overrides def with <prefix>BREAKER_WINDOW, <prefix>BREAKER_MIN_REQUESTS,
+// <prefix>BREAKER_FAILURE_RATE, <prefix>BREAKER_OPEN_TIMEOUT and
+// <prefix>BREAKER_HALF_OPEN_REQUESTS when they are set.
+func FromEnv(prefix string, def Settings) Settings {
+	s := def
+	s.Window = env.Duration(prefix+"BREAKER_WINDOW", def.Window)
+	s.MinRequests = env.Int(prefix+"BREAKER_MIN_REQUESTS", def.MinRequests)
+	s.OpenTimeout = env.Duration(prefix+"BREAKER_OPEN_TIMEOUT", def.OpenTimeout)
+	s.HalfOpenRequests = env.Int(prefix+"BREAKER_HALF_OPEN_REQUESTS", def.HalfOpenRequests)
+
+	key := prefix + "BREAKER_FAILURE_RATE"
+	if v := os.Getenv(key); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil && f > 0 && f <= 1 {
+			s.FailureRate = f
+		} else {
+			log.Printf("Invalid %s %q, using %g", key, v, def.FailureRate)
+		}
+	}
+	return s
+}
@@ -0,0 +1,31 @@
+package channel
+
+import "fmt"
+
+// Attachment is a file sent with an email. Its content is given inline as
+// base64 in JSON, or referenced by an http(s) URL such as a blob SAS URL,
+// or by a path under the provider's attachment directory.
+type Attachment struct {
+	FileName    string `json:"fileName,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+	Content     []byte `json:"content,omitempty"`
+	URL         string `json:"url,omitempty"`
+	Path        string `json:"path,omitempty"`
+	// ContentID shows the attachment inline, referenced from the HTML body
+	// as "cid:<ContentID>".
+	ContentID string `json:"contentId,omitempty"`
+}
+
+// Validate checks that a has exactly one source of content.
+func (a *Attachment) Validate() error {
+	sources := 0
+	for _, set := range []bool{a.Content != nil, a.URL != "", a.Path != ""} {
+		if set {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return fmt.Errorf("attachment %q needs exactly one of content, url or path", a.FileName)
+	}
+	return nil
+}
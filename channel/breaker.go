@@ -0,0 +1,46 @@
+package channel
+
+import (
+	"boh/notification-service/breaker"
+	"context"
+	"errors"
+)
+
+type breakerChannel struct {
+	Channel
+	breaker *breaker.Breaker
+}
+
+// WithBreaker wraps c so sends are short-circuited while b is open. The
+// rejection is a Deferred error, so the message is rescheduled for when the
+// breaker lets calls through again. Only errors worth retrying count against
+// the provider; an unknown recipient or missing configuration does not mean
+// the provider is down, and neither does a send cancelled through its context.
+func WithBreaker(c Channel, b *breaker.Breaker) Channel {
+	return breakerChannel{Channel: c, breaker: b}
+}
+
+func (c breakerChannel) Send(ctx context.Context, n Notification) (Receipt, error) {
+	if err := c.breaker.Allow(); err != nil {
+		var open *breaker.OpenError
+		errors.As(err, &open)
+		return Receipt{Channel: c.Name(), Contact: n.Contact}, Deferred(err, open.Until)
+	}
+
+	receipt, err := c.Channel.Send(ctx, n)
+	if err != nil && ctx.Err() != nil {
+		// Cancelled, e.g. by a shutdown: says nothing about the provider.
+		c.breaker.Release()
+		return receipt, err
+	}
+	c.breaker.Record(err == nil || IsPermanent(err) || !c.Retryable(err))
+	return receipt, err
+}
+
+// Retryable keeps the wrapped channel's retry predicate visible to WithRetry.
+func (c breakerChannel) Retryable(err error) bool {
+	if r, ok := c.Channel.(Retryer); ok {
+		return r.Retryable(err)
+	}
+	return true
+}
@@ -0,0 +1,86 @@
+package channel
+
+import (
+	"boh/notification-service/breaker"
+	"boh/notification-service/retry"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestWithBreaker_ShortCircuitsWhenOpen tests that an open breaker defers sends without calling the provider
+func TestWithBreaker_ShortCircuitsWhenOpen(t *testing.T) {
+	calls := 0
+	c := funcChannel{name: "email", send: func(n Notification) (Receipt, error) {
+		calls++
+		return Receipt{}, errors.New("connection refused")
+	}}
+	b := breaker.New("email-test", breaker.Settings{MinRequests: 2, FailureRate: 1, OpenTimeout: time.Minute})
+	wrapped := WithRetry(WithBreaker(c, b), retry.Policy{MaxAttempts: 5, BaseDelay: time.Millisecond})
+
+	r := Deliver(context.Background(), wrapped, Notification{})
+
+	if calls != 2 {
+		t.Errorf("Expected the breaker to stop retries after 2 failures, got %d calls", calls)
+	}
+	if r.ErrorClass != ErrorClassDeferred {
+		t.Errorf("Expected deferred error class, got: %+v", r)
+	}
+	until, ok := DeferUntil(r.Err())
+	if !ok || time.Until(until) <= 0 {
+		t.Errorf("Expected a future defer time, got %s ok=%v", until, ok)
+	}
+}
+
+// TestWithBreaker_IgnoresNonRetryableErrors tests that permanent failures do not open the breaker
+func TestWithBreaker_IgnoresNonRetryableErrors(t *testing.T) {
+	c := funcChannel{name: "email", send: func(n Notification) (Receipt, error) {
+		return Receipt{}, Permanent(errors.New("550 no such user"))
+	}}
+	b := breaker.New("email-permanent-test", breaker.Settings{MinRequests: 1, FailureRate: 1})
+	wrapped := WithBreaker(c, b)
+
+	for i := 0; i < 3; i++ {
+		wrapped.Send(context.Background(), Notification{})
+	}
+
+	if b.State() != breaker.Closed {
+		t.Errorf("Expected breaker to stay closed, got: %s", b.State())
+	}
+}
+
+// TestWithBreaker_IgnoresCancellation tests that sends cancelled through their context do not open the breaker
+func TestWithBreaker_IgnoresCancellation(t *testing.T) {
+	c := funcChannel{name: "email", send: func(n Notification) (Receipt, error) {
+		return Receipt{}, context.Canceled
+	}}
+	b := breaker.New("email-cancel-test", breaker.Settings{MinRequests: 1, FailureRate: 1})
+	wrapped := WithBreaker(c, b)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for i := 0; i < 3; i++ {
+		wrapped.Send(ctx, Notification{})
+	}
+
+	if b.State() != breaker.Closed {
+		t.Errorf("Expected breaker to stay closed, got: %s", b.State())
+	}
+}
+
+// TestResultsError_DeferredIsNotPermanent tests that deferred failures keep the message retryable
+func TestResultsError_DeferredIsNotPermanent(t *testing.T) {
+	until := time.Now().Add(time.Minute)
+	deferred := Failed("whatsapp", "+1", Deferred(errors.New("breaker open"), until))
+	permanent := Failed("email", "bad", Permanent(errors.New("invalid contact")))
+
+	err := ResultsError([]DeliveryResult{permanent, deferred})
+
+	if IsPermanent(err) {
+		t.Errorf("Expected non-permanent error, got: %v", err)
+	}
+	if got, ok := DeferUntil(err); !ok || !got.Equal(until) {
+		t.Errorf("Expected defer time %s, got %s ok=%v", until, got, ok)
+	}
+}
@@ -0,0 +1,115 @@
+package channel
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
+)
+
+// Notification is a single delivery request for one contact on one channel.
+type Notification struct {
+	UserID  string
+	Brand   string // selects brand-specific provider settings; empty uses the defaults
+	Contact string
+	Subject string
+	Body    string
+	// Template, when set, is sent instead of Body by channels that
+	// support templates.
+	Template *Template
+	// Media, when set, is sent with Body as its caption by channels that
+	// support media.
+	Media *Media
+	// Interactive, when set, sends Body with reply buttons.
+	Interactive *Interactive
+	// Attachments are sent with the body by channels that support files.
+	Attachments []Attachment
+	// Cc, Bcc and ReplyTo are extra email addresses; each entry may be a
+	// comma separated list and may include display names.
+	Cc      []string
+	Bcc     []string
+	ReplyTo []string
+}
+
+// ValidateContent checks that at most one of Template, Interactive and Media
+// is set. Each one replaces the plain message, so a second one would be
+// dropped without the sender noticing.
+func (n Notification) ValidateContent() error {
+	var set []string
+	if n.Template != nil {
+		set = append(set, "template")
+	}
+	if n.Interactive != nil {
+		set = append(set, "interactive")
+	}
+	if n.Media != nil {
+		set = append(set, "media")
+	}
+	if len(set) > 1 {
+		return fmt.Errorf("only one of template, interactive and media may be set, got %s", strings.Join(set, " and "))
+	}
+	return nil
+}
+
+// Receipt describes a delivery accepted by a provider.
+type Receipt struct {
+	Channel   string
+	Contact   string
+	MessageID string
+	// Attempts is the number of provider calls made, including retries.
+	Attempts int
+	// Segments and EstimatedCost are set by channels billed per segment.
+	Segments      int
+	EstimatedCost float64
+}
+
+// Channel is implemented by every notification provider. New channels can
+// live in their own package and only need to be registered at startup.
+type Channel interface {
+	// Name is the channel type used in NotificationChannel.Type, e.g. "email".
+	Name() string
+	// Validate checks that contact is a usable address for this channel.
+	Validate(contact string) error
+	// Send delivers the notification and returns the provider receipt.
+	Send(ctx context.Context, n Notification) (Receipt, error)
+}
+
+var (
+	phonePattern = regexp.MustCompile(`^\+?[1-9][0-9]{6,14}$`)
+	e164Pattern  = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+)
+
+// ValidateEmail checks that contact parses as a single RFC 5322 address.
+func ValidateEmail(contact string) error {
+	if contact == "" {
+		return fmt.Errorf("email contact is empty")
+	}
+	if _, err := mail.ParseAddress(contact); err != nil {
+		return fmt.Errorf("invalid email contact %q: %w", contact, err)
+	}
+	return nil
+}
+
+// ValidatePhone checks that contact looks like an international phone number.
+func ValidatePhone(contact string) error {
+	if contact == "" {
+		return fmt.Errorf("phone contact is empty")
+	}
+	if !phonePattern.MatchString(contact) {
+		return fmt.Errorf("invalid phone contact %q", contact)
+	}
+	return nil
+}
+
+// ValidateE164 checks that contact is an E.164 number: a leading +, the
+// country code and at most 15 digits in total.
+func ValidateE164(contact string) error {
+	if contact == "" {
+		return fmt.Errorf("phone contact is empty")
+	}
+	if !e164Pattern.MatchString(contact) {
+		return fmt.Errorf("phone contact %q is not in E.164 format", contact)
+	}
+	return nil
+}
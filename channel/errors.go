@@ -0,0 +1,81 @@
+package channel
+
+import (
+	"errors"
+	"time"
+)
+
+// permanentError marks a failure that will not succeed on redelivery, such
+// as a malformed payload or an invalid contact.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps err so IsPermanent reports true for it. Errors that are
+// not wrapped are treated as transient and retried.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether any error in err's chain was marked Permanent.
+func IsPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
+
+// deferredError marks a failure caused by the provider being unavailable
+// until a known time, such as an open circuit breaker. The message should
+// be retried after that time without counting as a failed delivery.
+type deferredError struct {
+	err   error
+	until time.Time
+}
+
+func (e *deferredError) Error() string { return e.err.Error() }
+func (e *deferredError) Unwrap() error { return e.err }
+
+// Deferred wraps err so DeferUntil reports until for it.
+func Deferred(err error, until time.Time) error {
+	if err == nil {
+		return nil
+	}
+	return &deferredError{err: err, until: until}
+}
+
+// DeferUntil returns the time a deferred error in err's chain asked to wait
+// for. When several are present the latest one wins.
+func DeferUntil(err error) (time.Time, bool) {
+	var until time.Time
+	found := false
+	walk(err, func(e error) {
+		if d, ok := e.(*deferredError); ok {
+			found = true
+			if d.until.After(until) {
+				until = d.until
+			}
+		}
+	})
+	return until, found
+}
+
+// walk calls fn for every error in err's tree.
+func walk(err error, fn func(error)) {
+	if err == nil {
+		return
+	}
+	fn(err)
+	switch u := err.(type) {
+	case interface{ Unwrap() error }:
+		walk(u.Unwrap(), fn)
+	case interface{ Unwrap() []error }:
+		for _, e := range u.Unwrap() {
+			walk(e, fn)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package channel
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// WhatsApp limits for reply-button messages.
+const (
+	maxReplyButtons     = 3
+	maxReplyButtonTitle = 20
+	maxReplyButtonID    = 256
+)
+
+// Interactive is a message with reply buttons, such as a request to confirm
+// a suspicious transaction. The notification body is the message text and
+// the id of the button pressed comes back with the user's reply.
+type Interactive struct {
+	Header  string        `json:"header,omitempty"`
+	Footer  string        `json:"footer,omitempty"`
+	Buttons []ReplyButton `json:"buttons"`
+}
+
+// ReplyButton is one quick-reply button.
+type ReplyButton struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+}
+
+// Validate checks the buttons against the WhatsApp limits.
+func (i *Interactive) Validate() error {
+	if len(i.Buttons) == 0 || len(i.Buttons) > maxReplyButtons {
+		return fmt.Errorf("interactive message needs 1 to %d buttons, got %d", maxReplyButtons, len(i.Buttons))
+	}
+	ids := map[string]bool{}
+	for n, b := range i.Buttons {
+		if b.ID == "" || len(b.ID) > maxReplyButtonID {
+			return fmt.Errorf("button %d id must be 1 to %d bytes", n+1, maxReplyButtonID)
+		}
+		if ids[b.ID] {
+			return fmt.Errorf("duplicate button id %q", b.ID)
+		}
+		ids[b.ID] = true
+		if b.Title == "" || utf8.RuneCountInString(b.Title) > maxReplyButtonTitle {
+			return fmt.Errorf("button %q title must be 1 to %d characters", b.ID, maxReplyButtonTitle)
+		}
+	}
+	return nil
+}
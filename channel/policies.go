@@ -0,0 +1,62 @@
+package channel
+
+import (
+	"boh/notification-service/breaker"
+	"boh/notification-service/retry"
+	"strings"
+	"sync"
+)
+
+// Policies holds the retry policy and circuit breaker of every channel it
+// wraps, read from the environment the first time: RETRY_* and BREAKER_*
+// set the defaults and <CHANNEL>_RETRY_* and <CHANNEL>_BREAKER_* override
+// them for one channel, e.g. WHATSAPP_RETRY_MAX_ATTEMPTS. The zero value is
+// ready to use.
+type Policies struct {
+	// BreakerPrefix goes in front of the breaker names published with
+	// expvar, to keep two sets of policies for the same channels apart.
+	BreakerPrefix string
+
+	mu       sync.Mutex
+	policies map[string]retry.Policy
+	breakers map[string]*breaker.Breaker
+}
+
+// Wrap applies c's retry policy and circuit breaker. The breaker sits
+// inside the retries so every attempt counts towards the failure rate and
+// an open breaker stops the remaining attempts.
+func (p *Policies) Wrap(c Channel) Channel {
+	name := strings.ToUpper(c.Name())
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.policies == nil {
+		p.policies = map[string]retry.Policy{}
+		p.breakers = map[string]*breaker.Breaker{}
+	}
+
+	policy, ok := p.policies[name]
+	if !ok {
+		policy = retry.FromEnv(name+"_", retry.FromEnv("", retry.DefaultPolicy))
+		p.policies[name] = policy
+	}
+
+	b, ok := p.breakers[name]
+	if !ok {
+		settings := breaker.FromEnv(name+"_", breaker.FromEnv("", breaker.DefaultSettings))
+		b = breaker.New(p.BreakerPrefix+strings.ToLower(name), settings)
+		p.breakers[name] = b
+	}
+
+	return WithRetry(WithBreaker(c, b), policy)
+}
+
+// Reset drops the policies and breakers, so the next Wrap reads the
+// environment again.
+func (p *Policies) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.policies = nil
+	p.breakers = nil
+}
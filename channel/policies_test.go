@@ -0,0 +1,35 @@
+package channel
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// TestPolicies_Wrap tests that a channel's own variables override the defaults and are kept until Reset
+func TestPolicies_Wrap(t *testing.T) {
+	t.Setenv("RETRY_MAX_ATTEMPTS", "3")
+	t.Setenv("RETRY_BASE_DELAY", "1ms")
+	t.Setenv("PAGER_RETRY_MAX_ATTEMPTS", "2")
+
+	calls := 0
+	c := funcChannel{name: "pager", send: func(n Notification) (Receipt, error) {
+		calls++
+		return Receipt{}, errors.New("503 unavailable")
+	}}
+	var p Policies
+
+	if r := Deliver(context.Background(), p.Wrap(c), Notification{}); r.Attempts != 2 || calls != 2 {
+		t.Errorf("Expected PAGER_RETRY_MAX_ATTEMPTS to allow 2 attempts, got %d attempts and %d calls", r.Attempts, calls)
+	}
+
+	t.Setenv("PAGER_RETRY_MAX_ATTEMPTS", "1")
+	if r := Deliver(context.Background(), p.Wrap(c), Notification{}); r.Attempts != 2 {
+		t.Errorf("Expected the policy to be kept until Reset, got %d attempts", r.Attempts)
+	}
+
+	p.Reset()
+	if r := Deliver(context.Background(), p.Wrap(c), Notification{}); r.Attempts != 1 {
+		t.Errorf("Expected the environment to be read again after Reset, got %d attempts", r.Attempts)
+	}
+}
@@ -0,0 +1,67 @@
+package channel
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Registry maps channel names to their providers. Names are matched
+// case-insensitively so "email" and "EMAIL" resolve to the same channel.
+type Registry struct {
+	mu       sync.RWMutex
+	channels map[string]Channel
+}
+
+func NewRegistry() *Registry {
+	return &Registry{channels: make(map[string]Channel)}
+}
+
+// Register adds c to the registry. It fails if a channel with the same name
+// is already registered.
+func (r *Registry) Register(c Channel) error {
+	if c == nil {
+		return fmt.Errorf("channel is nil")
+	}
+	name := strings.ToLower(c.Name())
+	if name == "" {
+		return fmt.Errorf("channel name is empty")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.channels[name]; ok {
+		return fmt.Errorf("channel %q already registered", name)
+	}
+	r.channels[name] = c
+	return nil
+}
+
+// Replace registers c, overwriting any channel with the same name.
+func (r *Registry) Replace(c Channel) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.channels[strings.ToLower(c.Name())] = c
+}
+
+// Lookup returns the channel registered under name.
+func (r *Registry) Lookup(name string) (Channel, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	c, ok := r.channels[strings.ToLower(name)]
+	return c, ok
+}
+
+// Names returns the registered channel names in sorted order.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.channels))
+	for name := range r.channels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,124 @@
+package channel
+
+import (
+	"context"
+	"testing"
+)
+
+type stubChannel struct {
+	name string
+}
+
+func (s stubChannel) Name() string                  { return s.name }
+func (s stubChannel) Validate(contact string) error { return nil }
+func (s stubChannel) Send(ctx context.Context, n Notification) (Receipt, error) {
+	return Receipt{Channel: s.name, Contact: n.Contact}, nil
+}
+
+// TestRegistry_LookupIsCaseInsensitive tests that "EMAIL" and "email" resolve to the same channel
+func TestRegistry_LookupIsCaseInsensitive(t *testing.T) {
+	r := NewRegistry()
+	if err := r.Register(stubChannel{name: "email"}); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	for _, name := range []string{"email", "EMAIL", "Email"} {
+		if _, ok := r.Lookup(name); !ok {
+			t.Errorf("Expected %q to resolve to the email channel", name)
+		}
+	}
+	if _, ok := r.Lookup("sms"); ok {
+		t.Error("Expected sms lookup to fail")
+	}
+}
+
+// TestRegistry_RegisterDuplicate tests that registering the same name twice fails
+func TestRegistry_RegisterDuplicate(t *testing.T) {
+	r := NewRegistry()
+	if err := r.Register(stubChannel{name: "whatsapp"}); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	if err := r.Register(stubChannel{name: "WHATSAPP"}); err == nil {
+		t.Error("Expected error for duplicate channel, got nil")
+	}
+}
+
+// TestRegistry_RegisterInvalid tests that nil and unnamed channels are rejected
+func TestRegistry_RegisterInvalid(t *testing.T) {
+	r := NewRegistry()
+	if err := r.Register(nil); err == nil {
+		t.Error("Expected error for nil channel, got nil")
+	}
+	if err := r.Register(stubChannel{}); err == nil {
+		t.Error("Expected error for unnamed channel, got nil")
+	}
+}
+
+// TestRegistry_Names tests that Names returns sorted channel names
+func TestRegistry_Names(t *testing.T) {
+	r := NewRegistry()
+	r.Register(stubChannel{name: "whatsapp"})
+	r.Register(stubChannel{name: "email"})
+
+	names := r.Names()
+	if len(names) != 2 || names[0] != "email" || names[1] != "whatsapp" {
+		t.Errorf("Expected [email whatsapp], got: %v", names)
+	}
+}
+
+// TestValidatePhone tests phone number validation
+func TestValidatePhone(t *testing.T) {
+	tests := []struct {
+		contact string
+		valid   bool
+	}{
+		{"+1234567890", true},
+		{"919876543210", true},
+		{"", false},
+		{"+0123456789", false},
+		{"12-34", false},
+		{"test@example.com", false},
+	}
+
+	for _, tt := range tests {
+		err := ValidatePhone(tt.contact)
+		if (err == nil) != tt.valid {
+			t.Errorf("ValidatePhone(%q) error = %v, want valid %v", tt.contact, err, tt.valid)
+		}
+	}
+}
+
+// TestValidateE164 tests E.164 phone number validation
+func TestValidateE164(t *testing.T) {
+	tests := []struct {
+		contact string
+		valid   bool
+	}{
+		{"+1234567890", true},
+		{"+919876543210", true},
+		{"919876543210", false},
+		{"+1234567890123456", false},
+		{"+0123456789", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		err := ValidateE164(tt.contact)
+		if (err == nil) != tt.valid {
+			t.Errorf("ValidateE164(%q) error = %v, want valid %v", tt.contact, err, tt.valid)
+		}
+	}
+}
+
+// TestValidateEmail tests email address validation
+func TestValidateEmail(t *testing.T) {
+	if err := ValidateEmail("test@example.com"); err != nil {
+		t.Errorf("Expected valid email, got: %v", err)
+	}
+	if err := ValidateEmail(""); err == nil {
+		t.Error("Expected error for empty email, got nil")
+	}
+	if err := ValidateEmail("not-an-email"); err == nil {
+		t.Error("Expected error for invalid email, got nil")
+	}
+}
@@ -0,0 +1,143 @@
+package channel
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Delivery statuses reported in DeliveryResult.
+const (
+	StatusSent        = "sent"
+	StatusFailed      = "failed"
+	StatusSkipped     = "skipped"
+	StatusUnsupported = "unsupported"
+)
+
+// Error classes reported in DeliveryResult.
+const (
+	ErrorClassPermanent = "permanent"
+	ErrorClassTransient = "transient"
+	ErrorClassDeferred  = "deferred"
+)
+
+// DeliveryResult is the outcome of one notification on one channel.
+type DeliveryResult struct {
+	Channel    string `json:"channel"`
+	Contact    string `json:"contact"`
+	Status     string `json:"status"`
+	MessageID  string `json:"messageId,omitempty"`
+	ErrorClass string `json:"errorClass,omitempty"`
+	Error      string `json:"error,omitempty"`
+	Attempts   int    `json:"attempts"`
+	LatencyMs  int64  `json:"latencyMs"`
+	// Segments and EstimatedCost are reported by channels billed per
+	// segment, such as SMS.
+	Segments      int     `json:"segments,omitempty"`
+	EstimatedCost float64 `json:"estimatedCost,omitempty"`
+
+	err error
+}
+
+// Err returns the error behind a failed result.
+func (r DeliveryResult) Err() error {
+	return r.err
+}
+
+// ErrorClass classifies err for reporting.
+func ErrorClass(err error) string {
+	if err == nil {
+		return ""
+	}
+	if IsPermanent(err) {
+		return ErrorClassPermanent
+	}
+	if _, ok := DeferUntil(err); ok {
+		return ErrorClassDeferred
+	}
+	return ErrorClassTransient
+}
+
+// Deliver validates and sends n through c and describes the outcome.
+func Deliver(ctx context.Context, c Channel, n Notification) DeliveryResult {
+	result := DeliveryResult{Channel: c.Name(), Contact: n.Contact}
+	start := time.Now()
+
+	err := c.Validate(n.Contact)
+	if err != nil {
+		err = Permanent(err)
+	} else {
+		var receipt Receipt
+		receipt, err = c.Send(ctx, n)
+		result.MessageID = receipt.MessageID
+		result.Attempts = max(receipt.Attempts, 1)
+		result.Segments, result.EstimatedCost = receipt.Segments, receipt.EstimatedCost
+	}
+	result.LatencyMs = time.Since(start).Milliseconds()
+
+	if err != nil {
+		failed := Failed(result.Channel, result.Contact, err)
+		failed.Attempts, failed.LatencyMs = result.Attempts, result.LatencyMs
+		return failed
+	}
+
+	result.Status = StatusSent
+	return result
+}
+
+// Failed builds the result for a delivery that failed with err.
+func Failed(channelName, contact string, err error) DeliveryResult {
+	return DeliveryResult{
+		Channel:    channelName,
+		Contact:    contact,
+		Status:     StatusFailed,
+		ErrorClass: ErrorClass(err),
+		Error:      err.Error(),
+		err:        err,
+	}
+}
+
+// ResultsError summarises the failed results as a single error, or nil if
+// nothing failed. The error is only permanent when every failure is, so a
+// single transient failure still gets the message redelivered.
+func ResultsError(results []DeliveryResult) error {
+	var failed []DeliveryResult
+	for _, r := range results {
+		if r.Status == StatusFailed {
+			failed = append(failed, r)
+		}
+	}
+
+	switch len(failed) {
+	case 0:
+		return nil
+	case 1:
+		return failed[0].err
+	}
+
+	var transient []error
+	var msgs []string
+	for _, r := range failed {
+		msgs = append(msgs, fmt.Sprintf("%s to %s: %v", r.Channel, r.Contact, r.err))
+		if r.ErrorClass != ErrorClassPermanent {
+			transient = append(transient, r.err)
+		}
+	}
+
+	err := &resultsError{msg: strings.Join(msgs, "; "), errs: transient}
+	if len(transient) == 0 {
+		return Permanent(err)
+	}
+	return err
+}
+
+// resultsError lists every failed channel but only unwraps to the transient
+// errors, so IsPermanent does not see permanent failures mixed in.
+type resultsError struct {
+	msg  string
+	errs []error
+}
+
+func (e *resultsError) Error() string   { return e.msg }
+func (e *resultsError) Unwrap() []error { return e.errs }
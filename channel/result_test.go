@@ -0,0 +1,100 @@
+package channel
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type funcChannel struct {
+	name     string
+	validate func(string) error
+	send     func(Notification) (Receipt, error)
+}
+
+func (f funcChannel) Name() string { return f.name }
+func (f funcChannel) Validate(contact string) error {
+	if f.validate == nil {
+		return nil
+	}
+	return f.validate(contact)
+}
+func (f funcChannel) Send(ctx context.Context, n Notification) (Receipt, error) {
+	return f.send(n)
+}
+
+// TestDeliver_Sent tests the result of a successful send
+func TestDeliver_Sent(t *testing.T) {
+	c := funcChannel{name: "email", send: func(n Notification) (Receipt, error) {
+		return Receipt{MessageID: "abc", Attempts: 2}, nil
+	}}
+
+	r := Deliver(context.Background(), c, Notification{Contact: "a@example.com"})
+
+	if r.Status != StatusSent || r.MessageID != "abc" || r.Attempts != 2 || r.ErrorClass != "" {
+		t.Errorf("Unexpected result: %+v", r)
+	}
+}
+
+// TestDeliver_InvalidContact tests that validation failures are permanent and never sent
+func TestDeliver_InvalidContact(t *testing.T) {
+	c := funcChannel{
+		name:     "email",
+		validate: func(string) error { return errors.New("bad address") },
+		send: func(n Notification) (Receipt, error) {
+			t.Error("Send should not be called for an invalid contact")
+			return Receipt{}, nil
+		},
+	}
+
+	r := Deliver(context.Background(), c, Notification{Contact: "nope"})
+
+	if r.Status != StatusFailed || r.ErrorClass != ErrorClassPermanent || r.Attempts != 0 {
+		t.Errorf("Unexpected result: %+v", r)
+	}
+	if !IsPermanent(r.Err()) {
+		t.Errorf("Expected permanent error, got: %v", r.Err())
+	}
+}
+
+// TestDeliver_TransientFailure tests the result of a transient send failure
+func TestDeliver_TransientFailure(t *testing.T) {
+	c := funcChannel{name: "whatsapp", send: func(n Notification) (Receipt, error) {
+		return Receipt{}, errors.New("503")
+	}}
+
+	r := Deliver(context.Background(), c, Notification{Contact: "+1234567890"})
+
+	if r.Status != StatusFailed || r.ErrorClass != ErrorClassTransient || r.Error != "503" || r.Attempts != 1 {
+		t.Errorf("Unexpected result: %+v", r)
+	}
+}
+
+// TestResultsError tests how mixed failures are summarised
+func TestResultsError(t *testing.T) {
+	sent := DeliveryResult{Channel: "email", Status: StatusSent}
+	permanent := Failed("email", "bad", Permanent(errors.New("invalid contact")))
+	transient := Failed("whatsapp", "+1", errors.New("timeout"))
+
+	if err := ResultsError([]DeliveryResult{sent}); err != nil {
+		t.Errorf("Expected nil error, got: %v", err)
+	}
+
+	err := ResultsError([]DeliveryResult{sent, transient})
+	if err == nil || err.Error() != "timeout" || IsPermanent(err) {
+		t.Errorf("Expected single transient error, got: %v", err)
+	}
+
+	err = ResultsError([]DeliveryResult{permanent, transient})
+	if err == nil || IsPermanent(err) {
+		t.Errorf("Expected transient error when any failure is transient, got: %v", err)
+	}
+	if err.Error() != "email to bad: invalid contact; whatsapp to +1: timeout" {
+		t.Errorf("Unexpected message: %s", err.Error())
+	}
+
+	err = ResultsError([]DeliveryResult{permanent, permanent})
+	if !IsPermanent(err) {
+		t.Errorf("Expected permanent error when all failures are permanent, got: %v", err)
+	}
+}
@@ -0,0 +1,47 @@
+package channel
+
+import (
+	"boh/notification-service/retry"
+	"context"
+)
+
+// Retryer is implemented by channels that know which of their errors are
+// worth retrying, e.g. SMTP 4xx replies or HTTP 429/5xx responses.
+type Retryer interface {
+	Retryable(err error) bool
+}
+
+type retryingChannel struct {
+	Channel
+	policy retry.Policy
+}
+
+// WithRetry wraps c so every Send is retried according to policy. Unless the
+// policy sets its own predicate, permanent and deferred errors are never
+// retried and channels implementing Retryer decide for everything else.
+func WithRetry(c Channel, policy retry.Policy) Channel {
+	if policy.Retryable == nil {
+		retryer, _ := c.(Retryer)
+		policy.Retryable = func(err error) bool {
+			if IsPermanent(err) {
+				return false
+			}
+			if _, deferred := DeferUntil(err); deferred {
+				return false
+			}
+			return retryer == nil || retryer.Retryable(err)
+		}
+	}
+	return retryingChannel{Channel: c, policy: policy}
+}
+
+func (c retryingChannel) Send(ctx context.Context, n Notification) (Receipt, error) {
+	var receipt Receipt
+	attempts, err := c.policy.Do(ctx, func(ctx context.Context) error {
+		var err error
+		receipt, err = c.Channel.Send(ctx, n)
+		return err
+	})
+	receipt.Attempts = attempts
+	return receipt, err
+}
@@ -0,0 +1,67 @@
+package channel
+
+import (
+	"boh/notification-service/retry"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type retryerChannel struct {
+	funcChannel
+	retryable func(error) bool
+}
+
+func (c retryerChannel) Retryable(err error) bool { return c.retryable(err) }
+
+// TestWithRetry_CountsAttempts tests that the receipt reports every attempt
+func TestWithRetry_CountsAttempts(t *testing.T) {
+	calls := 0
+	c := funcChannel{name: "email", send: func(n Notification) (Receipt, error) {
+		calls++
+		if calls < 3 {
+			return Receipt{}, errors.New("421 try again")
+		}
+		return Receipt{MessageID: "m1"}, nil
+	}}
+
+	r := Deliver(context.Background(), WithRetry(c, retry.Policy{MaxAttempts: 5, BaseDelay: time.Millisecond}), Notification{})
+
+	if r.Status != StatusSent || r.Attempts != 3 || r.MessageID != "m1" {
+		t.Errorf("Unexpected result: %+v", r)
+	}
+}
+
+// TestWithRetry_PermanentNotRetried tests that permanent errors are not retried
+func TestWithRetry_PermanentNotRetried(t *testing.T) {
+	calls := 0
+	c := funcChannel{name: "email", send: func(n Notification) (Receipt, error) {
+		calls++
+		return Receipt{}, Permanent(errors.New("550 no such user"))
+	}}
+
+	WithRetry(c, retry.Policy{MaxAttempts: 5, BaseDelay: time.Millisecond}).Send(context.Background(), Notification{})
+
+	if calls != 1 {
+		t.Errorf("Expected 1 call, got: %d", calls)
+	}
+}
+
+// TestWithRetry_UsesChannelPredicate tests that a channel's Retryable method is consulted
+func TestWithRetry_UsesChannelPredicate(t *testing.T) {
+	calls := 0
+	c := retryerChannel{
+		funcChannel: funcChannel{name: "whatsapp", send: func(n Notification) (Receipt, error) {
+			calls++
+			return Receipt{}, errors.New("400 bad request")
+		}},
+		retryable: func(err error) bool { return false },
+	}
+
+	receipt, _ := WithRetry(c, retry.Policy{MaxAttempts: 5, BaseDelay: time.Millisecond}).Send(context.Background(), Notification{})
+
+	if calls != 1 || receipt.Attempts != 1 {
+		t.Errorf("Expected a single attempt, got calls=%d attempts=%d", calls, receipt.Attempts)
+	}
+}
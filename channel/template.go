@@ -0,0 +1,117 @@
+package channel
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Template button types.
+const (
+	ButtonQuickReply = "quickReply"
+	ButtonURL        = "url"
+)
+
+// Header media kinds.
+const (
+	MediaImage    = "image"
+	MediaDocument = "document"
+	MediaVideo    = "video"
+)
+
+// Template is a message template pre-approved with the provider. WhatsApp
+// only delivers templates outside the 24-hour customer service window, so
+// proactive alerts must use one.
+type Template struct {
+	Name     string `json:"name"`
+	Language string `json:"language"`
+	// Header is media shown above the body, for templates that have one.
+	Header *Media `json:"header,omitempty"`
+	// Body fills the body placeholders in order.
+	Body    []TemplateParameter `json:"body,omitempty"`
+	Buttons []TemplateButton    `json:"buttons,omitempty"`
+}
+
+// TemplateParameter is one body value. Name is optional; in JSON a
+// positional value can be given as a plain string.
+type TemplateParameter struct {
+	Name string `json:"name,omitempty"`
+	Text string `json:"text"`
+}
+
+// UnmarshalJSON accepts either "value" or {"name": "...", "text": "value"}.
+func (p *TemplateParameter) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte(`"`)) {
+		*p = TemplateParameter{}
+		return json.Unmarshal(data, &p.Text)
+	}
+	type plain TemplateParameter
+	return json.Unmarshal(data, (*plain)(p))
+}
+
+// TemplateButton fills one of the template's buttons, in order.
+type TemplateButton struct {
+	// Type is ButtonQuickReply or ButtonURL.
+	Type string `json:"type"`
+	// Payload is returned to us when a quick-reply button is pressed.
+	Payload string `json:"payload,omitempty"`
+	// Text is the dynamic suffix appended to a URL button's base URL.
+	Text string `json:"text,omitempty"`
+}
+
+// Media is an image, document or video sent by URL. MIMEType and Size are
+// optional; providers that limit them may look them up from the URL.
+type Media struct {
+	Kind     string `json:"kind"`
+	URL      string `json:"url"`
+	MIMEType string `json:"mimeType,omitempty"`
+	Size     int64  `json:"size,omitempty"`
+	Caption  string `json:"caption,omitempty"`
+	FileName string `json:"fileName,omitempty"`
+}
+
+// Validate checks that t names a template and that its header and buttons
+// are of supported kinds.
+func (t *Template) Validate() error {
+	if t.Name == "" {
+		return fmt.Errorf("template name is empty")
+	}
+	if t.Language == "" {
+		return fmt.Errorf("template %q has no language", t.Name)
+	}
+	if t.Header != nil {
+		switch t.Header.Kind {
+		case MediaImage, MediaDocument, MediaVideo:
+		default:
+			return fmt.Errorf("template %q header has unsupported kind %q", t.Name, t.Header.Kind)
+		}
+		if t.Header.URL == "" {
+			return fmt.Errorf("template %q header has no url", t.Name)
+		}
+	}
+	names := map[string]bool{}
+	for _, p := range t.Body {
+		if p.Name == "" {
+			continue
+		}
+		if names[p.Name] {
+			return fmt.Errorf("template %q has duplicate parameter %q", t.Name, p.Name)
+		}
+		names[p.Name] = true
+	}
+	for i, b := range t.Buttons {
+		switch b.Type {
+		case ButtonQuickReply:
+			if b.Payload == "" {
+				return fmt.Errorf("template %q button %d has no payload", t.Name, i+1)
+			}
+		case ButtonURL:
+			if b.Text == "" {
+				return fmt.Errorf("template %q button %d has no text", t.Name, i+1)
+			}
+		default:
+			return fmt.Errorf("template %q button %d has unsupported type %q", t.Name, i+1, b.Type)
+		}
+	}
+	return nil
+}
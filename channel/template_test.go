@@ -0,0 +1,76 @@
+package channel
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// TestTemplate_UnmarshalParameters tests that body values can be positional strings or named objects
+func TestTemplate_UnmarshalParameters(t *testing.T) {
+	var tmpl Template
+	err := json.Unmarshal([]byte(`{"name":"txn","language":"en_US","body":["100.00",{"name":"merchant","text":"Shop"}]}`), &tmpl)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	want := []TemplateParameter{{Text: "100.00"}, {Name: "merchant", Text: "Shop"}}
+	if len(tmpl.Body) != len(want) {
+		t.Fatalf("Expected %d parameters, got %+v", len(want), tmpl.Body)
+	}
+	for i := range want {
+		if tmpl.Body[i] != want[i] {
+			t.Errorf("Parameter %d: expected %+v, got %+v", i, want[i], tmpl.Body[i])
+		}
+	}
+}
+
+// TestTemplate_Validate tests the checks on template names, headers and buttons
+func TestTemplate_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		tmpl    Template
+		wantErr bool
+	}{
+		{"valid", Template{Name: "txn", Language: "en_US", Header: &Media{Kind: MediaDocument, URL: "https://example.com/a.pdf"}, Buttons: []TemplateButton{{Type: ButtonQuickReply, Payload: "yes"}, {Type: ButtonURL, Text: "abc"}}}, false},
+		{"no name", Template{Language: "en_US"}, true},
+		{"no language", Template{Name: "txn"}, true},
+		{"bad header kind", Template{Name: "txn", Language: "en_US", Header: &Media{Kind: "audio", URL: "https://example.com/a.mp3"}}, true},
+		{"duplicate parameter", Template{Name: "txn", Language: "en_US", Body: []TemplateParameter{{Name: "a"}, {Name: "a"}}}, true},
+		{"quick reply without payload", Template{Name: "txn", Language: "en_US", Buttons: []TemplateButton{{Type: ButtonQuickReply}}}, true},
+		{"unknown button", Template{Name: "txn", Language: "en_US", Buttons: []TemplateButton{{Type: "call"}}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.tmpl.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error=%v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+// TestInteractive_Validate tests the reply button limits
+func TestInteractive_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		buttons []ReplyButton
+		wantErr bool
+	}{
+		{"valid", []ReplyButton{{ID: "confirm", Title: "Yes, it was me"}, {ID: "block", Title: "No, block my card"}}, false},
+		{"no buttons", nil, true},
+		{"too many buttons", []ReplyButton{{"a", "A"}, {"b", "B"}, {"c", "C"}, {"d", "D"}}, true},
+		{"duplicate id", []ReplyButton{{"a", "A"}, {"a", "B"}}, true},
+		{"long title", []ReplyButton{{"a", "This title is far too long"}}, true},
+		{"empty id", []ReplyButton{{"", "A"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := (&Interactive{Buttons: tt.buttons}).Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error=%v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,281 @@
+package consumer
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+)
+
+// Receiver is the subset of *azservicebus.Receiver used by the consumer.
+type Receiver interface {
+	ReceiveMessages(ctx context.Context, maxMessages int, options *azservicebus.ReceiveMessagesOptions) ([]*azservicebus.ReceivedMessage, error)
+	CompleteMessage(ctx context.Context, message *azservicebus.ReceivedMessage, options *azservicebus.CompleteMessageOptions) error
+	AbandonMessage(ctx context.Context, message *azservicebus.ReceivedMessage, options *azservicebus.AbandonMessageOptions) error
+	DeadLetterMessage(ctx context.Context, message *azservicebus.ReceivedMessage, options *azservicebus.DeadLetterOptions) error
+	RenewMessageLock(ctx context.Context, msg *azservicebus.ReceivedMessage, options *azservicebus.RenewMessageLockOptions) error
+}
+
+// Handler processes a single message. A nil error completes the message;
+// errors marked with channel.Permanent dead-letter it, errors marked with
+// channel.Deferred reschedule it and any other error abandons it for
+// redelivery.
+type Handler func(ctx context.Context, msg *azservicebus.ReceivedMessage) error
+
+type Options struct {
+	// MaxConcurrency is the number of messages processed at the same time.
+	MaxConcurrency int
+	// ReceiveTimeout bounds a single ReceiveMessages call.
+	ReceiveTimeout time.Duration
+	// RetryDelay is the wait after a failed ReceiveMessages call.
+	RetryDelay time.Duration
+	// MaxDeliveryAttempts is the delivery count at which a message failing
+	// with a transient error is dead-lettered instead of abandoned.
+	MaxDeliveryAttempts int
+	// ShutdownTimeout is how long Run waits for in-flight messages after
+	// its context is cancelled before abandoning them.
+	ShutdownTimeout time.Duration
+	// LockRenewInterval is used to renew peek-locks when a message does not
+	// report LockedUntil. Otherwise renewals happen halfway to expiry.
+	LockRenewInterval time.Duration
+	// MaxLockRenewal caps how long a single message's lock is kept alive.
+	MaxLockRenewal time.Duration
+	// SettleTimeout bounds each complete, abandon, dead-letter and
+	// reschedule call.
+	SettleTimeout time.Duration
+	// Reschedule re-enqueues a message for delivery at the given time. It is
+	// used for deferred errors, such as an open circuit breaker, so waiting
+	// for a provider does not use up the message's delivery count. When nil
+	// such messages are abandoned like any transient failure.
+	Reschedule func(ctx context.Context, msg *azservicebus.ReceivedMessage, at time.Time) error
+	// MaxReschedules caps how often one notification is rescheduled. After
+	// that a deferred error is abandoned, and in the end dead-lettered, like
+	// any transient failure, so a breaker that stays open cannot keep a
+	// message around forever.
+	MaxReschedules int
+}
+
+// Consumer receives messages in batches and fans them out to a bounded
+// set of workers. Each message is settled on its own once its handler returns.
+type Consumer struct {
+	receiver Receiver
+	handler  Handler
+	opts     Options
+
+	slots chan struct{}
+	wg    sync.WaitGroup
+
+	mu       sync.Mutex
+	inFlight map[*azservicebus.ReceivedMessage]*sync.Once
+}
+
+func New(receiver Receiver, handler Handler, opts Options) *Consumer {
+	if opts.MaxConcurrency <= 0 {
+		opts.MaxConcurrency = 1
+	}
+	if opts.ReceiveTimeout <= 0 {
+		opts.ReceiveTimeout = 60 * time.Second
+	}
+	if opts.RetryDelay <= 0 {
+		opts.RetryDelay = 5 * time.Second
+	}
+	if opts.MaxDeliveryAttempts <= 0 {
+		opts.MaxDeliveryAttempts = 5
+	}
+	if opts.ShutdownTimeout <= 0 {
+		opts.ShutdownTimeout = 30 * time.Second
+	}
+	if opts.LockRenewInterval <= 0 {
+		opts.LockRenewInterval = 30 * time.Second
+	}
+	if opts.MaxLockRenewal <= 0 {
+		opts.MaxLockRenewal = 5 * time.Minute
+	}
+	if opts.MaxReschedules <= 0 {
+		opts.MaxReschedules = 20
+	}
+	if opts.SettleTimeout <= 0 {
+		opts.SettleTimeout = 30 * time.Second
+	}
+
+	return &Consumer{
+		receiver: receiver,
+		handler:  handler,
+		opts:     opts,
+		slots:    make(chan struct{}, opts.MaxConcurrency),
+		inFlight: make(map[*azservicebus.ReceivedMessage]*sync.Once),
+	}
+}
+
+// Run receives and dispatches messages until ctx is cancelled. It then stops
+// receiving, gives in-flight handlers up to ShutdownTimeout to finish and
+// abandons whatever is still running so it can be redelivered elsewhere.
+func (c *Consumer) Run(ctx context.Context) error {
+	// Handlers keep running after ctx is cancelled so they can finish their
+	// sends; workCtx is only cancelled once the drain deadline has passed.
+	workCtx, cancelWork := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelWork()
+
+	for {
+		free := c.acquire(ctx)
+		if free == 0 {
+			break
+		}
+
+		receiveCtx, cancel := context.WithTimeout(ctx, c.opts.ReceiveTimeout)
+		messages, err := c.receiver.ReceiveMessages(receiveCtx, free, nil)
+		cancel()
+
+		// Hand back the slots we asked for but did not get messages for.
+		for i := len(messages); i < free; i++ {
+			<-c.slots
+		}
+
+		for _, msg := range messages {
+			c.track(msg)
+			c.wg.Add(1)
+			go c.process(workCtx, msg)
+		}
+
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			log.Printf("Error receiving message: %v. Retrying...\n", err)
+			select {
+			case <-time.After(c.opts.RetryDelay):
+			case <-ctx.Done():
+			}
+		}
+	}
+
+	c.drain(cancelWork)
+	return ctx.Err()
+}
+
+// drain waits for in-flight handlers up to ShutdownTimeout, then cancels
+// them and abandons their messages.
+func (c *Consumer) drain(cancelWork context.CancelFunc) {
+	done := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(done)
+	}()
+
+	log.Printf("Stopped receiving, waiting up to %s for in-flight messages\n", c.opts.ShutdownTimeout)
+
+	select {
+	case <-done:
+		log.Println("All in-flight messages settled")
+		return
+	case <-time.After(c.opts.ShutdownTimeout):
+	}
+
+	cancelWork()
+
+	c.mu.Lock()
+	pending := make(map[*azservicebus.ReceivedMessage]*sync.Once, len(c.inFlight))
+	for msg, once := range c.inFlight {
+		pending[msg] = once
+	}
+	c.mu.Unlock()
+
+	for msg, once := range pending {
+		once.Do(func() {
+			options := &azservicebus.AbandonMessageOptions{
+				PropertiesToModify: map[string]any{"lastError": "abandoned during shutdown"},
+			}
+			ctx, cancel := c.settleContext()
+			defer cancel()
+			if err := c.receiver.AbandonMessage(ctx, msg, options); err != nil {
+				log.Printf("Error abandoning message %s during shutdown: %v\n", msg.MessageID, err)
+				return
+			}
+			log.Printf("Message %s abandoned during shutdown\n", msg.MessageID)
+		})
+	}
+}
+
+// acquire blocks until at least one worker slot is free and then claims
+// every other free slot, returning the number claimed.
+func (c *Consumer) acquire(ctx context.Context) int {
+	select {
+	case c.slots <- struct{}{}:
+	case <-ctx.Done():
+		return 0
+	}
+
+	n := 1
+	for n < cap(c.slots) {
+		select {
+		case c.slots <- struct{}{}:
+			n++
+		default:
+			return n
+		}
+	}
+	return n
+}
+
+func (c *Consumer) track(msg *azservicebus.ReceivedMessage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inFlight[msg] = &sync.Once{}
+}
+
+// settleContext bounds a settlement call. It does not derive from the
+// worker context, which is already cancelled when a shutdown abandons a
+// message.
+func (c *Consumer) settleContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), c.opts.SettleTimeout)
+}
+
+// settle runs fn unless the message was already settled during shutdown.
+func (c *Consumer) settle(msg *azservicebus.ReceivedMessage, fn func()) {
+	c.mu.Lock()
+	once := c.inFlight[msg]
+	delete(c.inFlight, msg)
+	c.mu.Unlock()
+
+	once.Do(fn)
+}
+
+func (c *Consumer) process(ctx context.Context, msg *azservicebus.ReceivedMessage) {
+	defer c.wg.Done()
+	defer func() { <-c.slots }()
+
+	log.Printf("Received message ID: %s\n", msg.MessageID)
+
+	// The lock is renewed for as long as the handler runs and stops as soon
+	// as the message is about to be settled.
+	handlerCtx, cancelHandler := context.WithCancel(ctx)
+	renewCtx, stopRenewal := context.WithCancel(ctx)
+	renewed := make(chan struct{})
+	go func() {
+		defer close(renewed)
+		c.renewLock(renewCtx, msg, cancelHandler)
+	}()
+
+	err := c.handler(handlerCtx, msg)
+	stopRenewal()
+	<-renewed
+	cancelHandler()
+
+	c.settle(msg, func() {
+		if err != nil {
+			log.Printf("Error processing message %s: %v\n", msg.MessageID, err)
+			c.settleFailed(msg, err)
+			return
+		}
+
+		ctx, cancel := c.settleContext()
+		defer cancel()
+		if err := c.receiver.CompleteMessage(ctx, msg, nil); err != nil {
+			log.Printf("Error completing message %s: %v\n", msg.MessageID, err)
+		} else {
+			log.Printf("Message %s completed successfully.\n", msg.MessageID)
+		}
+	})
+}
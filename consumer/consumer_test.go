@@ -0,0 +1,249 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+)
+
+// fakeReceiver hands out a fixed set of messages and records settlements.
+type fakeReceiver struct {
+	mu          sync.Mutex
+	pending     []*azservicebus.ReceivedMessage
+	requested   []int
+	completed   []string
+	abandoned   []string
+	deadLetters map[string]string
+	renewals    int
+	renewErr    error
+}
+
+func newFakeReceiver(n int) *fakeReceiver {
+	r := &fakeReceiver{}
+	for i := 0; i < n; i++ {
+		r.pending = append(r.pending, &azservicebus.ReceivedMessage{MessageID: fmt.Sprintf("msg-%d", i)})
+	}
+	return r
+}
+
+func (r *fakeReceiver) ReceiveMessages(ctx context.Context, maxMessages int, options *azservicebus.ReceiveMessagesOptions) ([]*azservicebus.ReceivedMessage, error) {
+	r.mu.Lock()
+	r.requested = append(r.requested, maxMessages)
+	n := min(maxMessages, len(r.pending))
+	batch := r.pending[:n]
+	r.pending = r.pending[n:]
+	r.mu.Unlock()
+
+	if len(batch) == 0 {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return batch, nil
+}
+
+func (r *fakeReceiver) CompleteMessage(ctx context.Context, message *azservicebus.ReceivedMessage, options *azservicebus.CompleteMessageOptions) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.completed = append(r.completed, message.MessageID)
+	return nil
+}
+
+func (r *fakeReceiver) AbandonMessage(ctx context.Context, message *azservicebus.ReceivedMessage, options *azservicebus.AbandonMessageOptions) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.abandoned = append(r.abandoned, message.MessageID)
+	return nil
+}
+
+func (r *fakeReceiver) DeadLetterMessage(ctx context.Context, message *azservicebus.ReceivedMessage, options *azservicebus.DeadLetterOptions) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.deadLetters == nil {
+		r.deadLetters = make(map[string]string)
+	}
+	r.deadLetters[message.MessageID] = *options.Reason
+	return nil
+}
+
+func (r *fakeReceiver) RenewMessageLock(ctx context.Context, msg *azservicebus.ReceivedMessage, options *azservicebus.RenewMessageLockOptions) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.renewals++
+	return r.renewErr
+}
+
+func (r *fakeReceiver) completedCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.completed)
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// TestConsumer_CompletesAllMessages tests that every successfully handled message is completed
+func TestConsumer_CompletesAllMessages(t *testing.T) {
+	r := newFakeReceiver(25)
+	handler := func(ctx context.Context, msg *azservicebus.ReceivedMessage) error { return nil }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	c := New(r, handler, Options{MaxConcurrency: 4, ReceiveTimeout: 50 * time.Millisecond})
+	go func() { done <- c.Run(ctx) }()
+
+	waitFor(t, func() bool { return r.completedCount() == 25 })
+	cancel()
+
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got: %v", err)
+	}
+}
+
+// TestConsumer_RespectsMaxConcurrency tests that no more than MaxConcurrency handlers run at once
+func TestConsumer_RespectsMaxConcurrency(t *testing.T) {
+	const limit = 3
+	r := newFakeReceiver(12)
+
+	var running, peak int32
+	handler := func(ctx context.Context, msg *azservicebus.ReceivedMessage) error {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := New(r, handler, Options{MaxConcurrency: limit, ReceiveTimeout: 50 * time.Millisecond})
+	go c.Run(ctx)
+
+	waitFor(t, func() bool { return r.completedCount() == 12 })
+
+	if p := atomic.LoadInt32(&peak); p > limit {
+		t.Errorf("Expected at most %d concurrent handlers, got: %d", limit, p)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, n := range r.requested {
+		if n > limit {
+			t.Errorf("Expected batch size at most %d, got: %d", limit, n)
+		}
+	}
+}
+
+// TestConsumer_HandlerErrorDoesNotComplete tests that failed messages are not completed
+func TestConsumer_HandlerErrorDoesNotComplete(t *testing.T) {
+	r := newFakeReceiver(2)
+	var handled int32
+	handler := func(ctx context.Context, msg *azservicebus.ReceivedMessage) error {
+		atomic.AddInt32(&handled, 1)
+		if msg.MessageID == "msg-0" {
+			return errors.New("boom")
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := New(r, handler, Options{MaxConcurrency: 2, ReceiveTimeout: 50 * time.Millisecond})
+	go c.Run(ctx)
+
+	waitFor(t, func() bool { return atomic.LoadInt32(&handled) == 2 && r.completedCount() == 1 })
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.completed[0] != "msg-1" {
+		t.Errorf("Expected only msg-1 to be completed, got: %v", r.completed)
+	}
+}
+
+// TestConsumer_ShutdownWaitsForInFlight tests that cancelling Run lets running handlers finish and complete
+func TestConsumer_ShutdownWaitsForInFlight(t *testing.T) {
+	r := newFakeReceiver(1)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := func(ctx context.Context, msg *azservicebus.ReceivedMessage) error {
+		close(started)
+		<-release
+		return ctx.Err()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	c := New(r, handler, Options{MaxConcurrency: 1, ReceiveTimeout: 50 * time.Millisecond, ShutdownTimeout: time.Second})
+	go func() { done <- c.Run(ctx) }()
+
+	<-started
+	cancel()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	<-done
+
+	if r.completedCount() != 1 {
+		t.Errorf("Expected in-flight message to be completed, got completed: %v", r.completed)
+	}
+	if len(r.abandoned) != 0 {
+		t.Errorf("Expected no abandons, got: %v", r.abandoned)
+	}
+}
+
+// TestConsumer_ShutdownAbandonsAfterTimeout tests that handlers still running after ShutdownTimeout are abandoned
+func TestConsumer_ShutdownAbandonsAfterTimeout(t *testing.T) {
+	r := newFakeReceiver(1)
+	started := make(chan struct{})
+	handlerCtx := make(chan context.Context, 1)
+	handler := func(ctx context.Context, msg *azservicebus.ReceivedMessage) error {
+		handlerCtx <- ctx
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	c := New(r, handler, Options{MaxConcurrency: 1, ReceiveTimeout: 50 * time.Millisecond, ShutdownTimeout: 50 * time.Millisecond})
+	go func() { done <- c.Run(ctx) }()
+
+	<-started
+	cancel()
+	<-done
+
+	if err := (<-handlerCtx).Err(); err == nil {
+		t.Error("Expected handler context to be cancelled after the shutdown timeout")
+	}
+
+	r.mu.Lock()
+	abandoned := append([]string(nil), r.abandoned...)
+	r.mu.Unlock()
+	if len(abandoned) != 1 || abandoned[0] != "msg-0" {
+		t.Errorf("Expected msg-0 to be abandoned, got: %v", abandoned)
+	}
+
+	// The handler's own failure must not settle the message a second time.
+	time.Sleep(20 * time.Millisecond)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.abandoned) != 1 || len(r.completed) != 0 || len(r.deadLetters) != 0 {
+		t.Errorf("Expected a single settlement, got abandoned=%v completed=%v deadLetters=%v", r.abandoned, r.completed, r.deadLetters)
+	}
+}
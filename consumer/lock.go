@@ -0,0 +1,85 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"log"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+)
+
+// Lock renewal counters, published under "consumer" on /debug/vars.
+var (
+	metrics             = expvar.NewMap("consumer")
+	metricLockRenewals  = new(expvar.Int)
+	metricRenewFailures = new(expvar.Int)
+	metricLocksLost     = new(expvar.Int)
+)
+
+// minLockRenewInterval stops renewals from spinning when a lock is
+// already close to expiry.
+const minLockRenewInterval = time.Second
+
+func init() {
+	metrics.Set("lockRenewals", metricLockRenewals)
+	metrics.Set("lockRenewalFailures", metricRenewFailures)
+	metrics.Set("locksLost", metricLocksLost)
+}
+
+// renewLock keeps msg's peek-lock alive until ctx is cancelled or
+// MaxLockRenewal has elapsed. If the lock is lost, onLost is called so the
+// handler can stop working on a message that will be redelivered anyway.
+func (c *Consumer) renewLock(ctx context.Context, msg *azservicebus.ReceivedMessage, onLost func()) {
+	deadline := time.Now().Add(c.opts.MaxLockRenewal)
+
+	for {
+		timer := time.NewTimer(c.nextRenewal(msg))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if time.Now().After(deadline) {
+			log.Printf("Stopped renewing lock for message %s after %s\n", msg.MessageID, c.opts.MaxLockRenewal)
+			return
+		}
+
+		err := c.receiver.RenewMessageLock(ctx, msg, nil)
+		if err == nil {
+			metricLockRenewals.Add(1)
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		var sbErr *azservicebus.Error
+		if errors.As(err, &sbErr) && sbErr.Code == azservicebus.CodeLockLost {
+			metricLocksLost.Add(1)
+			log.Printf("Lock lost for message %s: %v\n", msg.MessageID, err)
+			onLost()
+			return
+		}
+
+		metricRenewFailures.Add(1)
+		log.Printf("Error renewing lock for message %s: %v\n", msg.MessageID, err)
+	}
+}
+
+// nextRenewal schedules the renewal halfway to LockedUntil, which leaves
+// room for one failed attempt before the lock expires.
+func (c *Consumer) nextRenewal(msg *azservicebus.ReceivedMessage) time.Duration {
+	if msg.LockedUntil == nil {
+		return c.opts.LockRenewInterval
+	}
+
+	wait := time.Until(*msg.LockedUntil) / 2
+	if wait < minLockRenewInterval {
+		return minLockRenewInterval
+	}
+	return wait
+}
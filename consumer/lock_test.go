@@ -0,0 +1,128 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+)
+
+// TestRenewLock_RenewsUntilCancelled tests that locks are renewed while the handler runs
+func TestRenewLock_RenewsUntilCancelled(t *testing.T) {
+	r := &fakeReceiver{}
+	c := New(r, nil, Options{LockRenewInterval: 10 * time.Millisecond})
+	msg := &azservicebus.ReceivedMessage{MessageID: "slow"}
+	before := metricLockRenewals.Value()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.renewLock(ctx, msg, func() { t.Error("Unexpected lock lost") })
+		close(done)
+	}()
+
+	time.Sleep(55 * time.Millisecond)
+	cancel()
+	<-done
+
+	r.mu.Lock()
+	renewals := r.renewals
+	r.mu.Unlock()
+	if renewals < 3 {
+		t.Errorf("Expected at least 3 renewals, got: %d", renewals)
+	}
+	if metricLockRenewals.Value()-before != int64(renewals) {
+		t.Errorf("Expected renewal metric to match %d renewals, got: %d", renewals, metricLockRenewals.Value()-before)
+	}
+}
+
+// TestRenewLock_LockLost tests that a lost lock stops renewal and notifies the caller
+func TestRenewLock_LockLost(t *testing.T) {
+	r := &fakeReceiver{renewErr: &azservicebus.Error{Code: azservicebus.CodeLockLost}}
+	c := New(r, nil, Options{LockRenewInterval: 10 * time.Millisecond})
+	msg := &azservicebus.ReceivedMessage{MessageID: "expired"}
+	before := metricLocksLost.Value()
+
+	lost := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		c.renewLock(context.Background(), msg, func() { close(lost) })
+		close(done)
+	}()
+
+	select {
+	case <-lost:
+	case <-time.After(time.Second):
+		t.Fatal("Expected lock lost callback")
+	}
+	<-done
+
+	if metricLocksLost.Value()-before != 1 {
+		t.Errorf("Expected locksLost to increase by 1, got: %d", metricLocksLost.Value()-before)
+	}
+}
+
+// TestRenewLock_TransientFailureKeepsRenewing tests that other renewal errors are retried
+func TestRenewLock_TransientFailureKeepsRenewing(t *testing.T) {
+	r := &fakeReceiver{renewErr: errors.New("connection reset")}
+	c := New(r, nil, Options{LockRenewInterval: 10 * time.Millisecond})
+	msg := &azservicebus.ReceivedMessage{MessageID: "flaky"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 45*time.Millisecond)
+	defer cancel()
+	c.renewLock(ctx, msg, func() { t.Error("Unexpected lock lost") })
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.renewals < 2 {
+		t.Errorf("Expected renewal to be retried, got %d attempts", r.renewals)
+	}
+}
+
+// TestNextRenewal tests that renewals are scheduled halfway to lock expiry
+func TestNextRenewal(t *testing.T) {
+	c := New(&fakeReceiver{}, nil, Options{LockRenewInterval: 7 * time.Second})
+
+	if got := c.nextRenewal(&azservicebus.ReceivedMessage{}); got != 7*time.Second {
+		t.Errorf("Expected fallback interval 7s, got: %s", got)
+	}
+
+	lockedUntil := time.Now().Add(60 * time.Second)
+	got := c.nextRenewal(&azservicebus.ReceivedMessage{LockedUntil: &lockedUntil})
+	if got < 29*time.Second || got > 30*time.Second {
+		t.Errorf("Expected about 30s, got: %s", got)
+	}
+
+	expired := time.Now().Add(-time.Second)
+	if got := c.nextRenewal(&azservicebus.ReceivedMessage{LockedUntil: &expired}); got != minLockRenewInterval {
+		t.Errorf("Expected minimum interval %s, got: %s", minLockRenewInterval, got)
+	}
+}
+
+// TestConsumer_LockLostCancelsHandler tests that the handler context is cancelled when the lock is lost
+func TestConsumer_LockLostCancelsHandler(t *testing.T) {
+	r := newFakeReceiver(1)
+	r.renewErr = &azservicebus.Error{Code: azservicebus.CodeLockLost}
+	handled := make(chan error, 1)
+	handler := func(ctx context.Context, msg *azservicebus.ReceivedMessage) error {
+		<-ctx.Done()
+		handled <- ctx.Err()
+		return ctx.Err()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := New(r, handler, Options{MaxConcurrency: 1, ReceiveTimeout: 50 * time.Millisecond, LockRenewInterval: 10 * time.Millisecond})
+	go c.Run(ctx)
+
+	select {
+	case err := <-handled:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected handler to be cancelled after lock loss")
+	}
+}
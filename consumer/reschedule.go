@@ -0,0 +1,54 @@
+package consumer
+
+import (
+	"context"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+)
+
+// Sender is the subset of *azservicebus.Sender used to reschedule messages.
+type Sender interface {
+	SendMessage(ctx context.Context, message *azservicebus.Message, options *azservicebus.SendMessageOptions) error
+}
+
+// RescheduleWith returns an Options.Reschedule that sends a scheduled copy
+// of the message through sender, which should point at the same queue. The
+// copy gets a fresh MessageID so duplicate detection does not drop it; the
+// original id is kept in the "originalMessageId" property.
+func RescheduleWith(sender Sender) func(ctx context.Context, msg *azservicebus.ReceivedMessage, at time.Time) error {
+	return func(ctx context.Context, msg *azservicebus.ReceivedMessage, at time.Time) error {
+		properties := make(map[string]any, len(msg.ApplicationProperties)+2)
+		for k, v := range msg.ApplicationProperties {
+			properties[k] = v
+		}
+		if _, ok := properties["originalMessageId"]; !ok {
+			properties["originalMessageId"] = msg.MessageID
+		}
+		properties["rescheduleCount"] = rescheduleCount(msg) + 1
+
+		at = at.UTC()
+		scheduled := &azservicebus.Message{
+			Body:                  msg.Body,
+			ContentType:           msg.ContentType,
+			CorrelationID:         msg.CorrelationID,
+			Subject:               msg.Subject,
+			ApplicationProperties: properties,
+			ScheduledEnqueueTime:  &at,
+		}
+		return sender.SendMessage(ctx, scheduled, nil)
+	}
+}
+
+// rescheduleCount returns how often msg has been rescheduled so far.
+func rescheduleCount(msg *azservicebus.ReceivedMessage) int64 {
+	switch n := msg.ApplicationProperties["rescheduleCount"].(type) {
+	case int64:
+		return n
+	case int32:
+		return int64(n)
+	case int:
+		return int64(n)
+	}
+	return 0
+}
@@ -0,0 +1,101 @@
+package consumer
+
+import (
+	"boh/notification-service/channel"
+	"context"
+	"log"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+)
+
+const (
+	// ReasonPermanentFailure is the dead-letter reason for errors that
+	// will not succeed on redelivery.
+	ReasonPermanentFailure = "PermanentProcessingFailure"
+	// ReasonMaxDeliveryAttempts is the dead-letter reason for transient
+	// errors that kept failing until the retry budget ran out.
+	ReasonMaxDeliveryAttempts = "MaxDeliveryAttemptsExceeded"
+
+	// maxDescriptionLength keeps the dead-letter description within the
+	// Service Bus property size limits.
+	maxDescriptionLength = 1024
+)
+
+// settleFailed decides what happens to a message whose handler returned err.
+// Permanent errors are dead-lettered straight away; transient errors are
+// abandoned for redelivery until MaxDeliveryAttempts is reached.
+func (c *Consumer) settleFailed(msg *azservicebus.ReceivedMessage, err error) {
+	ctx, cancel := c.settleContext()
+	defer cancel()
+
+	if channel.IsPermanent(err) {
+		c.deadLetter(ctx, msg, ReasonPermanentFailure, err)
+		return
+	}
+
+	if until, ok := channel.DeferUntil(err); ok && c.opts.Reschedule != nil {
+		if count := rescheduleCount(msg); count >= int64(c.opts.MaxReschedules) {
+			log.Printf("Message %s already rescheduled %d times, not rescheduling again\n", msg.MessageID, count)
+		} else if c.reschedule(ctx, msg, until, err) {
+			return
+		}
+	}
+
+	if int(msg.DeliveryCount) >= c.opts.MaxDeliveryAttempts {
+		c.deadLetter(ctx, msg, ReasonMaxDeliveryAttempts, err)
+		return
+	}
+
+	options := &azservicebus.AbandonMessageOptions{
+		PropertiesToModify: map[string]any{"lastError": truncate(err.Error())},
+	}
+	if abandonErr := c.receiver.AbandonMessage(ctx, msg, options); abandonErr != nil {
+		log.Printf("Error abandoning message %s: %v\n", msg.MessageID, abandonErr)
+		return
+	}
+	log.Printf("Message %s abandoned (delivery %d of %d): %v\n", msg.MessageID, msg.DeliveryCount, c.opts.MaxDeliveryAttempts, err)
+}
+
+// reschedule enqueues a copy of msg for until and completes the original.
+// It reports false if the copy could not be sent, leaving msg unsettled.
+func (c *Consumer) reschedule(ctx context.Context, msg *azservicebus.ReceivedMessage, until time.Time, err error) bool {
+	if rErr := c.opts.Reschedule(ctx, msg, until); rErr != nil {
+		log.Printf("Error rescheduling message %s: %v\n", msg.MessageID, rErr)
+		return false
+	}
+	if cErr := c.receiver.CompleteMessage(ctx, msg, nil); cErr != nil {
+		// The copy is already scheduled; the original will be redelivered
+		// too, and the delivery store stops it from notifying twice.
+		log.Printf("Error completing rescheduled message %s: %v\n", msg.MessageID, cErr)
+	}
+	log.Printf("Message %s rescheduled for %s: %v\n", msg.MessageID, until.Format(time.RFC3339), err)
+	return true
+}
+
+func (c *Consumer) deadLetter(ctx context.Context, msg *azservicebus.ReceivedMessage, reason string, err error) {
+	description := truncate(err.Error())
+	options := &azservicebus.DeadLetterOptions{
+		Reason:           &reason,
+		ErrorDescription: &description,
+	}
+	if dlErr := c.receiver.DeadLetterMessage(ctx, msg, options); dlErr != nil {
+		log.Printf("Error dead-lettering message %s: %v\n", msg.MessageID, dlErr)
+		return
+	}
+	log.Printf("Message %s dead-lettered (%s): %v\n", msg.MessageID, reason, err)
+}
+
+// truncate shortens s to at most maxDescriptionLength bytes without
+// splitting a UTF-8 sequence.
+func truncate(s string) string {
+	if len(s) <= maxDescriptionLength {
+		return s
+	}
+	n := maxDescriptionLength
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,149 @@
+package consumer
+
+import (
+	"boh/notification-service/channel"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+)
+
+// TestSettleFailed_Permanent tests that permanent errors are dead-lettered on first delivery
+func TestSettleFailed_Permanent(t *testing.T) {
+	r := &fakeReceiver{}
+	c := New(r, nil, Options{MaxDeliveryAttempts: 5})
+	msg := &azservicebus.ReceivedMessage{MessageID: "bad-json", DeliveryCount: 1}
+
+	c.settleFailed(msg, channel.Permanent(errors.New("invalid character")))
+
+	if reason := r.deadLetters["bad-json"]; reason != ReasonPermanentFailure {
+		t.Errorf("Expected dead-letter reason %s, got: %q", ReasonPermanentFailure, reason)
+	}
+	if len(r.abandoned) != 0 {
+		t.Errorf("Expected no abandons, got: %v", r.abandoned)
+	}
+}
+
+// TestSettleFailed_TransientAbandons tests that transient errors are abandoned while attempts remain
+func TestSettleFailed_TransientAbandons(t *testing.T) {
+	r := &fakeReceiver{}
+	c := New(r, nil, Options{MaxDeliveryAttempts: 5})
+	msg := &azservicebus.ReceivedMessage{MessageID: "smtp-timeout", DeliveryCount: 4}
+
+	c.settleFailed(msg, errors.New("i/o timeout"))
+
+	if len(r.abandoned) != 1 || r.abandoned[0] != "smtp-timeout" {
+		t.Errorf("Expected message to be abandoned, got: %v", r.abandoned)
+	}
+	if len(r.deadLetters) != 0 {
+		t.Errorf("Expected no dead-letters, got: %v", r.deadLetters)
+	}
+}
+
+// TestSettleFailed_TransientExhausted tests that transient errors are dead-lettered after the last attempt
+func TestSettleFailed_TransientExhausted(t *testing.T) {
+	r := &fakeReceiver{}
+	c := New(r, nil, Options{MaxDeliveryAttempts: 5})
+	msg := &azservicebus.ReceivedMessage{MessageID: "acs-503", DeliveryCount: 5}
+
+	c.settleFailed(msg, errors.New("503 service unavailable"))
+
+	if reason := r.deadLetters["acs-503"]; reason != ReasonMaxDeliveryAttempts {
+		t.Errorf("Expected dead-letter reason %s, got: %q", ReasonMaxDeliveryAttempts, reason)
+	}
+}
+
+// TestTruncate tests that long error descriptions are shortened
+func TestTruncate(t *testing.T) {
+	long := strings.Repeat("x", maxDescriptionLength+10)
+	if got := truncate(long); len(got) != maxDescriptionLength {
+		t.Errorf("Expected length %d, got: %d", maxDescriptionLength, len(got))
+	}
+	if got := truncate("short"); got != "short" {
+		t.Errorf("Expected 'short', got: %s", got)
+	}
+
+	// "€" is three bytes, so the limit falls inside one.
+	euros := strings.Repeat("€", maxDescriptionLength/3+1)
+	if got := truncate(euros); !utf8.ValidString(got) || len(got) > maxDescriptionLength || len(got) < maxDescriptionLength-2 {
+		t.Errorf("Expected valid UTF-8 within %d bytes, got %d bytes", maxDescriptionLength, len(got))
+	}
+}
+
+type fakeSender struct {
+	sent []*azservicebus.Message
+}
+
+func (s *fakeSender) SendMessage(ctx context.Context, message *azservicebus.Message, options *azservicebus.SendMessageOptions) error {
+	s.sent = append(s.sent, message)
+	return nil
+}
+
+// TestSettleFailed_DeferredReschedules tests that deferred errors reschedule the message and complete the original
+func TestSettleFailed_DeferredReschedules(t *testing.T) {
+	r := &fakeReceiver{}
+	s := &fakeSender{}
+	c := New(r, nil, Options{MaxDeliveryAttempts: 5, Reschedule: RescheduleWith(s)})
+	msg := &azservicebus.ReceivedMessage{MessageID: "breaker-open", DeliveryCount: 5, Body: []byte(`{}`)}
+	until := time.Now().Add(30 * time.Second)
+
+	c.settleFailed(msg, channel.Deferred(errors.New("circuit breaker email is open"), until))
+
+	if len(s.sent) != 1 {
+		t.Fatalf("Expected 1 rescheduled copy, got: %d", len(s.sent))
+	}
+	scheduled := s.sent[0]
+	if scheduled.ScheduledEnqueueTime == nil || !scheduled.ScheduledEnqueueTime.Equal(until) {
+		t.Errorf("Expected scheduled time %s, got: %v", until, scheduled.ScheduledEnqueueTime)
+	}
+	if scheduled.ApplicationProperties["originalMessageId"] != "breaker-open" || scheduled.ApplicationProperties["rescheduleCount"] != int64(1) {
+		t.Errorf("Unexpected properties: %v", scheduled.ApplicationProperties)
+	}
+	if len(r.completed) != 1 || len(r.abandoned) != 0 || len(r.deadLetters) != 0 {
+		t.Errorf("Expected only a completion, got completed=%v abandoned=%v deadLetters=%v", r.completed, r.abandoned, r.deadLetters)
+	}
+}
+
+// TestSettleFailed_DeferredRescheduleLimit tests that a message rescheduled MaxReschedules times is abandoned instead
+func TestSettleFailed_DeferredRescheduleLimit(t *testing.T) {
+	r := &fakeReceiver{}
+	s := &fakeSender{}
+	c := New(r, nil, Options{MaxDeliveryAttempts: 5, MaxReschedules: 3, Reschedule: RescheduleWith(s)})
+	msg := &azservicebus.ReceivedMessage{
+		MessageID:             "breaker-open",
+		DeliveryCount:         1,
+		ApplicationProperties: map[string]any{"rescheduleCount": int64(3)},
+	}
+
+	c.settleFailed(msg, channel.Deferred(errors.New("circuit breaker email is open"), time.Now().Add(time.Minute)))
+
+	if len(s.sent) != 0 {
+		t.Errorf("Expected no rescheduled copy, got: %d", len(s.sent))
+	}
+	if len(r.abandoned) != 1 {
+		t.Errorf("Expected the message to be abandoned, got: %v", r.abandoned)
+	}
+
+	msg.DeliveryCount = 5
+	c.settleFailed(msg, channel.Deferred(errors.New("circuit breaker email is open"), time.Now().Add(time.Minute)))
+	if reason := r.deadLetters["breaker-open"]; reason != ReasonMaxDeliveryAttempts {
+		t.Errorf("Expected dead-letter reason %s, got: %q", ReasonMaxDeliveryAttempts, reason)
+	}
+}
+
+// TestSettleFailed_DeferredWithoutReschedule tests that deferred errors are abandoned when rescheduling is not configured
+func TestSettleFailed_DeferredWithoutReschedule(t *testing.T) {
+	r := &fakeReceiver{}
+	c := New(r, nil, Options{MaxDeliveryAttempts: 5})
+	msg := &azservicebus.ReceivedMessage{MessageID: "breaker-open", DeliveryCount: 1}
+
+	c.settleFailed(msg, channel.Deferred(errors.New("open"), time.Now()))
+
+	if len(r.abandoned) != 1 {
+		t.Errorf("Expected message to be abandoned, got: %v", r.abandoned)
+	}
+}
@@ -0,0 +1,91 @@
+// Package correlation ties replies to interactive messages back to the
+// notification that asked the question.
+package correlation
+
+import (
+	"boh/notification-service/webhook"
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Record links a provider message id to the notification it delivered.
+type Record struct {
+	MessageID      string    `json:"messageId"`
+	NotificationID string    `json:"notificationId"`
+	UserID         string    `json:"userId"`
+	Channel        string    `json:"channel"`
+	Contact        string    `json:"contact"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+// Store keeps records until the reply arrives.
+type Store interface {
+	// Put stores rec under rec.MessageID.
+	Put(ctx context.Context, rec Record) error
+	// Get returns the record for messageID and whether it exists.
+	Get(ctx context.Context, messageID string) (Record, bool, error)
+}
+
+// Answer is published when a user presses a reply button.
+type Answer struct {
+	NotificationID string    `json:"notificationId"`
+	UserID         string    `json:"userId"`
+	Channel        string    `json:"channel"`
+	Contact        string    `json:"contact"`
+	MessageID      string    `json:"messageId"`
+	ReplyID        string    `json:"replyMessageId,omitempty"`
+	Answer         string    `json:"answer"`
+	AnsweredAt     time.Time `json:"answeredAt"`
+}
+
+// Publisher is satisfied by *publisher.Publisher.
+type Publisher interface {
+	Publish(ctx context.Context, v any, correlationID string) error
+}
+
+// ReplyHandler publishes the answer to every reply that pressed a button on
+// a correlated message. Its HandleMessage is a webhook.MessageFunc.
+type ReplyHandler struct {
+	store     Store
+	publisher Publisher
+}
+
+func NewReplyHandler(store Store, publisher Publisher) *ReplyHandler {
+	return &ReplyHandler{store: store, publisher: publisher}
+}
+
+// HandleMessage ignores messages that are not a button reply to a message
+// in the store. Publishing errors are returned so the provider retries the
+// callback.
+func (h *ReplyHandler) HandleMessage(ctx context.Context, m webhook.InboundMessage) error {
+	if m.ReplyTo == "" || m.ButtonPayload == "" {
+		return nil
+	}
+
+	rec, ok, err := h.store.Get(ctx, m.ReplyTo)
+	if err != nil {
+		return fmt.Errorf("look up message %s: %w", m.ReplyTo, err)
+	}
+	if !ok {
+		log.Printf("Ignoring reply %q to unknown message %s", m.ButtonPayload, m.ReplyTo)
+		return nil
+	}
+
+	answer := Answer{
+		NotificationID: rec.NotificationID,
+		UserID:         rec.UserID,
+		Channel:        rec.Channel,
+		Contact:        rec.Contact,
+		MessageID:      rec.MessageID,
+		ReplyID:        m.MessageID,
+		Answer:         m.ButtonPayload,
+		AnsweredAt:     m.ReceivedAt,
+	}
+	if err := h.publisher.Publish(ctx, answer, rec.NotificationID); err != nil {
+		return fmt.Errorf("publish answer to %s: %w", m.ReplyTo, err)
+	}
+	log.Printf("Published answer %q for notification %q", answer.Answer, answer.NotificationID)
+	return nil
+}
@@ -0,0 +1,115 @@
+package correlation
+
+import (
+	"boh/notification-service/webhook"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type fakePublisher struct {
+	events         []any
+	correlationIDs []string
+	err            error
+}
+
+func (p *fakePublisher) Publish(ctx context.Context, v any, correlationID string) error {
+	p.events = append(p.events, v)
+	p.correlationIDs = append(p.correlationIDs, correlationID)
+	return p.err
+}
+
+// TestMemoryStore_Expiry tests that records are forgotten after the TTL
+func TestMemoryStore_Expiry(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+	s := NewMemoryStore(time.Hour)
+	s.now = func() time.Time { return now }
+
+	s.Put(ctx, Record{MessageID: "m1", NotificationID: "n1", CreatedAt: now})
+	if _, ok, _ := s.Get(ctx, "m1"); !ok {
+		t.Fatal("Expected record before the TTL")
+	}
+
+	now = now.Add(2 * time.Hour)
+	if _, ok, _ := s.Get(ctx, "m1"); ok {
+		t.Error("Expected record to expire after the TTL")
+	}
+	s.Put(ctx, Record{MessageID: "m2", CreatedAt: now})
+	if len(s.records) != 1 {
+		t.Errorf("Expected expired records to be dropped, have %d", len(s.records))
+	}
+}
+
+// TestMemoryStore_SweepInterval tests that Put only sweeps for expired records once per interval
+func TestMemoryStore_SweepInterval(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+	s := NewMemoryStore(time.Second)
+	s.now = func() time.Time { return now }
+
+	s.Put(ctx, Record{MessageID: "m1", CreatedAt: now})
+	now = now.Add(2 * time.Second)
+	s.Put(ctx, Record{MessageID: "m2", CreatedAt: now})
+	if len(s.records) != 2 {
+		t.Errorf("Expected no sweep within the interval, have %d records", len(s.records))
+	}
+
+	now = now.Add(sweepInterval)
+	s.Put(ctx, Record{MessageID: "m3", CreatedAt: now})
+	if len(s.records) != 1 {
+		t.Errorf("Expected the sweep to drop expired records, have %d", len(s.records))
+	}
+}
+
+// TestReplyHandler_PublishesAnswer tests that a button reply to a stored message is published with its notification
+func TestReplyHandler_PublishesAnswer(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(0)
+	store.Put(ctx, Record{MessageID: "wamid.1", NotificationID: "n1", UserID: "u1", Channel: "whatsapp", Contact: "+15551234567"})
+	pub := &fakePublisher{}
+	h := NewReplyHandler(store, pub)
+
+	at := time.Unix(1700000100, 0)
+	err := h.HandleMessage(ctx, webhook.InboundMessage{MessageID: "wamid.in", ReplyTo: "wamid.1", ButtonPayload: "block", ReceivedAt: at})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	want := Answer{NotificationID: "n1", UserID: "u1", Channel: "whatsapp", Contact: "+15551234567", MessageID: "wamid.1", ReplyID: "wamid.in", Answer: "block", AnsweredAt: at}
+	if len(pub.events) != 1 || pub.events[0] != want || pub.correlationIDs[0] != "n1" {
+		t.Errorf("Unexpected publish: %+v %v", pub.events, pub.correlationIDs)
+	}
+}
+
+// TestReplyHandler_Ignores tests that free text and replies to unknown messages are not published
+func TestReplyHandler_Ignores(t *testing.T) {
+	pub := &fakePublisher{}
+	h := NewReplyHandler(NewMemoryStore(0), pub)
+
+	for _, m := range []webhook.InboundMessage{
+		{Content: "hello"},
+		{ReplyTo: "wamid.1", Content: "hello"},
+		{ReplyTo: "unknown", ButtonPayload: "block"},
+	} {
+		if err := h.HandleMessage(context.Background(), m); err != nil {
+			t.Errorf("Expected no error for %+v, got %v", m, err)
+		}
+	}
+	if len(pub.events) != 0 {
+		t.Errorf("Expected nothing published, got %+v", pub.events)
+	}
+}
+
+// TestReplyHandler_PublishError tests that publish failures are returned so the callback is retried
+func TestReplyHandler_PublishError(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(0)
+	store.Put(ctx, Record{MessageID: "wamid.1", NotificationID: "n1"})
+	h := NewReplyHandler(store, &fakePublisher{err: errors.New("queue unavailable")})
+
+	if err := h.HandleMessage(ctx, webhook.InboundMessage{ReplyTo: "wamid.1", ButtonPayload: "confirm"}); err == nil {
+		t.Error("Expected the publish error")
+	}
+}
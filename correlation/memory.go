@@ -0,0 +1,70 @@
+package correlation
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultTTL is how long the memory store keeps a record. Replies to a
+// question older than that are no longer matched to their notification.
+const DefaultTTL = 7 * 24 * time.Hour
+
+// sweepInterval is the least time between two sweeps for expired records,
+// so a Put only pays for a full pass now and then.
+const sweepInterval = time.Minute
+
+// MemoryStore keeps records in process memory for ttl. Replies are only
+// matched when the webhook lands on the replica that sent the message.
+type MemoryStore struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu        sync.Mutex
+	records   map[string]Record
+	lastSweep time.Time
+}
+
+func NewMemoryStore(ttl time.Duration) *MemoryStore {
+	return &MemoryStore{ttl: ttl, now: time.Now, records: make(map[string]Record)}
+}
+
+func (s *MemoryStore) Put(ctx context.Context, rec Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep()
+	s.records[rec.MessageID] = rec
+	return nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, messageID string) (Record, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, ok := s.records[messageID]
+	if !ok || s.expired(rec) {
+		return Record{}, false, nil
+	}
+	return rec, true, nil
+}
+
+// sweep drops expired records so the map does not grow without bound. It
+// runs at most once per sweepInterval; Get ignores what it has not dropped
+// yet.
+func (s *MemoryStore) sweep() {
+	now := s.now()
+	if s.ttl <= 0 || now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for id, rec := range s.records {
+		if s.expired(rec) {
+			delete(s.records, id)
+		}
+	}
+}
+
+func (s *MemoryStore) expired(rec Record) bool {
+	return s.ttl > 0 && s.now().Sub(rec.CreatedAt) > s.ttl
+}
@@ -0,0 +1,69 @@
+package correlation
+
+import (
+	"boh/notification-service/sqlbind"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// SQLStore keeps records in a SQL table so every replica can match replies.
+// The table is expected to look like:
+//
+//	CREATE TABLE notification_correlations (
+//	    message_id      VARCHAR(256) NOT NULL PRIMARY KEY,
+//	    notification_id VARCHAR(128) NOT NULL,
+//	    user_id         VARCHAR(128) NOT NULL,
+//	    channel         VARCHAR(32)  NOT NULL,
+//	    contact         VARCHAR(320) NOT NULL,
+//	    created_at      TIMESTAMP    NOT NULL
+//	);
+//
+// The database driver must be linked into the binary by the caller.
+type SQLStore struct {
+	db    *sql.DB
+	table string
+	// numbered selects $1-style placeholders (PostgreSQL) instead of ?.
+	numbered bool
+}
+
+func NewSQLStore(db *sql.DB, table string, numberedPlaceholders bool) *SQLStore {
+	if table == "" {
+		table = "notification_correlations"
+	}
+	return &SQLStore{db: db, table: table, numbered: numberedPlaceholders}
+}
+
+// bind adapts query to the driver's placeholders.
+func (s *SQLStore) bind(query string) string {
+	return sqlbind.Bind(query, s.numbered)
+}
+
+// Put inserts rec. Message ids are unique, so a record is never replaced.
+func (s *SQLStore) Put(ctx context.Context, rec Record) error {
+	insert := s.bind("INSERT INTO " + s.table +
+		" (message_id, notification_id, user_id, channel, contact, created_at) VALUES (?, ?, ?, ?, ?, ?)")
+	_, err := s.db.ExecContext(ctx, insert, rec.MessageID, rec.NotificationID, rec.UserID,
+		rec.Channel, rec.Contact, rec.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("insert correlation %s: %w", rec.MessageID, err)
+	}
+	return nil
+}
+
+func (s *SQLStore) Get(ctx context.Context, messageID string) (Record, bool, error) {
+	query := s.bind("SELECT notification_id, user_id, channel, contact, created_at FROM " + s.table +
+		" WHERE message_id = ?")
+
+	rec := Record{MessageID: messageID}
+	err := s.db.QueryRowContext(ctx, query, messageID).
+		Scan(&rec.NotificationID, &rec.UserID, &rec.Channel, &rec.Contact, &rec.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Record{}, false, nil
+	}
+	if err != nil {
+		return Record{}, false, fmt.Errorf("get correlation %s: %w", messageID, err)
+	}
+	return rec, true, nil
+}
@@ -0,0 +1,105 @@
+package delivery
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// Status values recorded for a delivery.
+const (
+	StatusSent = "sent"
+	// Provider callbacks move a sent record on to one of these.
+	StatusDelivered = "delivered"
+	StatusRead      = "read"
+	StatusFailed    = "failed"
+)
+
+// Key identifies one delivery of a notification to a contact on a channel.
+type Key struct {
+	NotificationID string `json:"notificationId"`
+	Channel        string `json:"channel"`
+	Contact        string `json:"contact"`
+}
+
+// NewKey normalises the channel name so "EMAIL" and "email" share records.
+func NewKey(notificationID, channel, contact string) Key {
+	return Key{
+		NotificationID: notificationID,
+		Channel:        strings.ToLower(channel),
+		Contact:        strings.TrimSpace(contact),
+	}
+}
+
+func (k Key) String() string {
+	return k.NotificationID + "|" + k.Channel + "|" + k.Contact
+}
+
+// Record is the stored state of a delivery.
+type Record struct {
+	Key       Key       `json:"key"`
+	Status    string    `json:"status"`
+	MessageID string    `json:"messageId,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Store persists delivery records so redelivered Service Bus messages can
+// skip channels that were already sent.
+type Store interface {
+	// Get returns the record for key and whether it exists.
+	Get(ctx context.Context, key Key) (Record, bool, error)
+	// Put creates or replaces the record for rec.Key.
+	Put(ctx context.Context, rec Record) error
+	// FindByMessageID returns the record with the given provider message id
+	// and whether it exists.
+	FindByMessageID(ctx context.Context, messageID string) (Record, bool, error)
+}
+
+// IsSent reports whether key has already been handed to its provider. A
+// record that a callback later marked failed still counts: the provider
+// accepted it, and sending again would notify the contact twice if the
+// failure report was wrong.
+func IsSent(ctx context.Context, s Store, key Key) (bool, error) {
+	rec, ok, err := s.Get(ctx, key)
+	if err != nil || !ok {
+		return false, err
+	}
+	_, known := statusOrder[rec.Status]
+	return known, nil
+}
+
+// statusOrder ranks statuses so late or duplicated callbacks never move a
+// record backwards, e.g. "delivered" arriving after "read". Delivered and
+// read deliberately rank above failed: they can only be reported once the
+// contact's device has the message, so a failed reported before them,
+// for instance for a provider-side retry, is overruled, while a failed
+// arriving after them is ignored.
+var statusOrder = map[string]int{
+	StatusSent:      1,
+	StatusFailed:    2,
+	StatusDelivered: 3,
+	StatusRead:      4,
+}
+
+// UpdateStatus moves the record for messageID on to status. It returns the
+// record and whether it changed; unknown message ids and updates that would
+// go backwards are ignored.
+func UpdateStatus(ctx context.Context, s Store, messageID, status string, at time.Time) (Record, bool, error) {
+	if messageID == "" {
+		return Record{}, false, nil
+	}
+	rec, ok, err := s.FindByMessageID(ctx, messageID)
+	if err != nil || !ok {
+		return rec, false, err
+	}
+	if statusOrder[status] <= statusOrder[rec.Status] {
+		return rec, false, nil
+	}
+
+	rec.Status = status
+	rec.UpdatedAt = at.UTC()
+	if err := s.Put(ctx, rec); err != nil {
+		return rec, false, err
+	}
+	return rec, true, nil
+}
@@ -0,0 +1,221 @@
+package delivery
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestNewKey_NormalisesChannel tests that channel names are case-insensitive in keys
+func TestNewKey_NormalisesChannel(t *testing.T) {
+	a := NewKey("n1", "EMAIL", " user@example.com ")
+	b := NewKey("n1", "email", "user@example.com")
+	if a != b {
+		t.Errorf("Expected keys to match, got %v and %v", a, b)
+	}
+}
+
+// TestMemoryStore_PutGet tests storing and reading a record in memory
+func TestMemoryStore_PutGet(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore(DefaultTTL)
+	key := NewKey("n1", "email", "user@example.com")
+
+	if sent, err := IsSent(ctx, s, key); err != nil || sent {
+		t.Fatalf("Expected unsent key, got sent=%v err=%v", sent, err)
+	}
+
+	if err := s.Put(ctx, Record{Key: key, Status: StatusSent, MessageID: "m1"}); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	if sent, err := IsSent(ctx, s, key); err != nil || !sent {
+		t.Errorf("Expected sent key, got sent=%v err=%v", sent, err)
+	}
+	if sent, _ := IsSent(ctx, s, NewKey("n1", "whatsapp", "user@example.com")); sent {
+		t.Error("Expected other channel to be unsent")
+	}
+}
+
+// TestFileStore_Reopen tests that records survive closing and reopening the file
+func TestFileStore_Reopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "deliveries.jsonl")
+	key := NewKey("n1", "whatsapp", "+1234567890")
+
+	s, err := OpenFileStore(path, DefaultTTL)
+	if err != nil {
+		t.Fatalf("OpenFileStore failed: %v", err)
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	if err := s.Put(ctx, Record{Key: key, Status: StatusSent, MessageID: "m1", UpdatedAt: now}); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	s.Close()
+
+	s, err = OpenFileStore(path, DefaultTTL)
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	defer s.Close()
+
+	rec, ok, err := s.Get(ctx, key)
+	if err != nil || !ok {
+		t.Fatalf("Expected record after reopen, got ok=%v err=%v", ok, err)
+	}
+	if rec.MessageID != "m1" || rec.Status != StatusSent || !rec.UpdatedAt.Equal(now) {
+		t.Errorf("Unexpected record: %+v", rec)
+	}
+	if rec, ok, _ := s.FindByMessageID(ctx, "m1"); !ok || rec.Key != key {
+		t.Errorf("Expected record by message id after reopen, got %+v ok=%v", rec, ok)
+	}
+}
+
+// TestFileStore_IncompleteLastLine tests that a record cut short by a crash is dropped instead of failing the open
+func TestFileStore_IncompleteLastLine(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "deliveries.jsonl")
+	good := `{"key":{"notificationId":"n1","channel":"email","contact":"a@example.com"},"status":"sent"}` + "\n"
+	os.WriteFile(path, []byte(good+`{"key":{"notificationId":"n2","chan`), 0o600)
+
+	s, err := OpenFileStore(path, DefaultTTL)
+	if err != nil {
+		t.Fatalf("OpenFileStore failed: %v", err)
+	}
+	if sent, _ := IsSent(ctx, s, NewKey("n1", "email", "a@example.com")); !sent {
+		t.Error("Expected the complete record to be loaded")
+	}
+	if err := s.Put(ctx, Record{Key: NewKey("n3", "email", "a@example.com"), Status: StatusSent}); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	s.Close()
+
+	data, _ := os.ReadFile(path)
+	if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != 2 || strings.Contains(string(data), `"n2"`) {
+		t.Errorf("Expected the partial line to be replaced, got %q", data)
+	}
+	if s, err = OpenFileStore(path, DefaultTTL); err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	s.Close()
+
+	os.WriteFile(path, []byte("not json\n"+good), 0o600)
+	if _, err := OpenFileStore(path, DefaultTTL); err == nil {
+		t.Error("Expected a corrupt complete line to fail the open")
+	}
+}
+
+// TestIsSent_KnownStatuses tests that only recorded delivery statuses count as sent
+func TestIsSent_KnownStatuses(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore(DefaultTTL)
+	for status, want := range map[string]bool{StatusSent: true, StatusFailed: true, StatusRead: true, "": false, "pending": false} {
+		key := NewKey("n-"+status, "email", "a@example.com")
+		s.Put(ctx, Record{Key: key, Status: status})
+		if sent, _ := IsSent(ctx, s, key); sent != want {
+			t.Errorf("IsSent with status %q: got %v, want %v", status, sent, want)
+		}
+	}
+}
+
+// TestSQLStore_Bind tests placeholder rewriting for numbered-placeholder drivers
+func TestSQLStore_Bind(t *testing.T) {
+	s := NewSQLStore(nil, "", true)
+	got := s.bind("SELECT 1 FROM t WHERE a = ? AND b = ?")
+	if got != "SELECT 1 FROM t WHERE a = $1 AND b = $2" {
+		t.Errorf("Unexpected query: %s", got)
+	}
+
+	s = NewSQLStore(nil, "", false)
+	if got := s.bind("a = ?"); got != "a = ?" {
+		t.Errorf("Expected query unchanged, got: %s", got)
+	}
+}
+
+// TestUpdateStatus tests that status callbacks only move records forward
+func TestUpdateStatus(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore(DefaultTTL)
+	key := NewKey("n1", "whatsapp", "+1234567890")
+	s.Put(ctx, Record{Key: key, Status: StatusSent, MessageID: "m1"})
+
+	steps := []struct {
+		status  string
+		updated bool
+		want    string
+	}{
+		{StatusRead, true, StatusRead},
+		{StatusDelivered, false, StatusRead},
+		{StatusSent, false, StatusRead},
+		{StatusFailed, false, StatusRead},
+	}
+	for _, step := range steps {
+		rec, updated, err := UpdateStatus(ctx, s, "m1", step.status, time.Now())
+		if err != nil || updated != step.updated || rec.Status != step.want {
+			t.Errorf("UpdateStatus(%s): got %s updated=%v err=%v, want %s updated=%v", step.status, rec.Status, updated, err, step.want, step.updated)
+		}
+	}
+
+	if _, updated, err := UpdateStatus(ctx, s, "unknown", StatusRead, time.Now()); err != nil || updated {
+		t.Errorf("Expected unknown message id to be ignored, got updated=%v err=%v", updated, err)
+	}
+	if rec, _, _ := s.Get(ctx, key); rec.Status != StatusRead {
+		t.Errorf("Expected stored status read, got %s", rec.Status)
+	}
+}
+
+// TestMemoryStore_Expiry tests that records are forgotten once they have not been put for the ttl
+func TestMemoryStore_Expiry(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	s := NewMemoryStore(time.Hour)
+	s.index.now = func() time.Time { return now }
+
+	old := NewKey("n1", "email", "a@example.com")
+	s.Put(ctx, Record{Key: old, Status: StatusSent, MessageID: "m1", UpdatedAt: now})
+	now = now.Add(2 * time.Hour)
+	s.Put(ctx, Record{Key: NewKey("n2", "email", "a@example.com"), Status: StatusSent, MessageID: "m2", UpdatedAt: now})
+
+	if _, ok, _ := s.Get(ctx, old); ok {
+		t.Error("Expected the expired record to be gone")
+	}
+	if _, ok, _ := s.FindByMessageID(ctx, "m1"); ok {
+		t.Error("Expected the expired message id to be gone")
+	}
+	if len(s.index.records) != 1 || len(s.index.byMessageID) != 1 {
+		t.Errorf("Expected the sweep to drop the expired record, got %d records and %d message ids", len(s.index.records), len(s.index.byMessageID))
+	}
+}
+
+// TestFileStore_CompactsOnOpen tests that reopening keeps one line per live record
+func TestFileStore_CompactsOnOpen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "deliveries.jsonl")
+	key := NewKey("n1", "whatsapp", "+1234567890")
+
+	s, err := OpenFileStore(path, time.Hour)
+	if err != nil {
+		t.Fatalf("OpenFileStore failed: %v", err)
+	}
+	s.Put(ctx, Record{Key: key, Status: StatusSent, MessageID: "m1", UpdatedAt: time.Now()})
+	UpdateStatus(ctx, s, "m1", StatusDelivered, time.Now())
+	UpdateStatus(ctx, s, "m1", StatusRead, time.Now())
+	s.Put(ctx, Record{Key: NewKey("n0", "email", "a@example.com"), Status: StatusSent, UpdatedAt: time.Now().Add(-2 * time.Hour)})
+	s.Close()
+
+	if s, err = OpenFileStore(path, time.Hour); err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	defer s.Close()
+
+	data, _ := os.ReadFile(path)
+	if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != 1 || !strings.Contains(lines[0], `"read"`) {
+		t.Errorf("Expected only the latest live record, got %q", data)
+	}
+	if rec, ok, _ := s.FindByMessageID(ctx, "m1"); !ok || rec.Status != StatusRead {
+		t.Errorf("Expected the read record after compaction, got %+v ok=%v", rec, ok)
+	}
+}
@@ -0,0 +1,167 @@
+package delivery
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// FileStore keeps records in memory and appends every change to a JSON
+// lines file. On open the file is replayed and rewritten with one line per
+// record still within ttl, so it only grows between restarts. It suits a
+// single replica with a persistent volume.
+type FileStore struct {
+	mu    sync.Mutex
+	path  string
+	file  *os.File
+	index index
+}
+
+// OpenFileStore loads the records in path, creating the file if needed, and
+// compacts it.
+func OpenFileStore(path string, ttl time.Duration) (*FileStore, error) {
+	s := &FileStore{path: path, index: newIndex(ttl)}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load replays the file. A last line without a newline was cut short by a
+// crash during Put: it is dropped when it does not parse, and kept when it
+// does. A complete line that does not parse fails the load.
+func (s *FileStore) load() error {
+	file, err := os.Open(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("open delivery store: %w", err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("read delivery store: %w", err)
+		}
+		complete := err == nil
+
+		if len(bytes.TrimSpace(data)) > 0 {
+			var rec Record
+			if jsonErr := json.Unmarshal(data, &rec); jsonErr == nil {
+				// The file keeps no put time, so the update time stands in
+				// for it; records without one start their ttl now.
+				at := rec.UpdatedAt
+				if at.IsZero() {
+					at = s.index.now()
+				}
+				s.index.addAt(rec, at)
+			} else if complete {
+				return fmt.Errorf("delivery store %s line %d: %w", s.path, line, jsonErr)
+			} else {
+				log.Printf("Warning: delivery store %s ends with an incomplete record on line %d, dropping it", s.path, line)
+			}
+		}
+		if !complete {
+			return nil
+		}
+	}
+}
+
+// compact writes the records still within ttl to a temporary file, which
+// replaces the store's file so a crash leaves one or the other intact, and
+// opens the result for appending.
+func (s *FileStore) compact() error {
+	s.index.prune()
+
+	tmp := s.path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("compact delivery store: %w", err)
+	}
+	w := bufio.NewWriter(file)
+	enc := json.NewEncoder(w)
+	for _, e := range s.index.records {
+		if err = enc.Encode(e.rec); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, s.path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("compact delivery store: %w", err)
+	}
+
+	s.file, err = os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("open delivery store: %w", err)
+	}
+	return nil
+}
+
+func (s *FileStore) Get(ctx context.Context, key Key) (Record, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.index.get(key)
+	return rec, ok, nil
+}
+
+// Put appends rec to the file. Expired records leave memory as records are
+// put, and the file on the next open.
+func (s *FileStore) Put(ctx context.Context, rec Record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.file.Write(data); err != nil {
+		return fmt.Errorf("write delivery store: %w", err)
+	}
+	if err := s.file.Sync(); err != nil {
+		return fmt.Errorf("sync delivery store: %w", err)
+	}
+	s.index.add(rec)
+	return nil
+}
+
+func (s *FileStore) FindByMessageID(ctx context.Context, messageID string) (Record, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.index.find(messageID)
+	return rec, ok, nil
+}
+
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
@@ -0,0 +1,94 @@
+package delivery
+
+import "time"
+
+// DefaultTTL is how long the memory and file stores keep a record after it
+// was last put. It outlasts Service Bus redeliveries and late status
+// callbacks.
+const DefaultTTL = 7 * 24 * time.Hour
+
+// sweepInterval is the least time between two sweeps for expired records,
+// so a Put only pays for a full pass now and then.
+const sweepInterval = time.Minute
+
+// index holds records by key and by provider message id for the memory and
+// file stores, and drops those not put for ttl.
+type index struct {
+	ttl       time.Duration
+	now       func() time.Time
+	lastSweep time.Time
+
+	records map[Key]entry
+	// byMessageID indexes records by provider message id.
+	byMessageID map[string]Key
+}
+
+// entry is a record and when it was put. The time is kept apart from
+// UpdatedAt, which callbacks set to the provider's event time.
+type entry struct {
+	rec Record
+	at  time.Time
+}
+
+func newIndex(ttl time.Duration) index {
+	return index{ttl: ttl, now: time.Now, records: make(map[Key]entry), byMessageID: make(map[string]Key)}
+}
+
+func (x *index) get(key Key) (Record, bool) {
+	e, ok := x.records[key]
+	if !ok || x.expired(e) {
+		return Record{}, false
+	}
+	return e.rec, true
+}
+
+func (x *index) find(messageID string) (Record, bool) {
+	key, ok := x.byMessageID[messageID]
+	if !ok {
+		return Record{}, false
+	}
+	return x.get(key)
+}
+
+func (x *index) add(rec Record) {
+	x.addAt(rec, x.now())
+}
+
+// addAt stores rec as if it was put at the given time, which is how records
+// replayed from a file keep their age.
+func (x *index) addAt(rec Record, at time.Time) {
+	x.sweep()
+	x.records[rec.Key] = entry{rec: rec, at: at}
+	if rec.MessageID != "" {
+		x.byMessageID[rec.MessageID] = rec.Key
+	}
+}
+
+// sweep prunes expired records, at most once per sweepInterval.
+func (x *index) sweep() {
+	now := x.now()
+	if x.ttl <= 0 || now.Sub(x.lastSweep) < sweepInterval {
+		return
+	}
+	x.lastSweep = now
+	x.prune()
+}
+
+// prune drops expired records and message ids that no longer lead to a
+// record.
+func (x *index) prune() {
+	for key, e := range x.records {
+		if x.expired(e) {
+			delete(x.records, key)
+		}
+	}
+	for id, key := range x.byMessageID {
+		if e, ok := x.records[key]; !ok || e.rec.MessageID != id {
+			delete(x.byMessageID, id)
+		}
+	}
+}
+
+func (x *index) expired(e entry) bool {
+	return x.ttl > 0 && x.now().Sub(e.at) > x.ttl
+}
@@ -0,0 +1,39 @@
+package delivery
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps records in process memory for ttl after their last
+// update. It only deduplicates redeliveries that land on the same replica.
+type MemoryStore struct {
+	mu    sync.Mutex
+	index index
+}
+
+func NewMemoryStore(ttl time.Duration) *MemoryStore {
+	return &MemoryStore{index: newIndex(ttl)}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key Key) (Record, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.index.get(key)
+	return rec, ok, nil
+}
+
+func (s *MemoryStore) Put(ctx context.Context, rec Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.index.add(rec)
+	return nil
+}
+
+func (s *MemoryStore) FindByMessageID(ctx context.Context, messageID string) (Record, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.index.find(messageID)
+	return rec, ok, nil
+}
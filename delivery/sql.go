@@ -0,0 +1,99 @@
+package delivery
+
+import (
+	"boh/notification-service/sqlbind"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// SQLStore keeps records in a SQL table so every replica shares them. The
+// table is expected to look like:
+//
+//	CREATE TABLE notification_deliveries (
+//	    notification_id VARCHAR(128) NOT NULL,
+//	    channel         VARCHAR(32)  NOT NULL,
+//	    contact         VARCHAR(320) NOT NULL,
+//	    status          VARCHAR(32)  NOT NULL,
+//	    message_id      VARCHAR(256) NOT NULL,
+//	    updated_at      TIMESTAMP    NOT NULL,
+//	    PRIMARY KEY (notification_id, channel, contact)
+//	);
+//	CREATE INDEX notification_deliveries_message_id ON notification_deliveries (message_id);
+//
+// The database driver must be linked into the binary by the caller.
+type SQLStore struct {
+	db    *sql.DB
+	table string
+	// numbered selects $1-style placeholders (PostgreSQL) instead of ?.
+	numbered bool
+}
+
+func NewSQLStore(db *sql.DB, table string, numberedPlaceholders bool) *SQLStore {
+	if table == "" {
+		table = "notification_deliveries"
+	}
+	return &SQLStore{db: db, table: table, numbered: numberedPlaceholders}
+}
+
+// bind adapts query to the driver's placeholders.
+func (s *SQLStore) bind(query string) string {
+	return sqlbind.Bind(query, s.numbered)
+}
+
+func (s *SQLStore) Get(ctx context.Context, key Key) (Record, bool, error) {
+	query := s.bind("SELECT status, message_id, updated_at FROM " + s.table +
+		" WHERE notification_id = ? AND channel = ? AND contact = ?")
+
+	rec := Record{Key: key}
+	err := s.db.QueryRowContext(ctx, query, key.NotificationID, key.Channel, key.Contact).
+		Scan(&rec.Status, &rec.MessageID, &rec.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Record{}, false, nil
+	}
+	if err != nil {
+		return Record{}, false, fmt.Errorf("get delivery %s: %w", key, err)
+	}
+	return rec, true, nil
+}
+
+func (s *SQLStore) FindByMessageID(ctx context.Context, messageID string) (Record, bool, error) {
+	query := s.bind("SELECT notification_id, channel, contact, status, message_id, updated_at FROM " + s.table +
+		" WHERE message_id = ?")
+
+	var rec Record
+	err := s.db.QueryRowContext(ctx, query, messageID).
+		Scan(&rec.Key.NotificationID, &rec.Key.Channel, &rec.Key.Contact, &rec.Status, &rec.MessageID, &rec.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Record{}, false, nil
+	}
+	if err != nil {
+		return Record{}, false, fmt.Errorf("find delivery for message %s: %w", messageID, err)
+	}
+	return rec, true, nil
+}
+
+// Put updates the existing row and inserts one when none matched, which
+// works on every dialect without relying on UPSERT syntax.
+func (s *SQLStore) Put(ctx context.Context, rec Record) error {
+	update := s.bind("UPDATE " + s.table +
+		" SET status = ?, message_id = ?, updated_at = ? WHERE notification_id = ? AND channel = ? AND contact = ?")
+	res, err := s.db.ExecContext(ctx, update, rec.Status, rec.MessageID, rec.UpdatedAt,
+		rec.Key.NotificationID, rec.Key.Channel, rec.Key.Contact)
+	if err != nil {
+		return fmt.Errorf("update delivery %s: %w", rec.Key, err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n > 0 {
+		return nil
+	}
+
+	insert := s.bind("INSERT INTO " + s.table +
+		" (notification_id, channel, contact, status, message_id, updated_at) VALUES (?, ?, ?, ?, ?, ?)")
+	_, err = s.db.ExecContext(ctx, insert, rec.Key.NotificationID, rec.Key.Channel, rec.Key.Contact,
+		rec.Status, rec.MessageID, rec.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("insert delivery %s: %w", rec.Key, err)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package email
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/mail"
+	"strings"
+)
+
+// ErrHeaderInjection is returned for a header value containing a line
+// break, which would let it add headers of its own.
+var ErrHeaderInjection = errors.New("header value contains a line break")
+
+// checkHeader rejects values that would end the header they are written in.
+func checkHeader(field, value string) error {
+	if strings.ContainsAny(value, "\r\n") {
+		return fmt.Errorf("%s: %w", field, ErrHeaderInjection)
+	}
+	return nil
+}
+
+// parseAddresses parses every entry of list, each of which may itself be a
+// comma separated list such as "Alice <alice@example.com>, bob@example.com".
+func parseAddresses(field string, list []string) ([]*mail.Address, error) {
+	var addrs []*mail.Address
+	for _, entry := range list {
+		if err := checkHeader(field, entry); err != nil {
+			return nil, err
+		}
+		parsed, err := mail.ParseAddressList(entry)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid address %q: %w", field, entry, err)
+		}
+		addrs = append(addrs, parsed...)
+	}
+	return addrs, nil
+}
+
+// formatAddresses writes addrs as a header value, one address per folded
+// line. Display names that are not plain ASCII are RFC 2047 encoded.
+func formatAddresses(addrs []*mail.Address) string {
+	formatted := make([]string, len(addrs))
+	for i, a := range addrs {
+		formatted[i] = a.String()
+	}
+	return strings.Join(formatted, ",\r\n ")
+}
+
+// Validate parses the sender and recipients and checks every value that is
+// written into a header, so a contact or subject cannot inject headers.
+func (m *Message) Validate() error {
+	_, err := m.addresses()
+	return err
+}
+
+// addresses is the parsed form of a message's address fields.
+type addresses struct {
+	from                 *mail.Address
+	to, cc, bcc, replyTo []*mail.Address
+}
+
+func (m *Message) addresses() (addresses, error) {
+	var a addresses
+	if err := checkHeader("From", m.From); err != nil {
+		return a, err
+	}
+	from, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return a, fmt.Errorf("From: invalid address %q: %w", m.From, err)
+	}
+	a.from = from
+
+	for _, f := range []struct {
+		field string
+		list  []string
+		dst   *[]*mail.Address
+	}{
+		{"To", m.To, &a.to},
+		{"Cc", m.Cc, &a.cc},
+		{"Bcc", m.Bcc, &a.bcc},
+		{"Reply-To", m.ReplyTo, &a.replyTo},
+	} {
+		if *f.dst, err = parseAddresses(f.field, f.list); err != nil {
+			return a, err
+		}
+	}
+	if len(a.to)+len(a.cc)+len(a.bcc) == 0 {
+		return a, errors.New("email has no recipients")
+	}
+
+	if err := checkHeader("Subject", m.Subject); err != nil {
+		return a, err
+	}
+	if err := checkHeader("Message-ID", m.MessageID); err != nil {
+		return a, err
+	}
+	for _, att := range m.Attachments {
+		if err := checkHeader("Content-ID", att.ContentID); err != nil {
+			return a, err
+		}
+		if strings.ContainsAny(att.ContentID, "<>") {
+			return a, fmt.Errorf("Content-ID %q must not contain angle brackets", att.ContentID)
+		}
+		if att.ContentType != "" {
+			if _, _, err := mime.ParseMediaType(att.ContentType); err != nil {
+				return a, fmt.Errorf("attachment %q: invalid content type %q: %w", att.FileName, att.ContentType, err)
+			}
+		}
+	}
+	return a, nil
+}
+
+// Sender returns the bare address of From, for the SMTP envelope.
+func (m *Message) Sender() (string, error) {
+	a, err := m.addresses()
+	if err != nil {
+		return "", err
+	}
+	return a.from.Address, nil
+}
+
+// Recipients returns the bare addresses of To, Cc and Bcc without
+// duplicates, for the SMTP envelope. Bcc recipients only appear here.
+func (m *Message) Recipients() ([]string, error) {
+	a, err := m.addresses()
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	var rcpts []string
+	for _, list := range [][]*mail.Address{a.to, a.cc, a.bcc} {
+		for _, addr := range list {
+			key := strings.ToLower(addr.Address)
+			if !seen[key] {
+				seen[key] = true
+				rcpts = append(rcpts, addr.Address)
+			}
+		}
+	}
+	return rcpts, nil
+}
@@ -0,0 +1,101 @@
+package email
+
+import (
+	"bytes"
+	"errors"
+	"net/mail"
+	"reflect"
+	"testing"
+)
+
+// TestMessage_Addresses tests display names, Cc and Reply-To headers and that Bcc stays out of the headers
+func TestMessage_Addresses(t *testing.T) {
+	m := Message{
+		From:    "Bank of Harnoor <alerts@boh.example>",
+		To:      []string{"Alice <alice@example.com>, bob@example.com"},
+		Cc:      []string{"Søren <soren@example.com>"},
+		Bcc:     []string{"audit@boh.example", "ALICE@example.com"},
+		ReplyTo: []string{"Support <support@boh.example>"},
+		Subject: "Statement",
+		Text:    "Your statement is ready",
+	}
+	raw, err := m.Bytes()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("Expected a parseable message, got %v", err)
+	}
+	to, _ := msg.Header.AddressList("To")
+	if len(to) != 2 || to[0].Name != "Alice" || to[1].Address != "bob@example.com" {
+		t.Errorf("Unexpected To: %v", to)
+	}
+	cc, _ := msg.Header.AddressList("Cc")
+	if len(cc) != 1 || cc[0].Name != "Søren" {
+		t.Errorf("Expected the encoded Cc name to decode, got %v", cc)
+	}
+	if from, _ := msg.Header.AddressList("From"); len(from) != 1 || from[0].Name != "Bank of Harnoor" {
+		t.Errorf("Unexpected From: %v", from)
+	}
+	if got := msg.Header.Get("Reply-To"); got != `"Support" <support@boh.example>` {
+		t.Errorf("Unexpected Reply-To: %q", got)
+	}
+	if msg.Header.Get("Bcc") != "" || bytes.Contains(raw, []byte("audit@boh.example")) {
+		t.Error("Expected Bcc recipients to be left out of the message")
+	}
+
+	sender, _ := m.Sender()
+	recipients, _ := m.Recipients()
+	if sender != "alerts@boh.example" {
+		t.Errorf("Expected the bare sender address, got %q", sender)
+	}
+	want := []string{"alice@example.com", "bob@example.com", "soren@example.com", "audit@boh.example"}
+	if !reflect.DeepEqual(recipients, want) {
+		t.Errorf("Expected recipients %v, got %v", want, recipients)
+	}
+}
+
+// TestMessage_Validate tests that line breaks and invalid addresses are rejected
+func TestMessage_Validate(t *testing.T) {
+	valid := func() Message {
+		return Message{From: "alerts@boh.example", To: []string{"alice@example.com"}, Subject: "Alert"}
+	}
+	tests := []struct {
+		name      string
+		change    func(m *Message)
+		injection bool
+	}{
+		{"Contact with CRLF", func(m *Message) { m.To = []string{"alice@example.com\r\nBcc: victim@example.com"} }, true},
+		{"Subject with LF", func(m *Message) { m.Subject = "Alert\nX-Spam: no" }, true},
+		{"Sender with CR", func(m *Message) { m.From = "alerts@boh.example\rBcc: x@example.com" }, true},
+		{"Content-ID with CRLF", func(m *Message) { m.Attachments = []Attachment{{ContentID: "logo\r\nX: y"}} }, true},
+		{"Invalid recipient", func(m *Message) { m.To = []string{"not an address"} }, false},
+		{"Invalid sender", func(m *Message) { m.From = "" }, false},
+		{"No recipients", func(m *Message) { m.To = nil }, false},
+		{"Invalid content type", func(m *Message) { m.Attachments = []Attachment{{ContentType: "text/plain; x"}} }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := valid()
+			tt.change(&m)
+			err := m.Validate()
+			if err == nil {
+				t.Fatal("Expected an error")
+			}
+			if errors.Is(err, ErrHeaderInjection) != tt.injection {
+				t.Errorf("Expected injection=%v, got %v", tt.injection, err)
+			}
+			if _, err := m.Bytes(); err == nil {
+				t.Error("Expected Bytes to fail too")
+			}
+		})
+	}
+
+	m := valid()
+	if err := m.Validate(); err != nil {
+		t.Errorf("Expected a valid message, got %v", err)
+	}
+}
@@ -0,0 +1,287 @@
+// Package email builds MIME messages for the SMTP providers.
+package email
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Message is one email. HTML and Text are alternatives of the same content;
+// when only one is set the other is derived from it, so every message has
+// both a plain-text and an HTML part.
+//
+// Addresses are parsed with net/mail and may carry a display name, as in
+// "Bank of Harnoor <alerts@boh.example>". Each To, Cc, Bcc and ReplyTo entry
+// may list several addresses separated by commas. Bcc recipients are only
+// added to the envelope, never to the headers.
+type Message struct {
+	From    string
+	To      []string
+	Cc      []string
+	Bcc     []string
+	ReplyTo []string
+	Subject string
+	HTML    string
+	Text    string
+
+	// Attachments with a ContentID are shown inline, referenced from HTML
+	// as "cid:<ContentID>"; the rest are attached as files.
+	Attachments []Attachment
+
+	// Date and MessageID default to now and a random id at From's domain.
+	Date      time.Time
+	MessageID string
+}
+
+// Attachment is a file sent with a message.
+type Attachment struct {
+	FileName    string
+	ContentType string
+	Data        []byte
+	ContentID   string
+}
+
+// Bytes renders m as a MIME message with CRLF line endings, ready to pass
+// to smtp.SendMail with Sender and Recipients. The text and HTML
+// alternatives are wrapped in multipart/related when there are inline
+// attachments and in multipart/mixed when there are attached files. It
+// fails when Validate does.
+func (m *Message) Bytes() ([]byte, error) {
+	addrs, err := m.addresses()
+	if err != nil {
+		return nil, err
+	}
+
+	text, html := m.Text, m.HTML
+	switch {
+	case text == "" && html != "":
+		text = HTMLToText(html)
+	case html == "" && text != "":
+		html = TextToHTML(text)
+	}
+
+	date := m.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+	messageID := m.MessageID
+	if messageID == "" {
+		id, err := NewMessageID(addrs.from.Address)
+		if err != nil {
+			return nil, err
+		}
+		messageID = id
+	}
+
+	// Clients show the last alternative they understand, so HTML goes last.
+	body := multipartEntity("alternative", textEntity("text/plain", text), textEntity("text/html", html))
+	var inline, attached []entity
+	for _, a := range m.Attachments {
+		if a.ContentID != "" {
+			inline = append(inline, attachmentEntity(a))
+		} else {
+			attached = append(attached, attachmentEntity(a))
+		}
+	}
+	if len(inline) > 0 {
+		body = multipartEntity("related", append([]entity{body}, inline...)...)
+	}
+	if len(attached) > 0 {
+		body = multipartEntity("mixed", append([]entity{body}, attached...)...)
+	}
+
+	var buf bytes.Buffer
+	writeHeader(&buf, "From", addrs.from.String())
+	if len(addrs.to) > 0 {
+		writeHeader(&buf, "To", formatAddresses(addrs.to))
+	}
+	if len(addrs.cc) > 0 {
+		writeHeader(&buf, "Cc", formatAddresses(addrs.cc))
+	}
+	if len(addrs.replyTo) > 0 {
+		writeHeader(&buf, "Reply-To", formatAddresses(addrs.replyTo))
+	}
+	writeHeader(&buf, "Subject", EncodeHeader(m.Subject))
+	writeHeader(&buf, "Date", date.Format(time.RFC1123Z))
+	writeHeader(&buf, "Message-ID", messageID)
+	writeHeader(&buf, "MIME-Version", "1.0")
+	for _, key := range sortedKeys(body.header) {
+		writeHeader(&buf, key, body.header.Get(key))
+	}
+	buf.WriteString("\r\n")
+	if err := body.write(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeHeader(buf *bytes.Buffer, key, value string) {
+	buf.WriteString(key)
+	buf.WriteString(": ")
+	buf.WriteString(value)
+	buf.WriteString("\r\n")
+}
+
+func sortedKeys(header textproto.MIMEHeader) []string {
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// entity is one MIME part: its headers and a function writing its body.
+type entity struct {
+	header textproto.MIMEHeader
+	write  func(w io.Writer) error
+}
+
+// multipartEntity returns a multipart/<subtype> entity holding parts.
+func multipartEntity(subtype string, parts ...entity) entity {
+	boundary := multipart.NewWriter(io.Discard).Boundary()
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", mime.FormatMediaType("multipart/"+subtype, map[string]string{"boundary": boundary}))
+	return entity{header: header, write: func(w io.Writer) error {
+		mw := multipart.NewWriter(w)
+		if err := mw.SetBoundary(boundary); err != nil {
+			return err
+		}
+		for _, p := range parts {
+			pw, err := mw.CreatePart(p.header)
+			if err != nil {
+				return err
+			}
+			if err := p.write(pw); err != nil {
+				return err
+			}
+		}
+		return mw.Close()
+	}}
+}
+
+// textEntity returns a UTF-8 text part, quoted-printable unless the text is
+// mostly non-ASCII, where base64 is shorter.
+func textEntity(contentType, content string) entity {
+	content = normalizeNewlines(content)
+	encoding := TransferEncoding(content)
+
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", contentType+"; charset=UTF-8")
+	header.Set("Content-Transfer-Encoding", encoding)
+	return entity{header: header, write: func(w io.Writer) error {
+		if encoding == "base64" {
+			_, err := w.Write(wrapBase64([]byte(content)))
+			return err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(content)); err != nil {
+			return err
+		}
+		return qp.Close()
+	}}
+}
+
+// attachmentEntity returns a base64 part for a, inline when it has a
+// content id.
+func attachmentEntity(a Attachment) entity {
+	contentType := a.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	disposition := "attachment"
+	if a.ContentID != "" {
+		disposition = "inline"
+	}
+
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Transfer-Encoding", "base64")
+	// FormatMediaType returns "" for names it cannot encode.
+	if d := mime.FormatMediaType(disposition, map[string]string{"filename": a.FileName}); a.FileName != "" && d != "" {
+		disposition = d
+	}
+	header.Set("Content-Disposition", disposition)
+	if a.ContentID != "" {
+		header.Set("Content-ID", "<"+a.ContentID+">")
+	}
+	return entity{header: header, write: func(w io.Writer) error {
+		_, err := w.Write(wrapBase64(a.Data))
+		return err
+	}}
+}
+
+// EncodeHeader returns value as RFC 2047 encoded-words if it is not plain
+// ASCII, folded so each encoded-word is on its own line.
+func EncodeHeader(value string) string {
+	encoded := mime.QEncoding.Encode("utf-8", value)
+	return strings.ReplaceAll(encoded, "?= =?", "?=\r\n =?")
+}
+
+// TransferEncoding picks the Content-Transfer-Encoding for content:
+// quoted-printable, or base64 when more than a third of it is non-ASCII.
+func TransferEncoding(content string) string {
+	nonASCII := 0
+	for i := 0; i < len(content); i++ {
+		if content[i] >= 0x80 {
+			nonASCII++
+		}
+	}
+	if nonASCII*3 > len(content) {
+		return "base64"
+	}
+	return "quoted-printable"
+}
+
+// wrapBase64 encodes data as base64 in lines of 76 characters.
+func wrapBase64(data []byte) []byte {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	var buf bytes.Buffer
+	for len(encoded) > 76 {
+		buf.WriteString(encoded[:76])
+		buf.WriteString("\r\n")
+		encoded = encoded[76:]
+	}
+	buf.WriteString(encoded)
+	buf.WriteString("\r\n")
+	return buf.Bytes()
+}
+
+// normalizeNewlines turns bare LF and CR into CRLF.
+func normalizeNewlines(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.ReplaceAll(s, "\r", "\n")
+	return strings.ReplaceAll(s, "\n", "\r\n")
+}
+
+// NewMessageID returns a random Message-ID at the domain of the address
+// from, or at the host name when from has no domain.
+func NewMessageID(from string) (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("generate message id: %w", err)
+	}
+	domain := ""
+	if at := strings.LastIndex(from, "@"); at >= 0 {
+		domain = strings.TrimRight(from[at+1:], "> ")
+	}
+	if domain == "" {
+		domain, _ = os.Hostname()
+	}
+	if domain == "" {
+		domain = "localhost"
+	}
+	return "<" + hex.EncodeToString(b[:]) + "@" + domain + ">", nil
+}
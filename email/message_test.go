@@ -0,0 +1,223 @@
+package email
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readParts parses raw as a message and returns its headers and the decoded
+// body of each part by content type.
+func readParts(t *testing.T, raw []byte) (mail.Header, map[string]string) {
+	t.Helper()
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("Expected a parseable message, got %v", err)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Expected multipart/alternative, got %q (%v)", mediaType, err)
+	}
+
+	parts := map[string]string{}
+	r := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		p, err := r.NextRawPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Expected a valid part, got %v", err)
+		}
+		var body io.Reader = p
+		switch p.Header.Get("Content-Transfer-Encoding") {
+		case "quoted-printable":
+			body = quotedprintable.NewReader(p)
+		case "base64":
+			body = base64Reader(p)
+		}
+		data, _ := io.ReadAll(body)
+		partType, _, _ := mime.ParseMediaType(p.Header.Get("Content-Type"))
+		parts[partType] = string(data)
+	}
+	return msg.Header, parts
+}
+
+// TestMessage_Bytes tests the headers and both alternatives of an HTML message
+func TestMessage_Bytes(t *testing.T) {
+	m := Message{
+		From:    "alerts@boh.example",
+		To:      []string{"alice@example.com"},
+		Subject: "Monthly Statement",
+		HTML:    "<p>Your statement is <b>ready</b></p><p>Thanks &amp; regards</p>",
+		Date:    time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	raw, err := m.Bytes()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	header, parts := readParts(t, raw)
+	if header.Get("MIME-Version") != "1.0" || header.Get("Subject") != "Monthly Statement" {
+		t.Errorf("Unexpected headers: %v", header)
+	}
+	if header.Get("Date") != "Fri, 02 Jan 2026 03:04:05 +0000" {
+		t.Errorf("Unexpected Date: %q", header.Get("Date"))
+	}
+	if id := header.Get("Message-ID"); !strings.HasPrefix(id, "<") || !strings.HasSuffix(id, "@boh.example>") {
+		t.Errorf("Expected a Message-ID at boh.example, got %q", id)
+	}
+	if parts["text/plain"] != "Your statement is ready\r\n\r\nThanks & regards" {
+		t.Errorf("Unexpected text part: %q", parts["text/plain"])
+	}
+	if parts["text/html"] != m.HTML {
+		t.Errorf("Unexpected HTML part: %q", parts["text/html"])
+	}
+	if bytes.Count(raw, []byte("\n")) != bytes.Count(raw, []byte("\r\n")) {
+		t.Error("Expected every line to end in CRLF")
+	}
+}
+
+// TestMessage_BytesText tests that a plain-text body gets an escaped HTML alternative
+func TestMessage_BytesText(t *testing.T) {
+	m := Message{From: "alerts@boh.example", To: []string{"alice@example.com"}, Subject: "Alert", Text: "Debit of $5 <card 1234>\nat Shop"}
+	raw, err := m.Bytes()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	_, parts := readParts(t, raw)
+	if parts["text/plain"] != "Debit of $5 <card 1234>\r\nat Shop" {
+		t.Errorf("Unexpected text part: %q", parts["text/plain"])
+	}
+	if !strings.Contains(parts["text/html"], "Debit of $5 &lt;card 1234&gt;<br>") {
+		t.Errorf("Unexpected HTML part: %q", parts["text/html"])
+	}
+}
+
+// TestMessage_BytesNonASCII tests the encoded subject and base64 bodies of a non-Latin message
+func TestMessage_BytesNonASCII(t *testing.T) {
+	subject := "Выписка по счёту готова"
+	m := Message{From: "alerts@boh.example", To: []string{"a@example.com"}, Subject: subject, Text: "Ваша выписка готова"}
+	raw, err := m.Bytes()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if bytes.Contains(raw[:bytes.Index(raw, []byte("\r\n\r\n"))], []byte("Выписка")) {
+		t.Error("Expected the subject to be encoded")
+	}
+	header, parts := readParts(t, raw)
+	decoded, err := new(mime.WordDecoder).DecodeHeader(header.Get("Subject"))
+	if err != nil || decoded != subject {
+		t.Errorf("Expected subject %q, got %q (%v)", subject, decoded, err)
+	}
+	if parts["text/plain"] != "Ваша выписка готова" {
+		t.Errorf("Unexpected text part: %q", parts["text/plain"])
+	}
+	if !bytes.Contains(raw, []byte("Content-Transfer-Encoding: base64")) {
+		t.Error("Expected mostly non-ASCII parts to be base64 encoded")
+	}
+}
+
+// TestEncodeHeader tests that ASCII values are left alone and long values are folded
+func TestEncodeHeader(t *testing.T) {
+	if got := EncodeHeader("Monthly Statement"); got != "Monthly Statement" {
+		t.Errorf("Expected ASCII unchanged, got %q", got)
+	}
+	got := EncodeHeader(strings.Repeat("é", 60))
+	for _, line := range strings.Split(got, "\r\n") {
+		if len(line) > 78 {
+			t.Errorf("Expected folded lines of at most 78 characters, got %d: %q", len(line), line)
+		}
+	}
+}
+
+func base64Reader(r io.Reader) io.Reader {
+	return base64.NewDecoder(base64.StdEncoding, r)
+}
+
+// TestMessage_BytesAttachments tests that inline images go in multipart/related and files in multipart/mixed
+func TestMessage_BytesAttachments(t *testing.T) {
+	m := Message{
+		From:    "alerts@boh.example",
+		To:      []string{"alice@example.com"},
+		Subject: "Statement",
+		HTML:    `<img src="cid:logo"><p>Your statement is attached</p>`,
+		Attachments: []Attachment{
+			{FileName: "logo.png", ContentType: "image/png", Data: []byte("png"), ContentID: "logo"},
+			{FileName: "statement.pdf", ContentType: "application/pdf", Data: []byte("%PDF-1.7")},
+		},
+	}
+	raw, err := m.Bytes()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("Expected a parseable message, got %v", err)
+	}
+	mixed := readMultipart(t, msg.Header.Get("Content-Type"), msg.Body, "multipart/mixed")
+	if len(mixed) != 2 {
+		t.Fatalf("Expected the body and one file, got %d parts", len(mixed))
+	}
+	if got := mixed[1].header.Get("Content-Disposition"); got != `attachment; filename=statement.pdf` {
+		t.Errorf("Unexpected file disposition %q", got)
+	}
+	if string(mixed[1].data) != "%PDF-1.7" {
+		t.Errorf("Unexpected file content %q", mixed[1].data)
+	}
+
+	related := readMultipart(t, mixed[0].header.Get("Content-Type"), bytes.NewReader(mixed[0].data), "multipart/related")
+	if len(related) != 2 {
+		t.Fatalf("Expected the alternatives and one inline image, got %d parts", len(related))
+	}
+	if related[1].header.Get("Content-ID") != "<logo>" || !strings.HasPrefix(related[1].header.Get("Content-Disposition"), "inline") {
+		t.Errorf("Unexpected inline image headers %v", related[1].header)
+	}
+	alternative := readMultipart(t, related[0].header.Get("Content-Type"), bytes.NewReader(related[0].data), "multipart/alternative")
+	if len(alternative) != 2 {
+		t.Errorf("Expected text and HTML alternatives, got %d parts", len(alternative))
+	}
+}
+
+type rawPart struct {
+	header textproto.MIMEHeader
+	data   []byte
+}
+
+// readMultipart reads the parts of a body of the given multipart type,
+// decoding base64 parts.
+func readMultipart(t *testing.T, contentType string, body io.Reader, want string) []rawPart {
+	t.Helper()
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != want {
+		t.Fatalf("Expected %s, got %q (%v)", want, mediaType, err)
+	}
+	var parts []rawPart
+	r := multipart.NewReader(body, params["boundary"])
+	for {
+		p, err := r.NextRawPart()
+		if err == io.EOF {
+			return parts
+		}
+		if err != nil {
+			t.Fatalf("Expected a valid part, got %v", err)
+		}
+		var src io.Reader = p
+		if p.Header.Get("Content-Transfer-Encoding") == "base64" {
+			src = base64Reader(p)
+		}
+		data, _ := io.ReadAll(src)
+		parts = append(parts, rawPart{header: p.Header, data: data})
+	}
+}
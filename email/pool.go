@@ -0,0 +1,127 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"time"
+)
+
+// session is an open, authenticated SMTP connection.
+type session struct {
+	conn      net.Conn
+	client    *smtp.Client
+	sent      int
+	idleSince time.Time
+}
+
+// get returns an idle session, or a new one when none is idle and fewer
+// than MaxConnections are open, waiting for either otherwise. reused
+// reports whether the session has sent messages before.
+func (t *Transport) get(ctx context.Context) (s *session, reused bool, err error) {
+	for {
+		select {
+		case s := <-t.idle:
+			if t.fresh(s) {
+				return s, true, nil
+			}
+			t.discard(s)
+			continue
+		default:
+		}
+
+		select {
+		case s := <-t.idle:
+			if t.fresh(s) {
+				return s, true, nil
+			}
+			t.discard(s)
+		case t.slots <- struct{}{}:
+			s, err := t.open(ctx)
+			if err != nil {
+				<-t.slots
+				return nil, false, err
+			}
+			return s, false, nil
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		}
+	}
+}
+
+// fresh reports whether s has been idle for less than IdleTimeout.
+func (t *Transport) fresh(s *session) bool {
+	return time.Since(s.idleSince) < t.cfg.IdleTimeout
+}
+
+// release returns s to the pool after a send, unless the send broke the
+// connection or s has sent MaxMessagesPerConnection messages. A rejected
+// sender or recipient leaves the session usable; the next send resets it.
+func (t *Transport) release(s *session, err error, interrupted bool) {
+	var reply *textproto.Error
+	switch {
+	case interrupted:
+		t.discard(s)
+		return
+	case err == nil:
+		s.sent++
+	case !errors.As(err, &reply) || reply.Code == 421:
+		t.discard(s)
+		return
+	}
+
+	if s.sent >= t.cfg.MaxMessagesPerConnection {
+		t.quit(s)
+		return
+	}
+
+	t.mu.Lock()
+	if !t.closed {
+		s.idleSince = time.Now()
+		t.idle <- s
+		t.mu.Unlock()
+		return
+	}
+	t.mu.Unlock()
+	t.quit(s)
+}
+
+// quit ends s politely and frees its slot.
+func (t *Transport) quit(s *session) {
+	t.extend(context.Background(), s.conn)
+	if err := s.client.Quit(); err != nil {
+		s.client.Close()
+	}
+	<-t.slots
+}
+
+// discard drops s without a QUIT, for sessions that are broken or stale.
+func (t *Transport) discard(s *session) {
+	s.client.Close()
+	<-t.slots
+}
+
+// Close ends the idle sessions. Sessions in use are ended when their send
+// finishes, and later sends open sessions that are not kept.
+func (t *Transport) Close(ctx context.Context) error {
+	t.mu.Lock()
+	t.closed = true
+	t.mu.Unlock()
+
+	for {
+		select {
+		case s := <-t.idle:
+			if deadline, ok := ctx.Deadline(); ok {
+				s.conn.SetDeadline(deadline)
+			}
+			if err := s.client.Quit(); err != nil {
+				s.client.Close()
+			}
+			<-t.slots
+		default:
+			return nil
+		}
+	}
+}
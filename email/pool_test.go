@@ -0,0 +1,129 @@
+package email
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func sendN(t *testing.T, tr *Transport, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if err := tr.Send(context.Background(), "a@boh.example", []string{"b@example.com"}, []byte("hello\r\n")); err != nil {
+			t.Fatalf("Send %d: expected no error, got %v", i+1, err)
+		}
+	}
+}
+
+// TestTransport_ReusesSession tests that consecutive messages share one session with RSET between them
+func TestTransport_ReusesSession(t *testing.T) {
+	f := newFakeSMTP(t, nil)
+	tr, _ := NewTransport(f.config())
+
+	sendN(t, tr, 3)
+
+	mails, sessions, _, rsets, _ := f.stats()
+	if mails != 3 || sessions != 1 || rsets != 2 {
+		t.Errorf("Expected 3 mails on 1 session with 2 RSETs, got %d mails, %d sessions, %d RSETs", mails, sessions, rsets)
+	}
+}
+
+// TestTransport_ReplacesStaleSession tests that a session the server dropped is replaced
+func TestTransport_ReplacesStaleSession(t *testing.T) {
+	f := newFakeSMTP(t, func(f *fakeSMTP) { f.drop = true })
+	tr, _ := NewTransport(f.config())
+
+	sendN(t, tr, 2)
+
+	if mails, sessions, _, _, _ := f.stats(); mails != 2 || sessions != 2 {
+		t.Errorf("Expected 2 mails on 2 sessions, got %d mails, %d sessions", mails, sessions)
+	}
+}
+
+// TestTransport_RetiresSessions tests the message and idle limits
+func TestTransport_RetiresSessions(t *testing.T) {
+	f := newFakeSMTP(t, nil)
+	cfg := f.config()
+	cfg.MaxMessagesPerConnection = 2
+	tr, _ := NewTransport(cfg)
+
+	sendN(t, tr, 3)
+	if _, sessions, _, _, quits := f.stats(); sessions != 2 || quits != 1 {
+		t.Errorf("Expected a second session after 2 messages, got %d sessions and %d QUITs", sessions, quits)
+	}
+
+	f = newFakeSMTP(t, nil)
+	cfg = f.config()
+	cfg.IdleTimeout = 10 * time.Millisecond
+	tr, _ = NewTransport(cfg)
+
+	sendN(t, tr, 1)
+	time.Sleep(20 * time.Millisecond)
+	sendN(t, tr, 1)
+	if _, sessions, _, _, _ := f.stats(); sessions != 2 {
+		t.Errorf("Expected the idle session to be replaced, got %d sessions", sessions)
+	}
+}
+
+// TestTransport_MaxConnections tests that concurrent sends never open more sessions than allowed
+func TestTransport_MaxConnections(t *testing.T) {
+	f := newFakeSMTP(t, nil)
+	cfg := f.config()
+	cfg.MaxConnections = 2
+	tr, _ := NewTransport(cfg)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- tr.Send(context.Background(), "a@boh.example", []string{"b@example.com"}, []byte("hello\r\n"))
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	mails, sessions, maxActive, _, _ := f.stats()
+	if mails != 20 || sessions > 2 || maxActive > 2 {
+		t.Errorf("Expected 20 mails on at most 2 sessions, got %d mails, %d sessions, %d at once", mails, sessions, maxActive)
+	}
+}
+
+// TestTransport_WaitsForSlot tests that a send waiting for a session gives up when its context ends
+func TestTransport_WaitsForSlot(t *testing.T) {
+	f := newFakeSMTP(t, nil)
+	cfg := f.config()
+	cfg.MaxConnections = 1
+	tr, _ := NewTransport(cfg)
+	tr.slots <- struct{}{} // the only session is busy
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := tr.Send(ctx, "a@boh.example", []string{"b@example.com"}, []byte("hello\r\n")); err == nil {
+		t.Error("Expected the send to time out waiting for a session")
+	}
+}
+
+// TestTransport_Close tests that idle sessions are ended with QUIT
+func TestTransport_Close(t *testing.T) {
+	f := newFakeSMTP(t, nil)
+	tr, _ := NewTransport(f.config())
+	sendN(t, tr, 1)
+
+	if err := tr.Close(context.Background()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, _, _, _, quits := f.stats(); quits != 1 {
+		t.Errorf("Expected the idle session to QUIT, got %d QUITs", quits)
+	}
+	if len(tr.slots) != 0 {
+		t.Errorf("Expected no open sessions, got %d", len(tr.slots))
+	}
+}
@@ -0,0 +1,243 @@
+package email
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/pem"
+	"net"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeMail is one message accepted by fakeSMTP.
+type fakeMail struct {
+	from string
+	to   []string
+	data string
+	tls  bool
+}
+
+// fakeSMTP is a minimal SMTP server that records what it is sent.
+type fakeSMTP struct {
+	ln       net.Listener
+	tls      *tls.Config
+	caFile   string
+	host     string
+	port     string
+	hangUp   bool // never send the greeting
+	implicit bool // TLS from the first byte
+
+	startTLS bool   // offer STARTTLS
+	auth     string // offered AUTH mechanisms, e.g. "PLAIN LOGIN"
+	drop     bool   // close the connection after each message
+
+	mu          sync.Mutex
+	mails       []fakeMail
+	credentials []string
+	sessions    int
+	active      int
+	maxActive   int
+	rsets       int
+	quits       int
+	failAuth    int // fail this many AUTH attempts with 535
+}
+
+func newFakeSMTP(t *testing.T, configure func(f *fakeSMTP)) *fakeSMTP {
+	t.Helper()
+	// httptest provides a certificate for 127.0.0.1 and example.com.
+	ts := httptest.NewUnstartedServer(nil)
+	ts.StartTLS()
+	cert := ts.TLS.Certificates[0]
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw}), 0o600)
+	ts.Close()
+
+	f := &fakeSMTP{tls: &tls.Config{Certificates: []tls.Certificate{cert}}, caFile: caFile, startTLS: true, auth: "PLAIN LOGIN"}
+	if configure != nil {
+		configure(f)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	if f.implicit {
+		ln = tls.NewListener(ln, f.tls)
+	}
+	f.ln = ln
+	f.host, f.port, _ = net.SplitHostPort(ln.Addr().String())
+	t.Cleanup(func() { ln.Close() })
+	go f.serve()
+	return f
+}
+
+// stats returns the counters under the lock.
+func (f *fakeSMTP) stats() (mails, sessions, maxActive, rsets, quits int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.mails), f.sessions, f.maxActive, f.rsets, f.quits
+}
+
+// config returns a transport config for the server that trusts its
+// certificate.
+func (f *fakeSMTP) config() TransportConfig {
+	return TransportConfig{Host: f.host, Port: f.port, Auth: AuthNone, CAFile: f.caFile}
+}
+
+func (f *fakeSMTP) serve() {
+	for {
+		conn, err := f.ln.Accept()
+		if err != nil {
+			return
+		}
+		go f.handle(conn)
+	}
+}
+
+func (f *fakeSMTP) handle(conn net.Conn) {
+	defer conn.Close()
+	f.mu.Lock()
+	f.sessions++
+	f.active++
+	f.maxActive = max(f.maxActive, f.active)
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		f.active--
+		f.mu.Unlock()
+	}()
+	if f.hangUp {
+		bufio.NewReader(conn).ReadString('\n')
+		return
+	}
+
+	_, secure := conn.(*tls.Conn)
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 fake ESMTP")
+	var current fakeMail
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			lines := []string{"fake"}
+			if f.startTLS && !secure {
+				lines = append(lines, "STARTTLS")
+			}
+			if f.auth != "" {
+				lines = append(lines, "AUTH "+f.auth)
+			}
+			for i, l := range lines {
+				sep := "-"
+				if i == len(lines)-1 {
+					sep = " "
+				}
+				tp.PrintfLine("250%s%s", sep, l)
+			}
+		case "STARTTLS":
+			tp.PrintfLine("220 ready")
+			tlsConn := tls.Server(conn, f.tls)
+			if tlsConn.Handshake() != nil {
+				return
+			}
+			conn, secure = tlsConn, true
+			tp = textproto.NewConn(conn)
+		case "AUTH":
+			f.authenticate(tp, arg)
+		case "MAIL":
+			current = fakeMail{from: strings.Trim(strings.TrimPrefix(arg, "FROM:"), "<>"), tls: secure}
+			tp.PrintfLine("250 ok")
+		case "RCPT":
+			current.to = append(current.to, strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>"))
+			tp.PrintfLine("250 ok")
+		case "DATA":
+			tp.PrintfLine("354 go ahead")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			current.data = string(data)
+			f.mu.Lock()
+			f.mails = append(f.mails, current)
+			f.mu.Unlock()
+			tp.PrintfLine("250 queued")
+			if f.drop {
+				return
+			}
+		case "RSET":
+			f.mu.Lock()
+			f.rsets++
+			f.mu.Unlock()
+			current = fakeMail{}
+			tp.PrintfLine("250 ok")
+		case "NOOP":
+			tp.PrintfLine("250 ok")
+		case "QUIT":
+			f.mu.Lock()
+			f.quits++
+			f.mu.Unlock()
+			tp.PrintfLine("221 bye")
+			return
+		default:
+			tp.PrintfLine("502 unknown command")
+		}
+	}
+}
+
+// authenticate handles AUTH PLAIN and AUTH LOGIN, recording the
+// credentials as "user:password".
+func (f *fakeSMTP) authenticate(tp *textproto.Conn, arg string) {
+	mechanism, initial, _ := strings.Cut(arg, " ")
+	var credential string
+	switch strings.ToUpper(mechanism) {
+	case "PLAIN":
+		data, _ := base64.StdEncoding.DecodeString(initial)
+		parts := strings.Split(string(data), "\x00")
+		if len(parts) == 3 {
+			credential = parts[1] + ":" + parts[2]
+		}
+	case "LOGIN":
+		tp.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte("Username:")))
+		user, _ := tp.ReadLine()
+		tp.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte("Password:")))
+		pass, _ := tp.ReadLine()
+		u, _ := base64.StdEncoding.DecodeString(user)
+		p, _ := base64.StdEncoding.DecodeString(pass)
+		credential = string(u) + ":" + string(p)
+	case "XOAUTH2":
+		data, _ := base64.StdEncoding.DecodeString(initial)
+		fields := strings.Split(string(data), "\x01")
+		if len(fields) == 4 {
+			credential = strings.TrimPrefix(fields[0], "user=") + ":" + strings.TrimPrefix(fields[1], "auth=Bearer ")
+		}
+	default:
+		tp.PrintfLine("504 unsupported mechanism")
+		return
+	}
+
+	f.mu.Lock()
+	f.credentials = append(f.credentials, credential)
+	fail := f.failAuth > 0
+	if fail {
+		f.failAuth--
+	}
+	f.mu.Unlock()
+	if fail {
+		if strings.EqualFold(mechanism, "XOAUTH2") {
+			// Office 365 sends a JSON error first and waits for an empty line.
+			tp.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte(`{"status":"401","schemes":"bearer"}`)))
+			tp.ReadLine()
+		}
+		tp.PrintfLine("535 5.7.3 authentication unsuccessful")
+		return
+	}
+	tp.PrintfLine("235 authenticated")
+}
@@ -0,0 +1,38 @@
+package email
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	// htmlBreaks are the tags that end a line of text, htmlParagraphs the
+	// ones that end a paragraph.
+	htmlBreaks     = regexp.MustCompile(`(?i)<br\s*/?>|</(div|li|tr)>`)
+	htmlParagraphs = regexp.MustCompile(`(?i)</(p|h[1-6]|table)>`)
+	htmlDropped    = regexp.MustCompile(`(?is)<(head|style|script)[^>]*>.*?</(head|style|script)>`)
+	htmlTags       = regexp.MustCompile(`<[^>]*>`)
+	blankLines     = regexp.MustCompile(`\n{3,}`)
+	trailingSpace  = regexp.MustCompile(`[ \t]+\n`)
+)
+
+// HTMLToText returns a readable plain-text version of an HTML body: tags
+// are dropped, block ends become line breaks and entities are decoded.
+func HTMLToText(body string) string {
+	text := htmlDropped.ReplaceAllString(body, "")
+	text = htmlParagraphs.ReplaceAllString(text, "\n\n")
+	text = htmlBreaks.ReplaceAllString(text, "\n")
+	text = htmlTags.ReplaceAllString(text, "")
+	text = html.UnescapeString(text)
+	text = trailingSpace.ReplaceAllString(text, "\n")
+	text = blankLines.ReplaceAllString(text, "\n\n")
+	return strings.TrimSpace(text)
+}
+
+// TextToHTML returns a plain-text body as escaped HTML that keeps its line
+// breaks.
+func TextToHTML(body string) string {
+	escaped := html.EscapeString(strings.ReplaceAll(body, "\r\n", "\n"))
+	return "<html><body>" + strings.ReplaceAll(escaped, "\n", "<br>\n") + "</body></html>"
+}
@@ -0,0 +1,503 @@
+package email
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TLS modes.
+const (
+	// TLSStartTLS upgrades with STARTTLS when the server offers it, like
+	// smtp.SendMail.
+	TLSStartTLS = "starttls"
+	// TLSRequireStartTLS fails when the server does not offer STARTTLS.
+	TLSRequireStartTLS = "require-starttls"
+	// TLSImplicit speaks TLS from the first byte, usually on port 465.
+	TLSImplicit = "implicit"
+	// TLSNone never encrypts, for relays on a trusted network.
+	TLSNone = "none"
+)
+
+// Auth mechanisms.
+const (
+	AuthNone    = "none"
+	AuthPlain   = "plain"
+	AuthLogin   = "login"
+	AuthCRAMMD5 = "cram-md5"
+	// AuthXOAuth2 logs Username in with a token from Tokens.
+	AuthXOAuth2 = "xoauth2"
+)
+
+// Defaults for the optional TransportConfig settings.
+const (
+	defaultDialTimeout        = 10 * time.Second
+	defaultCommandTimeout     = 30 * time.Second
+	defaultMaxConnections     = 4
+	defaultIdleTimeout        = 30 * time.Second
+	defaultMaxMessagesPerConn = 100
+)
+
+// TransportConfig describes how to reach and authenticate with an SMTP
+// server.
+type TransportConfig struct {
+	Host string
+	Port string
+	// TLSMode is one of the TLS* constants. Empty means TLSImplicit on port
+	// 465 and TLSStartTLS otherwise.
+	TLSMode string
+	// Auth is one of the Auth* constants.
+	Auth     string
+	Username string
+	Password string
+	// Tokens provides the access tokens for AuthXOAuth2.
+	Tokens TokenSource
+	// CAFile is a PEM bundle that replaces the system roots, to pin the
+	// relay's CA.
+	CAFile string
+	// ServerName is the name the certificate is checked against. It
+	// defaults to Host.
+	ServerName string
+	// DialTimeout bounds connecting, CommandTimeout each SMTP command,
+	// including sending the message data.
+	DialTimeout    time.Duration
+	CommandTimeout time.Duration
+	// MaxConnections caps the sessions open at once, busy or idle, to
+	// respect the relay's limit; sends wait for a free one.
+	MaxConnections int
+	// IdleTimeout is how long an unused session is kept for reuse.
+	IdleTimeout time.Duration
+	// MaxMessagesPerConnection retires a session after that many messages.
+	MaxMessagesPerConnection int
+}
+
+// TransportConfigFromEnv reads SMTP_HOST, SMTP_PORT, SMTP_USERNAME,
+// SMTP_PASSWORD, SMTP_TLS_MODE, SMTP_AUTH, SMTP_CA_FILE, SMTP_SERVER_NAME,
+// SMTP_DIAL_TIMEOUT, SMTP_COMMAND_TIMEOUT, SMTP_MAX_CONNECTIONS,
+// SMTP_IDLE_TIMEOUT and SMTP_MAX_MESSAGES_PER_CONNECTION. Invalid numbers
+// are reported in the error and left at their defaults.
+func TransportConfigFromEnv() (TransportConfig, error) {
+	cfg := TransportConfig{
+		Host:       os.Getenv("SMTP_HOST"),
+		Port:       os.Getenv("SMTP_PORT"),
+		Username:   os.Getenv("SMTP_USERNAME"),
+		Password:   os.Getenv("SMTP_PASSWORD"),
+		TLSMode:    strings.ToLower(os.Getenv("SMTP_TLS_MODE")),
+		Auth:       strings.ToLower(os.Getenv("SMTP_AUTH")),
+		CAFile:     os.Getenv("SMTP_CA_FILE"),
+		ServerName: os.Getenv("SMTP_SERVER_NAME"),
+	}
+	var errs []error
+	for _, d := range []struct {
+		name string
+		dst  *time.Duration
+	}{
+		{"SMTP_DIAL_TIMEOUT", &cfg.DialTimeout},
+		{"SMTP_COMMAND_TIMEOUT", &cfg.CommandTimeout},
+		{"SMTP_IDLE_TIMEOUT", &cfg.IdleTimeout},
+	} {
+		value := os.Getenv(d.name)
+		if value == "" {
+			continue
+		}
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			errs = append(errs, fmt.Errorf("invalid %s %q", d.name, value))
+			continue
+		}
+		*d.dst = timeout
+	}
+	for _, n := range []struct {
+		name string
+		dst  *int
+	}{
+		{"SMTP_MAX_CONNECTIONS", &cfg.MaxConnections},
+		{"SMTP_MAX_MESSAGES_PER_CONNECTION", &cfg.MaxMessagesPerConnection},
+	} {
+		value := os.Getenv(n.name)
+		if value == "" {
+			continue
+		}
+		count, err := strconv.Atoi(value)
+		if err != nil || count <= 0 {
+			errs = append(errs, fmt.Errorf("invalid %s %q", n.name, value))
+			continue
+		}
+		*n.dst = count
+	}
+	return cfg, errors.Join(errs...)
+}
+
+func (c TransportConfig) tlsMode() string {
+	if c.TLSMode == "" && c.Port == "465" {
+		return TLSImplicit
+	}
+	if c.TLSMode == "" {
+		return TLSStartTLS
+	}
+	return c.TLSMode
+}
+
+// Transport sends messages over SMTP with the settings of a
+// TransportConfig. It keeps authenticated sessions open and reuses them for
+// later messages. It is safe for concurrent use.
+type Transport struct {
+	cfg       TransportConfig
+	tlsConfig *tls.Config
+	auth      smtp.Auth
+	tokens    TokenSource
+
+	// slots holds a token for every open session and idle the sessions
+	// waiting for reuse, which keep their token.
+	slots chan struct{}
+	idle  chan *session
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// NewTransport checks cfg and loads its CA file.
+func NewTransport(cfg TransportConfig) (*Transport, error) {
+	if cfg.Host == "" || cfg.Port == "" {
+		return nil, errors.New("SMTP host and port are required")
+	}
+	switch cfg.tlsMode() {
+	case TLSStartTLS, TLSRequireStartTLS, TLSImplicit, TLSNone:
+	default:
+		return nil, fmt.Errorf("unknown SMTP TLS mode %q", cfg.TLSMode)
+	}
+	if cfg.DialTimeout == 0 {
+		cfg.DialTimeout = defaultDialTimeout
+	}
+	if cfg.CommandTimeout == 0 {
+		cfg.CommandTimeout = defaultCommandTimeout
+	}
+	if cfg.MaxConnections == 0 {
+		cfg.MaxConnections = defaultMaxConnections
+	}
+	if cfg.IdleTimeout == 0 {
+		cfg.IdleTimeout = defaultIdleTimeout
+	}
+	if cfg.MaxMessagesPerConnection == 0 {
+		cfg.MaxMessagesPerConnection = defaultMaxMessagesPerConn
+	}
+
+	t := &Transport{
+		cfg:   cfg,
+		slots: make(chan struct{}, cfg.MaxConnections),
+		idle:  make(chan *session, cfg.MaxConnections),
+	}
+	switch cfg.Auth {
+	case AuthNone:
+	case AuthPlain:
+		t.auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+	case AuthLogin:
+		t.auth = LoginAuth(cfg.Username, cfg.Password)
+	case AuthCRAMMD5:
+		t.auth = smtp.CRAMMD5Auth(cfg.Username, cfg.Password)
+	case AuthXOAuth2:
+		if cfg.Username == "" || cfg.Tokens == nil {
+			return nil, errors.New("SMTP auth xoauth2 needs a username and a token source")
+		}
+		t.tokens = cfg.Tokens
+	default:
+		return nil, fmt.Errorf("unknown SMTP auth mechanism %q", cfg.Auth)
+	}
+	if t.auth != nil && (cfg.Username == "" || cfg.Password == "") {
+		return nil, fmt.Errorf("SMTP auth %s needs a username and password", cfg.Auth)
+	}
+
+	serverName := cfg.ServerName
+	if serverName == "" {
+		serverName = cfg.Host
+	}
+	t.tlsConfig = &tls.Config{ServerName: serverName, MinVersion: tls.VersionTLS12}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read SMTP CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("SMTP CA file %s has no certificates", cfg.CAFile)
+		}
+		t.tlsConfig.RootCAs = pool
+	}
+	return t, nil
+}
+
+// UsesPassword reports whether the transport logs in with a username and
+// password, rather than not at all or with a token.
+func (t *Transport) UsesPassword() bool {
+	return t.auth != nil
+}
+
+// Send delivers msg from the envelope sender to the recipients, like
+// smtp.SendMail but with the transport's TLS, auth and timeouts, on a
+// pooled session when one is idle. SMTP replies are returned as
+// *textproto.Error.
+func (t *Transport) Send(ctx context.Context, from string, to []string, msg []byte) error {
+	for {
+		s, reused, err := t.get(ctx)
+		if err != nil {
+			return t.ctxErr(ctx, err)
+		}
+
+		// Cancelling ctx interrupts whatever command is in flight.
+		stop := context.AfterFunc(ctx, func() { s.conn.SetDeadline(time.Unix(1, 0)) })
+		if reused {
+			// RSET clears the previous transaction and finds sessions the
+			// server has dropped, which are replaced by a new one.
+			err := t.extend(ctx, s.conn)
+			if err == nil {
+				err = s.client.Reset()
+			}
+			if err != nil {
+				stop()
+				t.discard(s)
+				if ctx.Err() != nil {
+					return t.ctxErr(ctx, err)
+				}
+				continue
+			}
+		}
+
+		err = t.deliver(ctx, s.conn, s.client, from, to, msg)
+		interrupted := !stop()
+		t.release(s, err, interrupted)
+		return t.ctxErr(ctx, err)
+	}
+}
+
+func (t *Transport) dial(ctx context.Context) (net.Conn, error) {
+	addr := net.JoinHostPort(t.cfg.Host, t.cfg.Port)
+	dialer := &net.Dialer{Timeout: t.cfg.DialTimeout}
+	var conn net.Conn
+	var err error
+	if t.cfg.tlsMode() == TLSImplicit {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: t.tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("dial SMTP server %s: %w", addr, err)
+	}
+	return conn, nil
+}
+
+// open dials and sets up a new session. When the server rejects an OAuth
+// token, which happens when it is revoked before it expires, a new token is
+// fetched and the session is set up once more.
+func (t *Transport) open(ctx context.Context) (*session, error) {
+	s, err := t.openOnce(ctx)
+	var reply *textproto.Error
+	if err != nil && t.tokens != nil && errors.As(err, &reply) && reply.Code == 535 {
+		t.tokens.Invalidate()
+		s, err = t.openOnce(ctx)
+	}
+	return s, err
+}
+
+func (t *Transport) openOnce(ctx context.Context) (*session, error) {
+	conn, err := t.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Unix(1, 0)) })
+	defer stop()
+
+	c, err := t.session(ctx, conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &session{conn: conn, client: c}, nil
+}
+
+// session greets the server, upgrades to TLS and authenticates.
+func (t *Transport) session(ctx context.Context, conn net.Conn) (*smtp.Client, error) {
+	if err := t.extend(ctx, conn); err != nil {
+		return nil, err
+	}
+	c, err := smtp.NewClient(conn, t.cfg.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	mode := t.cfg.tlsMode()
+	if mode == TLSStartTLS || mode == TLSRequireStartTLS {
+		if err := t.extend(ctx, conn); err != nil {
+			c.Close()
+			return nil, err
+		}
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err := t.extend(ctx, conn); err != nil {
+				c.Close()
+				return nil, err
+			}
+			if err := c.StartTLS(t.tlsConfig); err != nil {
+				c.Close()
+				return nil, fmt.Errorf("SMTP STARTTLS failed: %w", err)
+			}
+		} else if mode == TLSRequireStartTLS {
+			c.Close()
+			return nil, errors.New("SMTP server does not offer STARTTLS")
+		}
+	}
+
+	auth := t.auth
+	if t.tokens != nil {
+		token, err := t.tokens.Token(ctx)
+		if err != nil {
+			c.Close()
+			return nil, fmt.Errorf("get SMTP OAuth token: %w", err)
+		}
+		auth = XOAuth2Auth(t.cfg.Username, token)
+	}
+	if auth != nil {
+		if err := t.extend(ctx, conn); err != nil {
+			c.Close()
+			return nil, err
+		}
+		if ok, _ := c.Extension("AUTH"); !ok {
+			c.Close()
+			return nil, errors.New("SMTP server does not offer AUTH")
+		}
+		if err := t.extend(ctx, conn); err != nil {
+			c.Close()
+			return nil, err
+		}
+		if err := c.Auth(auth); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// deliver sends one message on an open session.
+func (t *Transport) deliver(ctx context.Context, conn net.Conn, c *smtp.Client, from string, to []string, msg []byte) error {
+	if err := t.extend(ctx, conn); err != nil {
+		return err
+	}
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := t.extend(ctx, conn); err != nil {
+			return err
+		}
+		if err := c.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	if err := t.extend(ctx, conn); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if err := t.extend(ctx, conn); err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := t.extend(ctx, conn); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// extend gives the next command the command timeout, cut short by ctx's
+// deadline. It fails once ctx is done, so it never undoes the past deadline
+// set when ctx is cancelled; the second check catches a cancellation that
+// lands between the first and SetDeadline.
+func (t *Transport) extend(ctx context.Context, conn net.Conn) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	deadline := time.Now().Add(t.cfg.CommandTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+	if err := ctx.Err(); err != nil {
+		conn.SetDeadline(time.Unix(1, 0))
+		return err
+	}
+	return nil
+}
+
+// ctxErr reports the context's error in place of the network error its
+// cancellation caused.
+func (t *Transport) ctxErr(ctx context.Context, err error) error {
+	if err != nil && ctx.Err() != nil {
+		return fmt.Errorf("%w: %v", ctx.Err(), err)
+	}
+	return err
+}
+
+// IsPermanent reports whether the server refused the message for good with
+// a 5xx reply: a rejected mailbox or address, a syntax error, or a policy
+// or content rejection, none of which change however often it is sent.
+// Authentication failures (530, 535) are not, since a credential or token
+// rotation fixes them; see IsAuthError.
+func IsPermanent(err error) bool {
+	var reply *textproto.Error
+	if !errors.As(err, &reply) {
+		return false
+	}
+	return reply.Code >= 500 && reply.Code < 600 && !IsAuthError(err)
+}
+
+// IsAuthError reports whether the server refused to authenticate the
+// session (530, 535). Sending again straight away fails the same way.
+func IsAuthError(err error) bool {
+	var reply *textproto.Error
+	if !errors.As(err, &reply) {
+		return false
+	}
+	return reply.Code == 530 || reply.Code == 535
+}
+
+// loginAuth implements the LOGIN mechanism, which some relays, including
+// Office 365, offer instead of PLAIN.
+type loginAuth struct {
+	username, password string
+}
+
+// LoginAuth returns an smtp.Auth for the LOGIN mechanism.
+func LoginAuth(username, password string) smtp.Auth {
+	return &loginAuth{username, password}
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	return "LOGIN", []byte{}, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if more {
+		switch string(fromServer) {
+		case "Username:":
+			return []byte(a.username), nil
+		case "Password:":
+			return []byte(a.password), nil
+		default:
+			return nil, errors.New("unknown fromserver")
+		}
+	}
+
+	return nil, nil
+}
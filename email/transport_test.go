@@ -0,0 +1,215 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/textproto"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestTransport_StartTLSLogin tests that the transport upgrades with STARTTLS, trusts the CA file and logs in
+func TestTransport_StartTLSLogin(t *testing.T) {
+	f := newFakeSMTP(t, nil)
+	cfg := f.config()
+	cfg.TLSMode = TLSRequireStartTLS
+	cfg.Auth, cfg.Username, cfg.Password = AuthLogin, "user", "secret"
+	tr, err := NewTransport(cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	err = tr.Send(context.Background(), "alerts@boh.example", []string{"alice@example.com", "bob@example.com"}, []byte("Subject: hi\r\n\r\nhello\r\n"))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(f.mails) != 1 || !f.mails[0].tls || f.mails[0].from != "alerts@boh.example" || len(f.mails[0].to) != 2 {
+		t.Fatalf("Unexpected mails: %+v", f.mails)
+	}
+	if !strings.Contains(f.mails[0].data, "hello") {
+		t.Errorf("Unexpected data: %q", f.mails[0].data)
+	}
+	if len(f.credentials) != 1 || f.credentials[0] != "user:secret" {
+		t.Errorf("Expected one LOGIN with user:secret, got %v", f.credentials)
+	}
+}
+
+// TestTransport_ImplicitTLS tests TLS from the first byte with PLAIN auth
+func TestTransport_ImplicitTLS(t *testing.T) {
+	f := newFakeSMTP(t, func(f *fakeSMTP) { f.implicit = true })
+	cfg := f.config()
+	cfg.TLSMode = TLSImplicit
+	cfg.Auth, cfg.Username, cfg.Password = AuthPlain, "user", "secret"
+	tr, _ := NewTransport(cfg)
+
+	if err := tr.Send(context.Background(), "alerts@boh.example", []string{"alice@example.com"}, []byte("hello\r\n")); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(f.mails) != 1 || !f.mails[0].tls || f.credentials[0] != "user:secret" {
+		t.Errorf("Expected one authenticated mail over TLS, got %+v %v", f.mails, f.credentials)
+	}
+}
+
+// TestTransport_NoAuthRelay tests sending through a relay that offers neither STARTTLS nor AUTH
+func TestTransport_NoAuthRelay(t *testing.T) {
+	f := newFakeSMTP(t, func(f *fakeSMTP) { f.startTLS, f.auth = false, "" })
+	tr, _ := NewTransport(f.config())
+
+	if err := tr.Send(context.Background(), "alerts@boh.example", []string{"alice@example.com"}, []byte("hello\r\n")); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(f.mails) != 1 || f.mails[0].tls {
+		t.Errorf("Expected one plaintext mail, got %+v", f.mails)
+	}
+}
+
+// TestTransport_Errors tests the failures caused by the server's capabilities and replies
+func TestTransport_Errors(t *testing.T) {
+	msg := []byte("hello\r\n")
+
+	f := newFakeSMTP(t, func(f *fakeSMTP) { f.startTLS = false })
+	cfg := f.config()
+	cfg.TLSMode = TLSRequireStartTLS
+	tr, _ := NewTransport(cfg)
+	if err := tr.Send(context.Background(), "a@boh.example", []string{"b@example.com"}, msg); err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Errorf("Expected a missing STARTTLS error, got %v", err)
+	}
+
+	f = newFakeSMTP(t, func(f *fakeSMTP) { f.auth = "" })
+	cfg = f.config()
+	cfg.Auth, cfg.Username, cfg.Password = AuthLogin, "user", "secret"
+	tr, _ = NewTransport(cfg)
+	if err := tr.Send(context.Background(), "a@boh.example", []string{"b@example.com"}, msg); err == nil || !strings.Contains(err.Error(), "AUTH") {
+		t.Errorf("Expected a missing AUTH error, got %v", err)
+	}
+
+	f = newFakeSMTP(t, func(f *fakeSMTP) { f.failAuth = 1 })
+	cfg = f.config()
+	cfg.Auth, cfg.Username, cfg.Password = AuthLogin, "user", "wrong"
+	tr, _ = NewTransport(cfg)
+	var protoErr *textproto.Error
+	if err := tr.Send(context.Background(), "a@boh.example", []string{"b@example.com"}, msg); !errors.As(err, &protoErr) || protoErr.Code != 535 {
+		t.Errorf("Expected the 535 reply, got %v", err)
+	}
+
+	f = newFakeSMTP(t, nil)
+	cfg = f.config()
+	cfg.CAFile = ""
+	tr, _ = NewTransport(cfg)
+	if err := tr.Send(context.Background(), "a@boh.example", []string{"b@example.com"}, msg); err == nil {
+		t.Error("Expected an untrusted certificate to fail")
+	}
+}
+
+// TestTransport_CommandTimeout tests that a server that stops answering times out
+func TestTransport_CommandTimeout(t *testing.T) {
+	f := newFakeSMTP(t, func(f *fakeSMTP) { f.hangUp = true })
+	cfg := f.config()
+	cfg.CommandTimeout = 100 * time.Millisecond
+	tr, _ := NewTransport(cfg)
+
+	start := time.Now()
+	err := tr.Send(context.Background(), "a@boh.example", []string{"b@example.com"}, []byte("hello\r\n"))
+	if err == nil || time.Since(start) > 2*time.Second {
+		t.Errorf("Expected a timeout within the command timeout, got %v after %v", err, time.Since(start))
+	}
+}
+
+// TestTransport_ExtendHonorsContext tests that command deadlines never outlive the send's context
+func TestTransport_ExtendHonorsContext(t *testing.T) {
+	tr := &Transport{cfg: TransportConfig{CommandTimeout: time.Hour}}
+	conn, peer := net.Pipe()
+	defer conn.Close()
+	defer peer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := tr.extend(ctx, conn); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	start := time.Now()
+	if _, err := conn.Read(make([]byte, 1)); !errors.Is(err, os.ErrDeadlineExceeded) || time.Since(start) > 2*time.Second {
+		t.Errorf("Expected the context deadline to cut the command short, got %v after %v", err, time.Since(start))
+	}
+
+	// A cancellation has already set a past deadline, which extend must keep.
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	conn.SetDeadline(time.Unix(1, 0))
+	if err := tr.extend(cancelled, conn); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if _, err := conn.Read(make([]byte, 1)); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Expected the past deadline to stay, got %v", err)
+	}
+}
+
+// TestIsPermanent tests which SMTP replies are final and which are authentication failures
+func TestIsPermanent(t *testing.T) {
+	tests := []struct {
+		err             error
+		permanent, auth bool
+	}{
+		{&textproto.Error{Code: 550, Msg: "5.1.1 mailbox unavailable"}, true, false},
+		{&textproto.Error{Code: 554, Msg: "5.7.1 message rejected"}, true, false},
+		{&textproto.Error{Code: 555, Msg: "5.5.4 unsupported parameter"}, true, false},
+		{&textproto.Error{Code: 535, Msg: "5.7.8 authentication failed"}, false, true},
+		{&textproto.Error{Code: 530, Msg: "5.7.0 authentication required"}, false, true},
+		{&textproto.Error{Code: 451, Msg: "4.7.1 try again later"}, false, false},
+		{errors.New("dial tcp: i/o timeout"), false, false},
+	}
+	for _, tt := range tests {
+		if got := IsPermanent(tt.err); got != tt.permanent {
+			t.Errorf("IsPermanent(%v) = %v, want %v", tt.err, got, tt.permanent)
+		}
+		if got := IsAuthError(tt.err); got != tt.auth {
+			t.Errorf("IsAuthError(%v) = %v, want %v", tt.err, got, tt.auth)
+		}
+	}
+}
+
+// TestNewTransport_InvalidConfig tests the settings that are rejected up front
+func TestNewTransport_InvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  TransportConfig
+	}{
+		{"No host", TransportConfig{Port: "25", Auth: AuthNone}},
+		{"Unknown TLS mode", TransportConfig{Host: "smtp", Port: "25", Auth: AuthNone, TLSMode: "ssl"}},
+		{"Unknown auth", TransportConfig{Host: "smtp", Port: "25", Auth: "ntlm"}},
+		{"Auth without password", TransportConfig{Host: "smtp", Port: "25", Auth: AuthPlain, Username: "user"}},
+		{"XOAuth2 without tokens", TransportConfig{Host: "smtp", Port: "587", Auth: AuthXOAuth2, Username: "user"}},
+		{"XOAuth2 without username", TransportConfig{Host: "smtp", Port: "587", Auth: AuthXOAuth2, Tokens: &fakeTokens{}}},
+		{"Missing CA file", TransportConfig{Host: "smtp", Port: "25", Auth: AuthNone, CAFile: "/nonexistent/ca.pem"}},
+	}
+
+	for _, tt := range tests {
+		if _, err := NewTransport(tt.cfg); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
+
+// TestTransportConfigFromEnv tests reading the SMTP_* settings
+func TestTransportConfigFromEnv(t *testing.T) {
+	t.Setenv("SMTP_HOST", "smtp.office365.com")
+	t.Setenv("SMTP_PORT", "465")
+	t.Setenv("SMTP_AUTH", "CRAM-MD5")
+	t.Setenv("SMTP_DIAL_TIMEOUT", "5s")
+	t.Setenv("SMTP_COMMAND_TIMEOUT", "soon")
+
+	cfg, err := TransportConfigFromEnv()
+	if err == nil || !strings.Contains(err.Error(), "SMTP_COMMAND_TIMEOUT") {
+		t.Errorf("Expected an invalid SMTP_COMMAND_TIMEOUT error, got %v", err)
+	}
+	if cfg.Host != "smtp.office365.com" || cfg.Auth != AuthCRAMMD5 || cfg.DialTimeout != 5*time.Second || cfg.CommandTimeout != 0 {
+		t.Errorf("Unexpected config: %+v", cfg)
+	}
+	if cfg.tlsMode() != TLSImplicit {
+		t.Errorf("Expected implicit TLS on port 465, got %q", cfg.tlsMode())
+	}
+}
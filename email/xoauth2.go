@@ -0,0 +1,47 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"net/smtp"
+)
+
+// TokenSource provides OAuth access tokens for AuthXOAuth2, such as cached
+// Entra ID client-credentials tokens.
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+	// Invalidate drops the cached token after the server rejected it.
+	Invalidate()
+}
+
+// xoauth2Auth implements the XOAUTH2 mechanism used by Office 365 and Gmail.
+type xoauth2Auth struct {
+	username, token string
+}
+
+// XOAuth2Auth returns an smtp.Auth that logs username in with an OAuth
+// access token. Like smtp.PlainAuth it refuses to send the token over an
+// unencrypted connection, except to localhost.
+func XOAuth2Auth(username, token string) smtp.Auth {
+	return &xoauth2Auth{username, token}
+}
+
+func (a *xoauth2Auth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	return "XOAUTH2", []byte("user=" + a.username + "\x01auth=Bearer " + a.token + "\x01\x01"), nil
+}
+
+// Next answers the JSON error challenge a server sends for a rejected token
+// with an empty response, after which the server replies 535.
+func (a *xoauth2Auth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if more {
+		return []byte{}, nil
+	}
+	return nil, nil
+}
+
+func isLocalhost(name string) bool {
+	return name == "localhost" || name == "127.0.0.1" || name == "::1"
+}
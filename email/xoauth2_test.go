@@ -0,0 +1,92 @@
+package email
+
+import (
+	"context"
+	"fmt"
+	"net/smtp"
+	"sync"
+	"testing"
+)
+
+// fakeTokens hands out token-1, token-2, ... and counts invalidations.
+type fakeTokens struct {
+	mu          sync.Mutex
+	issued      int
+	current     string
+	invalidated int
+}
+
+func (f *fakeTokens) Token(ctx context.Context) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.current == "" {
+		f.issued++
+		f.current = fmt.Sprintf("token-%d", f.issued)
+	}
+	return f.current, nil
+}
+
+func (f *fakeTokens) Invalidate() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.current = ""
+	f.invalidated++
+}
+
+// TestTransport_XOAuth2 tests logging in with a token and refreshing it after a 535
+func TestTransport_XOAuth2(t *testing.T) {
+	f := newFakeSMTP(t, func(f *fakeSMTP) { f.auth = "LOGIN XOAUTH2"; f.failAuth = 1 })
+	tokens := &fakeTokens{}
+	cfg := f.config()
+	cfg.TLSMode = TLSRequireStartTLS
+	cfg.Auth, cfg.Username, cfg.Tokens = AuthXOAuth2, "alerts@boh.example", tokens
+	tr, err := NewTransport(cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := tr.Send(context.Background(), "alerts@boh.example", []string{"b@example.com"}, []byte("hello\r\n")); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	want := []string{"alerts@boh.example:token-1", "alerts@boh.example:token-2"}
+	if fmt.Sprint(f.credentials) != fmt.Sprint(want) {
+		t.Errorf("Expected credentials %v, got %v", want, f.credentials)
+	}
+	if tokens.invalidated != 1 {
+		t.Errorf("Expected the rejected token to be invalidated once, got %d", tokens.invalidated)
+	}
+	if mails, sessions, _, _, _ := f.stats(); mails != 2 || sessions != 2 {
+		t.Errorf("Expected 2 mails over 2 sessions, got %d over %d", mails, sessions)
+	}
+}
+
+// TestTransport_XOAuth2Rejected tests that a token rejected twice fails the send
+func TestTransport_XOAuth2Rejected(t *testing.T) {
+	f := newFakeSMTP(t, func(f *fakeSMTP) { f.auth = "XOAUTH2"; f.failAuth = 2 })
+	tokens := &fakeTokens{}
+	cfg := f.config()
+	cfg.Auth, cfg.Username, cfg.Tokens = AuthXOAuth2, "alerts@boh.example", tokens
+	tr, _ := NewTransport(cfg)
+
+	if err := tr.Send(context.Background(), "alerts@boh.example", []string{"b@example.com"}, []byte("hello\r\n")); err == nil {
+		t.Fatal("Expected an error")
+	}
+	if tokens.issued != 2 {
+		t.Errorf("Expected one retry with a new token, got %d tokens", tokens.issued)
+	}
+}
+
+// TestXOAuth2Auth_Unencrypted tests that the token is not sent in the clear to a remote server
+func TestXOAuth2Auth_Unencrypted(t *testing.T) {
+	auth := XOAuth2Auth("user", "token")
+	if _, _, err := auth.Start(&smtp.ServerInfo{Name: "smtp.office365.com", TLS: false, Auth: []string{"XOAUTH2"}}); err == nil {
+		t.Error("Expected an error for an unencrypted remote server")
+	}
+	mechanism, resp, err := auth.Start(&smtp.ServerInfo{Name: "smtp.office365.com", TLS: true, Auth: []string{"XOAUTH2"}})
+	if err != nil || mechanism != "XOAUTH2" || string(resp) != "user=user\x01auth=Bearer token\x01\x01" {
+		t.Errorf("Unexpected start: %q %q %v", mechanism, resp, err)
+	}
+}
@@ -0,0 +1,49 @@
+// Package env reads numeric settings from the environment. Unset variables
+// fall back to a default; invalid ones are logged and fall back too, so a
+// typo never stops the service.
+package env
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Int reads a positive integer from key.
+func Int(key string, def int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		log.Printf("Invalid %s %q, using %d", key, v, def)
+		return def
+	}
+	return n
+}
+
+// Duration reads a positive duration such as "45s" from key.
+func Duration(key string, def time.Duration) time.Duration {
+	return duration(key, def, false)
+}
+
+// NonNegativeDuration is Duration, but also accepts "0", for delays that
+// can be turned off.
+func NonNegativeDuration(key string, def time.Duration) time.Duration {
+	return duration(key, def, true)
+}
+
+func duration(key string, def time.Duration, zero bool) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 || (d == 0 && !zero) {
+		log.Printf("Invalid %s %q, using %s", key, v, def)
+		return def
+	}
+	return d
+}
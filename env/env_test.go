@@ -0,0 +1,39 @@
+package env
+
+import (
+	"testing"
+	"time"
+)
+
+// TestInt tests that only positive integers replace the default
+func TestInt(t *testing.T) {
+	for value, want := range map[string]int{"": 5, "12": 12, "0": 5, "-3": 5, "ten": 5} {
+		t.Setenv("TEST_INT", value)
+		if got := Int("TEST_INT", 5); got != want {
+			t.Errorf("Int(%q) = %d, want %d", value, got, want)
+		}
+	}
+}
+
+// TestDuration tests that zero is only accepted where a delay can be turned off
+func TestDuration(t *testing.T) {
+	tests := []struct {
+		value            string
+		positive, nonNeg time.Duration
+	}{
+		{"", time.Second, time.Second},
+		{"45s", 45 * time.Second, 45 * time.Second},
+		{"0", time.Second, 0},
+		{"-1s", time.Second, time.Second},
+		{"soon", time.Second, time.Second},
+	}
+	for _, tt := range tests {
+		t.Setenv("TEST_DURATION", tt.value)
+		if got := Duration("TEST_DURATION", time.Second); got != tt.positive {
+			t.Errorf("Duration(%q) = %s, want %s", tt.value, got, tt.positive)
+		}
+		if got := NonNegativeDuration("TEST_DURATION", time.Second); got != tt.nonNeg {
+			t.Errorf("NonNegativeDuration(%q) = %s, want %s", tt.value, got, tt.nonNeg)
+		}
+	}
+}
@@ -1,11 +1,20 @@
 package main
 
 import (
+	"boh/notification-service/consumer"
+	"boh/notification-service/correlation"
+	"boh/notification-service/delivery"
+	"boh/notification-service/env"
 	"boh/notification-service/notifier"
+	"boh/notification-service/publisher"
+	"boh/notification-service/webhook"
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
@@ -14,12 +23,21 @@ import (
 
 type TransactionCompletedEvent struct {
 	UserID          string  `json:"userId"`
-	TransactionID   int64   `json: "transactionId"`
-	TransactionType string  `json: "transactionType"`
-	Amount          float64 `json: "amount"`
-	Timestamp       string  `json: "timestamp"`
+	TransactionID   int64   `json:"transactionId"`
+	TransactionType string  `json:"transactionType"`
+	Amount          float64 `json:"amount"`
+	Timestamp       string  `json:"timestamp"`
 }
 
+const (
+	defaultMaxConcurrency      = 10
+	defaultMaxDeliveryAttempts = 5
+	defaultShutdownTimeout     = 30 * time.Second
+	defaultMaxLockRenewal      = 5 * time.Minute
+	defaultMaxReschedules      = 20
+	closeTimeout               = 10 * time.Second
+)
+
 func main() {
 	err := godotenv.Load()
 	if err != nil {
@@ -32,13 +50,34 @@ func main() {
 		log.Fatal("service bus env variables must be set")
 	}
 
+	maxConcurrency := env.Int("MAX_CONCURRENCY", defaultMaxConcurrency)
+	maxDeliveryAttempts := env.Int("MAX_DELIVERY_ATTEMPTS", defaultMaxDeliveryAttempts)
+	shutdownTimeout := env.Duration("SHUTDOWN_TIMEOUT", defaultShutdownTimeout)
+	maxLockRenewal := env.Duration("MAX_LOCK_RENEWAL", defaultMaxLockRenewal)
+	maxReschedules := env.Int("MAX_RESCHEDULES", defaultMaxReschedules)
+
+	notifier.Init()
+	defer closeWithTimeout("SMTP sessions", notifier.Close)
+
+	store, err := openDeliveryStore()
+	if err != nil {
+		log.Fatalf("Failed to open delivery store: %v", err)
+	}
+	notifier.SetDeliveryStore(store)
+
+	correlations, err := openCorrelationStore()
+	if err != nil {
+		log.Fatalf("Failed to open correlation store: %v", err)
+	}
+	notifier.SetCorrelationStore(correlations)
+
 	client, err := azservicebus.NewClientFromConnectionString(connectionstring, nil)
 
 	if err != nil {
 		log.Fatalf("Failed to create service bus client: %v", err)
 	}
 
-	defer client.Close(context.Background())
+	defer closeWithTimeout("service bus client", client.Close)
 
 	receiver, err := client.NewReceiverForQueue(queueName, &azservicebus.ReceiverOptions{
 		ReceiveMode: azservicebus.ReceiveModePeekLock})
@@ -47,42 +86,119 @@ func main() {
 		log.Fatalf("Failed to create receiver for queue %s: %v", queueName, err)
 	}
 
-	defer receiver.Close(context.Background())
-
-	fmt.Printf("Notification service started")
-
-	for {
-		ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
-		messages, err := receiver.ReceiveMessages(ctx, 1, nil)
-		cancel()
+	defer closeWithTimeout("receiver", receiver.Close)
 
+	if resultsQueue := os.Getenv("RESULTS_QUEUE_NAME"); resultsQueue != "" {
+		sender, err := client.NewSender(resultsQueue, nil)
 		if err != nil {
-			log.Printf("Error receiving message: %v. Retrying...\n", err)
-			time.Sleep(5 * time.Second) // Wait before retrying
-			continue
+			log.Fatalf("Failed to create sender for queue %s: %v", resultsQueue, err)
 		}
+		defer closeWithTimeout("results sender", sender.Close)
+		resultsPublisher = publisher.New(sender)
+	}
 
-		if len(messages) == 0 {
-			continue
+	// Answers to interactive messages, e.g. fraud confirmations, are
+	// published for the service that asked the question.
+	var onMessage webhook.MessageFunc
+	if repliesQueue := os.Getenv("REPLIES_QUEUE_NAME"); repliesQueue != "" {
+		sender, err := client.NewSender(repliesQueue, nil)
+		if err != nil {
+			log.Fatalf("Failed to create sender for queue %s: %v", repliesQueue, err)
 		}
+		defer closeWithTimeout("replies sender", sender.Close)
+		onMessage = correlation.NewReplyHandler(correlations, publisher.New(sender)).HandleMessage
+	}
+
+	if addr := os.Getenv("WEBHOOK_ADDR"); addr != "" {
+		srv := startWebhookServer(addr, store, onMessage)
+		defer shutdownWebhookServer(srv)
+	}
+
+	// Messages waiting on an open circuit breaker are re-enqueued on the same
+	// queue instead of being abandoned.
+	rescheduler, err := client.NewSender(queueName, nil)
+	if err != nil {
+		log.Fatalf("Failed to create sender for queue %s: %v", queueName, err)
+	}
+	defer closeWithTimeout("reschedule sender", rescheduler.Close)
 
-		msg := messages[0]
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-		log.Printf("Received message ID: %s\n", msg.MessageID)
-		log.Printf("Message body: %s\n", string(msg.Body))
+	fmt.Printf("Notification service started with %d workers\n", maxConcurrency)
 
-		err = notifier.MessageUnmarshal([]byte(msg.Body))
+	c := consumer.New(receiver, handleMessage, consumer.Options{
+		MaxConcurrency:      maxConcurrency,
+		MaxDeliveryAttempts: maxDeliveryAttempts,
+		ShutdownTimeout:     shutdownTimeout,
+		MaxLockRenewal:      maxLockRenewal,
+		Reschedule:          consumer.RescheduleWith(rescheduler),
+		MaxReschedules:      maxReschedules,
+	})
+	c.Run(ctx)
 
-		if err != nil {
-			log.Fatalf("error occurred: %v", err)
+	log.Println("Notification service shutting down")
+}
+
+// resultsPublisher receives a DeliveryReport for every processed message
+// when RESULTS_QUEUE_NAME is set.
+var resultsPublisher *publisher.Publisher
+
+func handleMessage(ctx context.Context, msg *azservicebus.ReceivedMessage) error {
+	log.Printf("Message body: %s\n", string(msg.Body))
+
+	report, err := notifier.MessageUnmarshalContext(ctx, msg.Body)
+
+	if resultsPublisher != nil && len(report.Results) > 0 {
+		if pubErr := resultsPublisher.Publish(ctx, report, report.NotificationID); pubErr != nil {
+			log.Printf("Error publishing delivery report for message %s: %v", msg.MessageID, pubErr)
 		}
+	}
 
-		err = receiver.CompleteMessage(context.Background(), msg, nil)
+	return err
+}
 
-		if err != nil {
-			log.Printf("Error completing message %s: %v\n", msg.MessageID, err)
-		} else {
-			log.Printf("Message %s completed successfully.\n", msg.MessageID)
+// closeWithTimeout closes a Service Bus link or another connection without
+// hanging shutdown on an unreachable peer.
+func closeWithTimeout(name string, closeFn func(ctx context.Context) error) {
+	ctx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+	defer cancel()
+
+	if err := closeFn(ctx); err != nil {
+		log.Printf("Error closing %s: %v", name, err)
+	}
+}
+
+// openDeliveryStore builds the idempotency store selected by DELIVERY_STORE:
+// "memory" (default) or "file". The binary has no database/sql driver, so
+// delivery.SQLStore is left to builds that import one.
+func openDeliveryStore() (delivery.Store, error) {
+	switch kind := os.Getenv("DELIVERY_STORE"); kind {
+	case "", "memory":
+		return delivery.NewMemoryStore(env.Duration("DELIVERY_TTL", delivery.DefaultTTL)), nil
+	case "file":
+		path := os.Getenv("DELIVERY_STORE_FILE")
+		if path == "" {
+			path = "deliveries.jsonl"
 		}
+		return delivery.OpenFileStore(path, env.Duration("DELIVERY_TTL", delivery.DefaultTTL))
+	case "sql":
+		return nil, errors.New("DELIVERY_STORE sql is not available, no database driver is compiled in")
+	default:
+		return nil, fmt.Errorf("unknown DELIVERY_STORE %q", kind)
+	}
+}
+
+// openCorrelationStore builds the store selected by CORRELATION_STORE. Only
+// "memory" (default) is available: like DELIVERY_STORE, the sql store needs
+// a database driver this binary does not import.
+func openCorrelationStore() (correlation.Store, error) {
+	switch kind := os.Getenv("CORRELATION_STORE"); kind {
+	case "", "memory":
+		return correlation.NewMemoryStore(env.Duration("CORRELATION_TTL", correlation.DefaultTTL)), nil
+	case "sql":
+		return nil, errors.New("CORRELATION_STORE sql is not available, no database driver is compiled in")
+	default:
+		return nil, fmt.Errorf("unknown CORRELATION_STORE %q", kind)
 	}
 }
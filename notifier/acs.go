@@ -0,0 +1,509 @@
+package notifier
+
+import (
+	"boh/notification-service/channel"
+	"boh/notification-service/retry"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultACSAPIVersion is the Advanced Messaging version for text,
+	// image, document, video and template messages; 2024-02-01 only knew
+	// text, image and template.
+	defaultACSAPIVersion = "2024-08-30"
+	// acsInteractiveAPIVersion is the first version with reply buttons.
+	acsInteractiveAPIVersion = "2025-01-15-preview"
+	defaultACSAuthorityHost  = "https://login.microsoftonline.com"
+	acsScope                 = "https://communication.azure.com/.default"
+)
+
+// ACSConfig points the WhatsApp channel at an Azure Communication Services
+// resource and the Entra ID app registration used to call it.
+type ACSConfig struct {
+	TenantID              string
+	ClientID              string
+	ClientSecret          string
+	ChannelRegistrationID string
+	// Endpoint is the ACS resource URL, e.g.
+	// https://<resource>.unitedstates.communication.azure.com.
+	Endpoint      string
+	APIVersion    string
+	AuthorityHost string
+	// SMSFrom is the ACS phone number or sender id SMS are sent from.
+	SMSFrom string
+}
+
+// acsClient makes every ACS and token request. Its timeout keeps a hung
+// endpoint from holding a worker until the message lock is lost.
+var acsClient = &http.Client{Timeout: 30 * time.Second}
+
+var (
+	// acsConfig is used for events without a brand, or whose brand has no
+	// overrides.
+	acsConfig ACSConfig
+	acsBrands = map[string]ACSConfig{}
+)
+
+// ACSConfigFromEnv reads <prefix>TENANT_ID, <prefix>APP_ID, <prefix>APP_SECRET,
+// <prefix>CHANNEL_REGISTRATION_ID, <prefix>ENDPOINT, <prefix>API_VERSION,
+// <prefix>AUTHORITY_HOST and <prefix>SMS_FROM. Unset variables are left
+// empty.
+func ACSConfigFromEnv(prefix string) ACSConfig {
+	return ACSConfig{
+		TenantID:              os.Getenv(prefix + "TENANT_ID"),
+		ClientID:              os.Getenv(prefix + "APP_ID"),
+		ClientSecret:          os.Getenv(prefix + "APP_SECRET"),
+		ChannelRegistrationID: os.Getenv(prefix + "CHANNEL_REGISTRATION_ID"),
+		Endpoint:              os.Getenv(prefix + "ENDPOINT"),
+		APIVersion:            os.Getenv(prefix + "API_VERSION"),
+		AuthorityHost:         os.Getenv(prefix + "AUTHORITY_HOST"),
+		SMSFrom:               os.Getenv(prefix + "SMS_FROM"),
+	}
+}
+
+// Override returns c with every non-empty field of o applied on top.
+func (c ACSConfig) Override(o ACSConfig) ACSConfig {
+	set := func(dst *string, v string) {
+		if v != "" {
+			*dst = v
+		}
+	}
+	set(&c.TenantID, o.TenantID)
+	set(&c.ClientID, o.ClientID)
+	set(&c.ClientSecret, o.ClientSecret)
+	set(&c.ChannelRegistrationID, o.ChannelRegistrationID)
+	set(&c.Endpoint, o.Endpoint)
+	set(&c.APIVersion, o.APIVersion)
+	set(&c.AuthorityHost, o.AuthorityHost)
+	set(&c.SMSFrom, o.SMSFrom)
+	return c
+}
+
+// Configured reports whether c has everything needed to send a message.
+func (c ACSConfig) Configured() bool {
+	return len(c.Missing()) == 0
+}
+
+// Missing returns the names of the settings c needs to send a WhatsApp
+// message but does not have, without their ACS_ prefix.
+func (c ACSConfig) Missing() []string {
+	var missing []string
+	for _, field := range []struct{ name, value string }{
+		{"TENANT_ID", c.TenantID},
+		{"APP_ID", c.ClientID},
+		{"APP_SECRET", c.ClientSecret},
+		{"CHANNEL_REGISTRATION_ID", c.ChannelRegistrationID},
+		{"ENDPOINT", c.Endpoint},
+	} {
+		if field.value == "" {
+			missing = append(missing, field.name)
+		}
+	}
+	return missing
+}
+
+func (c ACSConfig) tokenURL() string {
+	host := c.AuthorityHost
+	if host == "" {
+		host = defaultACSAuthorityHost
+	}
+	return strings.TrimRight(host, "/") + "/" + url.PathEscape(c.TenantID) + "/oauth2/v2.0/token"
+}
+
+// sendURL returns the notifications:send URL for a message of kind. An
+// APIVersion set in c is used for every kind.
+func (c ACSConfig) sendURL(kind string) string {
+	version := c.APIVersion
+	if version == "" {
+		version = defaultACSAPIVersion
+		if kind == "interactive" {
+			version = acsInteractiveAPIVersion
+		}
+	}
+	return strings.TrimRight(c.Endpoint, "/") + "/messages/notifications:send?api-version=" + url.QueryEscape(version)
+}
+
+// SetACSConfig replaces the default ACS settings and the per-brand
+// overrides. Brands are matched case-insensitively and each one is applied
+// on top of def. Init calls it with the ACS_* variables.
+func SetACSConfig(def ACSConfig, brands map[string]ACSConfig) {
+	acsConfig = def
+	acsBrands = make(map[string]ACSConfig, len(brands))
+	for brand, o := range brands {
+		acsBrands[strings.ToLower(brand)] = def.Override(o)
+	}
+}
+
+// acsConfigFor returns the settings for brand, falling back to the default.
+func acsConfigFor(brand string) ACSConfig {
+	if cfg, ok := acsBrands[strings.ToLower(brand)]; ok {
+		return cfg
+	}
+	return acsConfig
+}
+
+// loadACSConfig reads ACS_* and, for every brand listed in ACS_BRANDS,
+// ACS_<BRAND>_* overrides. There are no built-in defaults any more, so a
+// deployment that relied on them gets an error at startup rather than
+// finding every WhatsApp send failing as not configured.
+func loadACSConfig() {
+	brands := map[string]ACSConfig{}
+	for _, brand := range strings.Split(os.Getenv("ACS_BRANDS"), ",") {
+		brand = strings.TrimSpace(brand)
+		if brand == "" {
+			continue
+		}
+		brands[brand] = ACSConfigFromEnv("ACS_" + envName(brand) + "_")
+	}
+	SetACSConfig(ACSConfigFromEnv("ACS_"), brands)
+
+	if missing := acsConfig.Missing(); len(missing) > 0 {
+		log.Printf("Error: ACS is not configured, WhatsApp sends will fail: ACS_%s not set", strings.Join(missing, ", ACS_"))
+	}
+	for brand, cfg := range acsBrands {
+		if missing := cfg.Missing(); len(missing) > 0 {
+			log.Printf("Error: ACS is not configured for brand %q, its WhatsApp sends will fail: %s not set", brand, strings.Join(missing, ", "))
+		}
+	}
+}
+
+// envName upper-cases s and replaces anything that is not a letter or digit
+// with an underscore, so "boh-retail" becomes "BOH_RETAIL".
+func envName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// acsTokens caches one Entra ID token per app registration used for ACS
+// Advanced Messaging.
+var (
+	acsTokensMu sync.Mutex
+	acsTokens   = map[string]*tokenSource{}
+)
+
+func acsTokenSource(cfg ACSConfig) *tokenSource {
+	key := cfg.tokenURL() + "|" + cfg.ClientID
+
+	acsTokensMu.Lock()
+	defer acsTokensMu.Unlock()
+
+	s, ok := acsTokens[key]
+	if !ok {
+		s = newTokenSource("acs:"+cfg.TenantID+":"+cfg.ClientID, func(ctx context.Context) (*OauthTokenResponse, error) {
+			return getOauthToken(ctx, cfg)
+		})
+		acsTokens[key] = s
+	}
+	return s
+}
+
+// ACSTokenHealth reports whether the last refresh of any ACS token failed,
+// for use in health checks.
+func ACSTokenHealth() error {
+	acsTokensMu.Lock()
+	defer acsTokensMu.Unlock()
+
+	var errs []error
+	for _, s := range acsTokens {
+		if err := s.Health(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func getOauthToken(ctx context.Context, cfg ACSConfig) (*OauthTokenResponse, error) {
+	return requestToken(ctx, cfg, acsScope)
+}
+
+// requestToken fetches a client-credentials token for scope with the app
+// registration in cfg.
+func requestToken(ctx context.Context, cfg ACSConfig, scope string) (*OauthTokenResponse, error) {
+
+	var response OauthTokenResponse
+	data := map[string]string{
+		"grant_type":    "client_credentials",
+		"client_id":     cfg.ClientID,
+		"client_secret": cfg.ClientSecret,
+		"scope":         scope,
+	}
+
+	values := url.Values{}
+
+	for key, value := range data {
+		values.Add(key, value)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.tokenURL(), strings.NewReader(values.Encode()))
+	if err != nil {
+		return &response, fmt.Errorf("create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := acsClient.Do(req)
+
+	if err != nil {
+		return &response, fmt.Errorf("token request failed: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return &response, fmt.Errorf("read token response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return &response, fmt.Errorf("token request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	err = json.Unmarshal(body, &response)
+
+	if err != nil {
+		return &response, fmt.Errorf("decode token response: %w", err)
+	}
+
+	return &response, nil
+
+}
+
+// ACSError is a non-2xx response from ACS Advanced Messaging, decoded from
+// its error envelope when the body has one.
+type ACSError struct {
+	StatusCode int
+	Code       string
+	Message    string
+	Target     string
+	// Retryable is set for throttling, timeouts, server errors and rejected
+	// tokens, which may succeed on a later attempt.
+	Retryable bool
+}
+
+func (e *ACSError) Error() string {
+	msg := fmt.Sprintf("ACS request failed with status %d", e.StatusCode)
+	if e.Code != "" {
+		msg += ": " + e.Code
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if e.Target != "" {
+		msg += " (target " + e.Target + ")"
+	}
+	return msg
+}
+
+// newACSError builds the error for a failed response. Requests ACS rejects
+// as malformed (400, 404) will never succeed and are marked permanent.
+func newACSError(resp *http.Response, body []byte) error {
+	e := &ACSError{
+		StatusCode: resp.StatusCode,
+		Retryable: resp.StatusCode == http.StatusUnauthorized ||
+			resp.StatusCode == http.StatusRequestTimeout ||
+			resp.StatusCode == http.StatusTooManyRequests ||
+			resp.StatusCode >= 500,
+	}
+
+	var envelope AcsErrorResponse
+	if json.Unmarshal(body, &envelope) == nil && envelope.Error.Code != "" {
+		e.Code = envelope.Error.Code
+		e.Message = envelope.Error.Message
+		e.Target = envelope.Error.Target
+	} else {
+		e.Message = strings.TrimSpace(string(body))
+	}
+
+	var err error = e
+	if after, ok := retry.ParseRetryAfter(resp.Header.Get("Retry-After")); ok {
+		err = retry.WithRetryAfter(err, after)
+	}
+	if resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusNotFound {
+		err = channel.Permanent(err)
+	}
+	return err
+}
+
+// sendWhatsAppMessage sends a text message through the ACS resource in cfg
+// and returns the receipts ACS issued. fromNumber is the WhatsApp channel
+// registration ID the message is sent from.
+func sendWhatsAppMessage(ctx context.Context, cfg ACSConfig, toNumber, fromNumber, body string) (*AcsSendResponse, error) {
+
+	var event AcsMessage
+
+	if toNumber == "" || fromNumber == "" || body == "" {
+		return nil, errWhatsAppParameters
+	}
+
+	event.ChannelRegistrationId = fromNumber
+	event.To = []string{toNumber}
+	event.Kind = "text"
+	event.Content = body
+
+	return sendACSMessage(ctx, cfg, event)
+}
+
+// sendWhatsAppTemplate sends a pre-approved template, which unlike text is
+// delivered outside the 24-hour customer service window.
+func sendWhatsAppTemplate(ctx context.Context, cfg ACSConfig, toNumber, fromNumber string, tmpl *channel.Template) (*AcsSendResponse, error) {
+	if toNumber == "" || fromNumber == "" {
+		return nil, errWhatsAppParameters
+	}
+	if err := tmpl.Validate(); err != nil {
+		return nil, channel.Permanent(err)
+	}
+
+	return sendACSMessage(ctx, cfg, AcsMessage{
+		ChannelRegistrationId: fromNumber,
+		To:                    []string{toNumber},
+		Kind:                  "template",
+		Template:              acsTemplate(tmpl),
+	})
+}
+
+// sendWhatsAppInteractive sends body with reply buttons. The id of the
+// button pressed comes back in the AdvancedMessageReceived event.
+func sendWhatsAppInteractive(ctx context.Context, cfg ACSConfig, toNumber, fromNumber, body string, interactive *channel.Interactive) (*AcsSendResponse, error) {
+	if toNumber == "" || fromNumber == "" {
+		return nil, errWhatsAppParameters
+	}
+	if body == "" {
+		return nil, channel.Permanent(fmt.Errorf("interactive message has no body"))
+	}
+	if err := interactive.Validate(); err != nil {
+		return nil, channel.Permanent(err)
+	}
+
+	msg := &AcsInteractiveMessage{
+		Body: AcsTextContent{Kind: "text", Text: body},
+		Action: AcsInteractiveAction{
+			Kind:    "whatsAppButtonAction",
+			Content: AcsButtonSet{Kind: "buttonSet"},
+		},
+	}
+	if interactive.Header != "" {
+		msg.Header = &AcsTextContent{Kind: "text", Text: interactive.Header}
+	}
+	if interactive.Footer != "" {
+		msg.Footer = &AcsTextContent{Kind: "text", Text: interactive.Footer}
+	}
+	for _, b := range interactive.Buttons {
+		msg.Action.Content.Buttons = append(msg.Action.Content.Buttons, AcsReplyButton{ID: b.ID, Title: b.Title})
+	}
+
+	return sendACSMessage(ctx, cfg, AcsMessage{
+		ChannelRegistrationId: fromNumber,
+		To:                    []string{toNumber},
+		Kind:                  "interactive",
+		InteractiveMessage:    msg,
+	})
+}
+
+// acsTemplate converts tmpl to the ACS format. Values are named after their
+// position unless the event named them.
+func acsTemplate(tmpl *channel.Template) *AcsTemplate {
+	t := &AcsTemplate{Name: tmpl.Name, Language: tmpl.Language}
+	bindings := &AcsTemplateBindings{Kind: "whatsApp"}
+
+	if h := tmpl.Header; h != nil {
+		t.Values = append(t.Values, AcsTemplateValue{Kind: h.Kind, Name: "header", URL: h.URL, Caption: h.Caption, FileName: h.FileName})
+		bindings.Header = append(bindings.Header, AcsBindingComponent{RefValue: "header"})
+	}
+	for i, p := range tmpl.Body {
+		name := p.Name
+		if name == "" {
+			name = fmt.Sprintf("body%d", i+1)
+		}
+		t.Values = append(t.Values, AcsTemplateValue{Kind: "text", Name: name, Text: p.Text})
+		bindings.Body = append(bindings.Body, AcsBindingComponent{RefValue: name})
+	}
+	for i, b := range tmpl.Buttons {
+		name := fmt.Sprintf("button%d", i+1)
+		value := AcsTemplateValue{Kind: "text", Name: name, Text: b.Text}
+		if b.Type == channel.ButtonQuickReply {
+			value = AcsTemplateValue{Kind: "quickAction", Name: name, Payload: b.Payload}
+		}
+		t.Values = append(t.Values, value)
+		bindings.Buttons = append(bindings.Buttons, AcsBindingButton{SubType: b.Type, RefValue: name})
+	}
+
+	if len(t.Values) > 0 {
+		t.Bindings = bindings
+	}
+	return t
+}
+
+// sendACSMessage posts event to the notifications:send API of cfg.
+func sendACSMessage(ctx context.Context, cfg ACSConfig, event AcsMessage) (*AcsSendResponse, error) {
+	tokens := acsTokenSource(cfg)
+	token, err := tokens.Token(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Error generating token: %w", err)
+	}
+
+	data, err := json.Marshal(event)
+
+	if err != nil {
+		return nil, err
+	}
+
+	bodyBuffer := bytes.NewBuffer(data)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.sendURL(event.Kind), bodyBuffer)
+
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := acsClient.Do(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		// The cached token was rejected; fetch a fresh one next time.
+		tokens.Invalidate()
+	}
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return nil, newACSError(resp, respBody)
+	}
+
+	var response AcsSendResponse
+	if err := json.Unmarshal(respBody, &response); err != nil {
+		// The message was accepted; only the receipt is missing.
+		log.Printf("Error decoding ACS response: %v", err)
+	}
+
+	log.Printf("WhatsApp %s message to %s accepted by ACS: %s", event.Kind, strings.Join(event.To, ","), response.MessageID())
+	return &response, nil
+}
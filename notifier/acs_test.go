@@ -0,0 +1,412 @@
+package notifier
+
+import (
+	"boh/notification-service/channel"
+	"boh/notification-service/correlation"
+	"boh/notification-service/retry"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeACS serves the Entra ID token endpoint and the ACS WhatsApp and SMS
+// send endpoints and records what it was sent.
+type fakeACS struct {
+	*httptest.Server
+
+	mu         sync.Mutex
+	tokenPaths []string
+	sendURLs   []string
+	messages   []map[string]any
+
+	status int
+	reply  string
+}
+
+func newFakeACS(t *testing.T) *fakeACS {
+	f := &fakeACS{status: http.StatusAccepted, reply: `{"receipts":[{"messageId":"msg-1","to":"+15551234567"}]}`}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeACS) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.URL.Path == "/messages/notifications:send" {
+		var msg map[string]any
+		json.NewDecoder(r.Body).Decode(&msg)
+		f.sendURLs = append(f.sendURLs, r.URL.String())
+		f.messages = append(f.messages, msg)
+		w.WriteHeader(f.status)
+		w.Write([]byte(f.reply))
+		return
+	}
+	if r.URL.Path == "/sms" {
+		var msg map[string]any
+		json.NewDecoder(r.Body).Decode(&msg)
+		f.sendURLs = append(f.sendURLs, r.URL.String())
+		f.messages = append(f.messages, msg)
+		w.WriteHeader(f.status)
+		w.Write([]byte(f.reply))
+		return
+	}
+
+	f.tokenPaths = append(f.tokenPaths, r.URL.Path)
+	w.Write([]byte(`{"access_token":"token","expires_in":3600}`))
+}
+
+// config returns settings that point every ACS call at the fake server.
+func (f *fakeACS) config() ACSConfig {
+	return ACSConfig{
+		TenantID:              "tenant-1",
+		ClientID:              "client-1",
+		ClientSecret:          "secret",
+		ChannelRegistrationID: "registration-1",
+		Endpoint:              f.URL,
+		AuthorityHost:         f.URL,
+		SMSFrom:               "+15550001111",
+	}
+}
+
+// TestSendWhatsAppMessage_UsesConfig tests that the tenant, endpoint, API version and channel registration come from the config
+func TestSendWhatsAppMessage_UsesConfig(t *testing.T) {
+	f := newFakeACS(t)
+	cfg := f.config()
+	cfg.APIVersion = "2025-01-01"
+
+	_, err := sendWhatsAppMessage(context.Background(), cfg, "+15551234567", cfg.ChannelRegistrationID, "hello")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(f.tokenPaths) != 1 || f.tokenPaths[0] != "/tenant-1/oauth2/v2.0/token" {
+		t.Errorf("Expected one token request for tenant-1, got %v", f.tokenPaths)
+	}
+	if len(f.sendURLs) != 1 || f.sendURLs[0] != "/messages/notifications:send?api-version=2025-01-01" {
+		t.Errorf("Expected one send with api-version 2025-01-01, got %v", f.sendURLs)
+	}
+	if got := f.messages[0]["channelRegistrationId"]; got != "registration-1" {
+		t.Errorf("Expected channelRegistrationId registration-1, got %v", got)
+	}
+}
+
+// TestWhatsAppChannel_BrandOverride tests that a brand's settings replace the defaults it overrides
+func TestWhatsAppChannel_BrandOverride(t *testing.T) {
+	f := newFakeACS(t)
+	SetACSConfig(f.config(), map[string]ACSConfig{
+		"Retail": {ChannelRegistrationID: "registration-retail"},
+	})
+	t.Cleanup(func() { SetACSConfig(ACSConfig{}, nil) })
+
+	event := NotificationEvent{
+		UserID:              "user123",
+		NotificationMessage: "Test message",
+		Channels:            []NotificationChannel{{Type: "whatsapp", Contact: "+15551234567"}},
+	}
+	if err := ProcessMessage(event); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	event.Brand = "retail"
+	if err := ProcessMessage(event); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(f.messages) != 2 {
+		t.Fatalf("Expected 2 sends, got %d", len(f.messages))
+	}
+	if got := f.messages[0]["channelRegistrationId"]; got != "registration-1" {
+		t.Errorf("Expected default registration for no brand, got %v", got)
+	}
+	if got := f.messages[1]["channelRegistrationId"]; got != "registration-retail" {
+		t.Errorf("Expected brand registration, got %v", got)
+	}
+}
+
+// TestLoadACSConfig tests that ACS_BRANDS selects the per-brand environment overrides
+func TestLoadACSConfig(t *testing.T) {
+	t.Setenv("ACS_TENANT_ID", "tenant-1")
+	t.Setenv("ACS_ENDPOINT", "https://dev.communication.azure.com")
+	t.Setenv("ACS_BRANDS", "boh-retail")
+	t.Setenv("ACS_BOH_RETAIL_ENDPOINT", "https://retail.communication.azure.com")
+	loadACSConfig()
+	t.Cleanup(func() { SetACSConfig(ACSConfig{}, nil) })
+
+	if got := acsConfigFor("").Endpoint; got != "https://dev.communication.azure.com" {
+		t.Errorf("Expected default endpoint, got %q", got)
+	}
+	cfg := acsConfigFor("BOH-Retail")
+	if cfg.Endpoint != "https://retail.communication.azure.com" || cfg.TenantID != "tenant-1" {
+		t.Errorf("Expected brand endpoint with default tenant, got %+v", cfg)
+	}
+}
+
+// TestSendWhatsAppMessage_ErrorEnvelope tests that a rejected send returns the parsed ACS error
+func TestSendWhatsAppMessage_ErrorEnvelope(t *testing.T) {
+	f := newFakeACS(t)
+	f.status = http.StatusBadRequest
+	f.reply = `{"error":{"code":"InvalidRecipient","message":"The recipient is not a WhatsApp user.","target":"to"}}`
+
+	_, err := sendWhatsAppMessage(context.Background(), f.config(), "+15551234567", "registration-1", "hello")
+
+	var acsErr *ACSError
+	if !errors.As(err, &acsErr) {
+		t.Fatalf("Expected *ACSError, got %v", err)
+	}
+	if acsErr.StatusCode != 400 || acsErr.Code != "InvalidRecipient" || acsErr.Target != "to" || acsErr.Retryable {
+		t.Errorf("Unexpected error fields: %+v", acsErr)
+	}
+	if !channel.IsPermanent(err) {
+		t.Error("Expected a 400 response to be permanent")
+	}
+}
+
+// TestNewACSError_Retryable tests which status codes are retried
+func TestNewACSError_Retryable(t *testing.T) {
+	tests := []struct {
+		status    int
+		retryable bool
+	}{
+		{http.StatusUnauthorized, true},
+		{http.StatusForbidden, false},
+		{http.StatusTooManyRequests, true},
+		{http.StatusInternalServerError, true},
+		{http.StatusServiceUnavailable, true},
+	}
+
+	for _, tt := range tests {
+		resp := &http.Response{StatusCode: tt.status, Header: http.Header{"Retry-After": {"2"}}}
+		err := newACSError(resp, []byte("not json"))
+
+		var acsErr *ACSError
+		if !errors.As(err, &acsErr) || acsErr.Retryable != tt.retryable {
+			t.Errorf("Status %d: expected retryable=%v, got %v", tt.status, tt.retryable, err)
+		}
+		if channel.IsPermanent(err) {
+			t.Errorf("Status %d: expected a non-permanent error", tt.status)
+		}
+		if after, ok := retry.RetryAfter(err); !ok || after != 2*time.Second {
+			t.Errorf("Status %d: expected Retry-After of 2s, got %v", tt.status, after)
+		}
+	}
+}
+
+// TestProcessMessageContext_WhatsAppReceipt tests that the ACS message ID is reported in the delivery result
+func TestProcessMessageContext_WhatsAppReceipt(t *testing.T) {
+	f := newFakeACS(t)
+	SetACSConfig(f.config(), nil)
+	t.Cleanup(func() { SetACSConfig(ACSConfig{}, nil) })
+
+	results, err := ProcessMessageContext(context.Background(), NotificationEvent{
+		NotificationMessage: "Test message",
+		Channels:            []NotificationChannel{{Type: "whatsapp", Contact: "+15551234567"}},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(results) != 1 || results[0].MessageID != "msg-1" {
+		t.Errorf("Expected message ID msg-1, got %+v", results)
+	}
+}
+
+// TestProcessMessageContext_WhatsAppFailure tests that a failed ACS send fails the message
+func TestProcessMessageContext_WhatsAppFailure(t *testing.T) {
+	f := newFakeACS(t)
+	f.status = http.StatusNotFound
+	f.reply = `{"error":{"code":"NotFound","message":"Channel registration not found."}}`
+	SetACSConfig(f.config(), nil)
+	t.Cleanup(func() { SetACSConfig(ACSConfig{}, nil) })
+
+	results, err := ProcessMessageContext(context.Background(), NotificationEvent{
+		NotificationMessage: "Test message",
+		Channels:            []NotificationChannel{{Type: "whatsapp", Contact: "+15551234567"}},
+	})
+
+	var acsErr *ACSError
+	if !errors.As(err, &acsErr) || acsErr.Code != "NotFound" {
+		t.Fatalf("Expected the ACS error, got %v", err)
+	}
+	if results[0].Status != channel.StatusFailed || results[0].ErrorClass != channel.ErrorClassPermanent {
+		t.Errorf("Expected a permanent failure, got %+v", results[0])
+	}
+}
+
+// TestMessageUnmarshalContext_WhatsAppTemplate tests that a template in the event is sent in the ACS template format
+func TestMessageUnmarshalContext_WhatsAppTemplate(t *testing.T) {
+	f := newFakeACS(t)
+	SetACSConfig(f.config(), nil)
+	t.Cleanup(func() { SetACSConfig(ACSConfig{}, nil) })
+
+	body := []byte(`{
+		"userId": "user123",
+		"channels": [{
+			"type": "whatsapp",
+			"contact": "+15551234567",
+			"template": {
+				"name": "transaction_update",
+				"language": "en_US",
+				"header": {"kind": "image", "url": "https://example.com/logo.png"},
+				"body": ["100.00", {"name": "merchant", "text": "Shop"}],
+				"buttons": [{"type": "quickReply", "payload": "not-me"}, {"type": "url", "text": "txn/42"}]
+			}
+		}]
+	}`)
+	if _, err := MessageUnmarshalContext(context.Background(), body); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var got struct {
+		Kind     string      `json:"kind"`
+		Template AcsTemplate `json:"template"`
+	}
+	data, _ := json.Marshal(f.messages[0])
+	json.Unmarshal(data, &got)
+
+	want := AcsTemplate{
+		Name:     "transaction_update",
+		Language: "en_US",
+		Values: []AcsTemplateValue{
+			{Kind: "image", Name: "header", URL: "https://example.com/logo.png"},
+			{Kind: "text", Name: "body1", Text: "100.00"},
+			{Kind: "text", Name: "merchant", Text: "Shop"},
+			{Kind: "quickAction", Name: "button1", Payload: "not-me"},
+			{Kind: "text", Name: "button2", Text: "txn/42"},
+		},
+		Bindings: &AcsTemplateBindings{
+			Kind:    "whatsApp",
+			Header:  []AcsBindingComponent{{RefValue: "header"}},
+			Body:    []AcsBindingComponent{{RefValue: "body1"}, {RefValue: "merchant"}},
+			Buttons: []AcsBindingButton{{SubType: "quickReply", RefValue: "button1"}, {SubType: "url", RefValue: "button2"}},
+		},
+	}
+	if got.Kind != "template" || !reflect.DeepEqual(got.Template, want) {
+		t.Errorf("Unexpected template message:\n got %+v\nwant %+v", got.Template, want)
+	}
+}
+
+// TestWhatsAppChannel_InvalidTemplate tests that an invalid template fails permanently without calling ACS
+func TestWhatsAppChannel_InvalidTemplate(t *testing.T) {
+	f := newFakeACS(t)
+	SetACSConfig(f.config(), nil)
+	t.Cleanup(func() { SetACSConfig(ACSConfig{}, nil) })
+
+	results, err := ProcessMessageContext(context.Background(), NotificationEvent{
+		Channels: []NotificationChannel{{Type: "whatsapp", Contact: "+15551234567", Template: &channel.Template{Name: "transaction_update"}}},
+	})
+	if !channel.IsPermanent(err) {
+		t.Fatalf("Expected a permanent error, got %v", err)
+	}
+	if results[0].Status != channel.StatusFailed || len(f.messages) != 0 {
+		t.Errorf("Expected a failed result and no sends, got %+v and %d sends", results[0], len(f.messages))
+	}
+}
+
+// TestWhatsAppChannel_EmptyBody tests that an event without a body fails permanently after one attempt
+func TestWhatsAppChannel_EmptyBody(t *testing.T) {
+	f := newFakeACS(t)
+	SetACSConfig(f.config(), nil)
+	t.Cleanup(func() { SetACSConfig(ACSConfig{}, nil) })
+
+	result := channel.Deliver(context.Background(), policies.Wrap(whatsAppChannel{}), channel.Notification{Contact: "+15551234567"})
+	if !channel.IsPermanent(result.Err()) || result.Attempts != 1 {
+		t.Errorf("Expected one permanent failure, got %+v", result)
+	}
+	if len(f.messages) != 0 {
+		t.Errorf("Expected no sends, got %d", len(f.messages))
+	}
+}
+
+// TestSendACSMessage_Timeout tests that a hung ACS endpoint fails the send instead of holding it
+func TestSendACSMessage_Timeout(t *testing.T) {
+	f := newFakeACS(t)
+	release := make(chan struct{})
+	hung := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer hung.Close()
+	defer close(release)
+	defer func(timeout time.Duration) { acsClient.Timeout = timeout }(acsClient.Timeout)
+	acsClient.Timeout = 50 * time.Millisecond
+
+	cfg := f.config()
+	cfg.Endpoint = hung.URL
+	start := time.Now()
+	if _, err := sendWhatsAppMessage(context.Background(), cfg, "+15551234567", cfg.ChannelRegistrationID, "hello"); err == nil || time.Since(start) > 2*time.Second {
+		t.Errorf("Expected a timeout, got %v after %v", err, time.Since(start))
+	}
+}
+
+// TestWhatsAppChannel_Interactive tests that reply buttons are sent and the message id is kept for correlating replies
+func TestWhatsAppChannel_Interactive(t *testing.T) {
+	f := newFakeACS(t)
+	SetACSConfig(f.config(), nil)
+	t.Cleanup(func() { SetACSConfig(ACSConfig{}, nil) })
+
+	store := correlation.NewMemoryStore(0)
+	SetCorrelationStore(store)
+	t.Cleanup(func() { SetCorrelationStore(correlation.NewMemoryStore(correlation.DefaultTTL)) })
+
+	body := []byte(`{
+		"notificationId": "fraud-1",
+		"userId": "user123",
+		"notificationMessage": "Did you spend $950.00 at Example Store?",
+		"channels": [{
+			"type": "whatsapp",
+			"contact": "+15551234567",
+			"interactive": {
+				"header": "Suspicious transaction",
+				"buttons": [{"id": "confirm", "title": "Yes, it was me"}, {"id": "block", "title": "No, block my card"}]
+			}
+		}]
+	}`)
+	if _, err := MessageUnmarshalContext(context.Background(), body); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var got struct {
+		Kind               string                `json:"kind"`
+		InteractiveMessage AcsInteractiveMessage `json:"interactiveMessage"`
+	}
+	data, _ := json.Marshal(f.messages[0])
+	json.Unmarshal(data, &got)
+	msg := got.InteractiveMessage
+	if got.Kind != "interactive" || msg.Body.Text != "Did you spend $950.00 at Example Store?" ||
+		msg.Header.Text != "Suspicious transaction" || msg.Action.Kind != "whatsAppButtonAction" ||
+		len(msg.Action.Content.Buttons) != 2 || msg.Action.Content.Buttons[1].ID != "block" {
+		t.Errorf("Unexpected interactive message: %s", data)
+	}
+
+	rec, ok, _ := store.Get(context.Background(), "msg-1")
+	if !ok || rec.NotificationID != "fraud-1" || rec.UserID != "user123" || rec.Contact != "+15551234567" {
+		t.Errorf("Expected a correlation record for msg-1, got %+v ok=%v", rec, ok)
+	}
+}
+
+// TestACSConfig_Missing tests that the settings needed to send are reported by name
+func TestACSConfig_Missing(t *testing.T) {
+	cfg := ACSConfig{TenantID: "tenant-1", ClientID: "client-1", Endpoint: "https://acs.example"}
+	if got := cfg.Missing(); !reflect.DeepEqual(got, []string{"APP_SECRET", "CHANNEL_REGISTRATION_ID"}) || cfg.Configured() {
+		t.Errorf("Unexpected missing settings: %v", got)
+	}
+	cfg.ClientSecret, cfg.ChannelRegistrationID = "secret", "registration-1"
+	if got := cfg.Missing(); len(got) != 0 || !cfg.Configured() {
+		t.Errorf("Expected a complete config, got missing %v", got)
+	}
+}
+
+// TestGetOauthToken_WrapsErrors tests that token request failures keep their cause
+func TestGetOauthToken_WrapsErrors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := getOauthToken(ctx, ACSConfig{TenantID: "tenant-1", AuthorityHost: "http://127.0.0.1:1"})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the context error to be wrapped, got %v", err)
+	}
+}
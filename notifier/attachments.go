@@ -0,0 +1,179 @@
+package notifier
+
+import (
+	"boh/notification-service/channel"
+	"boh/notification-service/email"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultMaxAttachmentBytes keeps messages under the 10 MB most relays
+// accept once base64 has grown the attachments by a third.
+const defaultMaxAttachmentBytes = 7 << 20
+
+var (
+	// attachmentDir is the only directory path attachments are read from
+	// (EMAIL_ATTACHMENT_DIR); path attachments are rejected when it is unset.
+	attachmentDir string
+	// maxAttachmentBytes caps the total size of one email's attachments
+	// (EMAIL_MAX_ATTACHMENT_BYTES).
+	maxAttachmentBytes int64 = defaultMaxAttachmentBytes
+)
+
+// attachmentClient downloads url attachments. Like mediaClient it stays on
+// https; the longer timeout allows for files of several megabytes.
+var attachmentClient = &http.Client{
+	Timeout:       60 * time.Second,
+	CheckRedirect: httpsRedirectsOnly,
+}
+
+func loadAttachmentConfig() {
+	attachmentDir = os.Getenv("EMAIL_ATTACHMENT_DIR")
+	maxAttachmentBytes = defaultMaxAttachmentBytes
+	if value := os.Getenv("EMAIL_MAX_ATTACHMENT_BYTES"); value != "" {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n <= 0 {
+			log.Printf("Invalid EMAIL_MAX_ATTACHMENT_BYTES %q, using %d", value, maxAttachmentBytes)
+		} else {
+			maxAttachmentBytes = n
+		}
+	}
+}
+
+// loadAttachments reads the content of every attachment. Invalid
+// attachments, missing files, plain http URLs and a total over
+// maxAttachmentBytes are permanent errors; other failed downloads are not.
+func loadAttachments(ctx context.Context, attachments []channel.Attachment) ([]email.Attachment, error) {
+	loaded := make([]email.Attachment, 0, len(attachments))
+	remaining := maxAttachmentBytes
+	for _, a := range attachments {
+		if err := a.Validate(); err != nil {
+			return nil, channel.Permanent(err)
+		}
+
+		out := email.Attachment{FileName: a.FileName, ContentType: a.ContentType, ContentID: a.ContentID}
+		var err error
+		switch {
+		case a.Content != nil:
+			out.Data = a.Content
+		case a.URL != "":
+			err = downloadAttachment(ctx, a.URL, remaining, &out)
+		default:
+			err = readAttachment(a.Path, remaining, &out)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		remaining -= int64(len(out.Data))
+		if remaining < 0 {
+			return nil, channel.Permanent(fmt.Errorf("attachments are larger than the %d byte limit", maxAttachmentBytes))
+		}
+		if out.ContentType == "" {
+			out.ContentType = mime.TypeByExtension(filepath.Ext(out.FileName))
+		}
+		loaded = append(loaded, out)
+	}
+	return loaded, nil
+}
+
+// fetchAttachments loads url and path attachments into memory once per
+// delivery, before the send and its retries, so a retried send does not
+// download them again.
+func fetchAttachments(ctx context.Context, attachments []channel.Attachment) ([]channel.Attachment, error) {
+	loaded, err := loadAttachments(ctx, attachments)
+	if err != nil {
+		return nil, err
+	}
+	fetched := make([]channel.Attachment, len(loaded))
+	for i, a := range loaded {
+		content := a.Data
+		if content == nil {
+			content = []byte{}
+		}
+		fetched[i] = channel.Attachment{FileName: a.FileName, ContentType: a.ContentType, Content: content, ContentID: a.ContentID}
+	}
+	return fetched, nil
+}
+
+// downloadAttachment fetches an attachment by URL, reading at most one byte
+// more than the remaining limit.
+func downloadAttachment(ctx context.Context, rawURL string, remaining int64, out *email.Attachment) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return channel.Permanent(fmt.Errorf("invalid attachment url %q", rawURL))
+	}
+	if u.Scheme != "https" {
+		return channel.Permanent(fmt.Errorf("attachment url %q must use https", u.Redacted()))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return channel.Permanent(fmt.Errorf("invalid attachment url %q: %w", rawURL, err))
+	}
+
+	resp, err := attachmentClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("attachment download failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone || resp.StatusCode == http.StatusForbidden {
+		return channel.Permanent(fmt.Errorf("attachment url returned status %d", resp.StatusCode))
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("attachment url returned status %d", resp.StatusCode)
+	}
+
+	out.Data, err = io.ReadAll(io.LimitReader(resp.Body, remaining+1))
+	if err != nil {
+		return fmt.Errorf("attachment download failed: %w", err)
+	}
+	if out.FileName == "" {
+		out.FileName = path.Base(u.Path)
+	}
+	if out.ContentType == "" {
+		out.ContentType = resp.Header.Get("Content-Type")
+	}
+	return nil
+}
+
+// readAttachment reads an attachment from attachmentDir. The path is
+// relative to that directory and may not leave it.
+func readAttachment(name string, remaining int64, out *email.Attachment) error {
+	if attachmentDir == "" {
+		return channel.Permanent(fmt.Errorf("path attachments are disabled, EMAIL_ATTACHMENT_DIR is not set"))
+	}
+	clean := filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return channel.Permanent(fmt.Errorf("attachment path %q is outside the attachment directory", name))
+	}
+
+	f, err := os.Open(filepath.Join(attachmentDir, clean))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return channel.Permanent(fmt.Errorf("attachment %q not found", name))
+		}
+		return fmt.Errorf("open attachment %q: %w", name, err)
+	}
+	defer f.Close()
+
+	out.Data, err = io.ReadAll(io.LimitReader(f, remaining+1))
+	if err != nil {
+		return fmt.Errorf("read attachment %q: %w", name, err)
+	}
+	if out.FileName == "" {
+		out.FileName = filepath.Base(clean)
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package notifier
+
+import (
+	"boh/notification-service/channel"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+// newAttachmentServer starts a TLS server that answers every request with
+// body, counting the requests in hits. attachmentClient trusts it for the
+// rest of the test.
+func newAttachmentServer(t *testing.T, body string, hits *int32) *httptest.Server {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(hits, 1)
+		w.Header().Set("Content-Type", "text/csv")
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+
+	transport := attachmentClient.Transport
+	attachmentClient.Transport = srv.Client().Transport
+	t.Cleanup(func() { attachmentClient.Transport = transport })
+	return srv
+}
+
+type flakyChannel struct {
+	name  string
+	sends int
+	sent  []channel.Notification
+}
+
+func (c *flakyChannel) Name() string                  { return c.name }
+func (c *flakyChannel) Validate(contact string) error { return nil }
+func (c *flakyChannel) Send(ctx context.Context, n channel.Notification) (channel.Receipt, error) {
+	c.sends++
+	if c.sends == 1 {
+		return channel.Receipt{}, errors.New("451 try again later")
+	}
+	c.sent = append(c.sent, n)
+	return channel.Receipt{Channel: c.name, Contact: n.Contact}, nil
+}
+
+// TestLoadAttachments tests that content is taken inline, from a URL and from the attachment directory
+func TestLoadAttachments(t *testing.T) {
+	var hits int32
+	srv := newAttachmentServer(t, "a,b\n1,2\n", &hits)
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "statement.pdf"), []byte("%PDF-1.7"), 0o600)
+	attachmentDir = dir
+	t.Cleanup(func() { attachmentDir = "" })
+
+	loaded, err := loadAttachments(context.Background(), []channel.Attachment{
+		{FileName: "logo.png", Content: []byte("png"), ContentID: "logo"},
+		{URL: srv.URL + "/exports/transactions.csv"},
+		{Path: "statement.pdf"},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if loaded[0].ContentType != "image/png" || loaded[0].ContentID != "logo" || string(loaded[0].Data) != "png" {
+		t.Errorf("Unexpected inline attachment: %+v", loaded[0])
+	}
+	if loaded[1].FileName != "transactions.csv" || loaded[1].ContentType != "text/csv" || string(loaded[1].Data) != "a,b\n1,2\n" {
+		t.Errorf("Unexpected downloaded attachment: %+v", loaded[1])
+	}
+	if loaded[2].FileName != "statement.pdf" || loaded[2].ContentType != "application/pdf" || string(loaded[2].Data) != "%PDF-1.7" {
+		t.Errorf("Unexpected file attachment: %+v", loaded[2])
+	}
+}
+
+// TestLoadAttachments_Rejected tests the attachments that fail permanently
+func TestLoadAttachments_Rejected(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "big.pdf"), make([]byte, 20), 0o600)
+	attachmentDir = dir
+	maxAttachmentBytes = 16
+	t.Cleanup(func() {
+		attachmentDir = ""
+		maxAttachmentBytes = defaultMaxAttachmentBytes
+	})
+
+	tests := []struct {
+		name       string
+		attachment channel.Attachment
+	}{
+		{"No content", channel.Attachment{FileName: "empty.pdf"}},
+		{"Two sources", channel.Attachment{Content: []byte("x"), Path: "big.pdf"}},
+		{"Outside the directory", channel.Attachment{Path: "../secrets.env"}},
+		{"Absolute path", channel.Attachment{Path: "/etc/passwd"}},
+		{"Missing file", channel.Attachment{Path: "missing.pdf"}},
+		{"Over the size limit", channel.Attachment{Path: "big.pdf"}},
+		{"Invalid url", channel.Attachment{URL: "file:///etc/passwd"}},
+		{"Plain http url", channel.Attachment{URL: "http://example.com/statement.pdf"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadAttachments(context.Background(), []channel.Attachment{tt.attachment})
+			if !channel.IsPermanent(err) {
+				t.Errorf("Expected a permanent error, got %v", err)
+			}
+		})
+	}
+}
+
+// TestLoadAttachments_DownloadLimit tests that a download over the size limit fails permanently
+func TestLoadAttachments_DownloadLimit(t *testing.T) {
+	var hits int32
+	srv := newAttachmentServer(t, "0123456789abcdefghij", &hits)
+	maxAttachmentBytes = 16
+	t.Cleanup(func() { maxAttachmentBytes = defaultMaxAttachmentBytes })
+
+	_, err := loadAttachments(context.Background(), []channel.Attachment{{URL: srv.URL + "/big.csv"}})
+	if !channel.IsPermanent(err) {
+		t.Errorf("Expected a permanent error, got %v", err)
+	}
+}
+
+// TestProcessMessage_AttachmentsDownloadedOnce tests that a retried send reuses the downloaded attachments
+func TestProcessMessage_AttachmentsDownloadedOnce(t *testing.T) {
+	t.Setenv("FLAKY-MAIL_RETRY_BASE_DELAY", "1ms")
+	var hits int32
+	srv := newAttachmentServer(t, "a,b\n1,2\n", &hits)
+	fc := &flakyChannel{name: "flaky-mail"}
+	if err := Register(fc); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	event := NotificationEvent{
+		UserID:              "user123",
+		NotificationMessage: "Your statement",
+		Channels: []NotificationChannel{
+			{Type: "flaky-mail", Contact: "a@example.com", Attachments: []channel.Attachment{{URL: srv.URL + "/transactions.csv"}}},
+		},
+	}
+	if err := ProcessMessage(event); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if fc.sends != 2 || len(fc.sent) != 1 {
+		t.Fatalf("Expected a retried send, got %d sends", fc.sends)
+	}
+	if hits != 1 {
+		t.Errorf("Expected 1 download, got %d", hits)
+	}
+	a := fc.sent[0].Attachments
+	if len(a) != 1 || a[0].URL != "" || string(a[0].Content) != "a,b\n1,2\n" || a[0].FileName != "transactions.csv" {
+		t.Errorf("Expected the downloaded attachment to be sent, got %+v", a)
+	}
+}
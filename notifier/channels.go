@@ -0,0 +1,137 @@
+package notifier
+
+import (
+	"boh/notification-service/channel"
+	"boh/notification-service/email"
+	"context"
+	"errors"
+)
+
+var registry = channel.NewRegistry()
+
+var (
+	errSMTPNotConfigured = errors.New("SMTP not configured")
+	errACSNotConfigured  = errors.New("ACS WhatsApp parameters not configured")
+	// errWhatsAppParameters rejects a send without a recipient, sender or
+	// body. The event is at fault, so it is not sent again.
+	errWhatsAppParameters = channel.Permanent(errors.New("parameters not configured for whatsApp messaging"))
+)
+
+// policies holds the retry policy and circuit breaker of each channel.
+var policies channel.Policies
+
+func init() {
+	for _, c := range []channel.Channel{emailChannel{}, whatsAppChannel{}, smsChannel{}} {
+		if err := registry.Register(c); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Register adds a channel provider to the notifier. Events name it in
+// their channels list like the built-in ones.
+func Register(c channel.Channel) error {
+	return registry.Register(c)
+}
+
+// Channels returns the names of the registered channel providers.
+func Channels() []string {
+	return registry.Names()
+}
+
+type emailChannel struct{}
+
+func (emailChannel) Name() string { return "email" }
+
+func (emailChannel) Validate(contact string) error {
+	return channel.ValidateEmail(contact)
+}
+
+func (emailChannel) Send(ctx context.Context, n channel.Notification) (channel.Receipt, error) {
+	receipt := channel.Receipt{Channel: "email", Contact: n.Contact}
+	if !smtpConfigured() {
+		return receipt, errSMTPNotConfigured
+	}
+
+	subject := n.Subject
+	if subject == "" {
+		subject = "Notification"
+	}
+
+	attachments, err := loadAttachments(ctx, n.Attachments)
+	if err != nil {
+		return receipt, err
+	}
+
+	return receipt, sendEmail(ctx, email.Message{
+		From:        smtpSender,
+		To:          []string{n.Contact},
+		Cc:          n.Cc,
+		Bcc:         n.Bcc,
+		ReplyTo:     n.ReplyTo,
+		Subject:     subject,
+		HTML:        n.Body,
+		Attachments: attachments,
+	})
+}
+
+// Retryable gives up on a missing SMTP configuration, on 5xx rejections,
+// which sendEmail marks permanent, and on failed logins, which wait for the
+// message's next delivery instead of hammering the server with the same
+// credentials.
+func (emailChannel) Retryable(err error) bool {
+	if errors.Is(err, errSMTPNotConfigured) || email.IsAuthError(err) {
+		return false
+	}
+	return !email.IsPermanent(err)
+}
+
+type whatsAppChannel struct{}
+
+func (whatsAppChannel) Name() string { return "whatsapp" }
+
+func (whatsAppChannel) Validate(contact string) error {
+	return channel.ValidatePhone(contact)
+}
+
+func (whatsAppChannel) Send(ctx context.Context, n channel.Notification) (channel.Receipt, error) {
+	receipt := channel.Receipt{Channel: "whatsapp", Contact: n.Contact}
+	cfg := acsConfigFor(n.Brand)
+	if !cfg.Configured() {
+		return receipt, errACSNotConfigured
+	}
+
+	if err := n.ValidateContent(); err != nil {
+		return receipt, channel.Permanent(err)
+	}
+
+	var resp *AcsSendResponse
+	var err error
+	switch {
+	case n.Template != nil:
+		resp, err = sendWhatsAppTemplate(ctx, cfg, n.Contact, cfg.ChannelRegistrationID, n.Template)
+	case n.Interactive != nil:
+		resp, err = sendWhatsAppInteractive(ctx, cfg, n.Contact, cfg.ChannelRegistrationID, n.Body, n.Interactive)
+	case n.Media != nil:
+		resp, err = sendWhatsAppMedia(ctx, cfg, n.Contact, cfg.ChannelRegistrationID, n.Media, n.Body)
+	default:
+		resp, err = sendWhatsAppMessage(ctx, cfg, n.Contact, cfg.ChannelRegistrationID, n.Body)
+	}
+	if err != nil {
+		return receipt, err
+	}
+	receipt.MessageID = resp.MessageID()
+	return receipt, nil
+}
+
+// Retryable retries network failures and the ACS responses marked retryable.
+func (whatsAppChannel) Retryable(err error) bool {
+	if errors.Is(err, errACSNotConfigured) {
+		return false
+	}
+	var acsErr *ACSError
+	if errors.As(err, &acsErr) {
+		return acsErr.Retryable
+	}
+	return true
+}
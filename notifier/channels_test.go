@@ -0,0 +1,182 @@
+package notifier
+
+import (
+	"boh/notification-service/channel"
+	"boh/notification-service/delivery"
+	"context"
+	"errors"
+	"fmt"
+	"net/textproto"
+	"testing"
+)
+
+type recordingChannel struct {
+	name string
+	sent []channel.Notification
+}
+
+func (c *recordingChannel) Name() string                  { return c.name }
+func (c *recordingChannel) Validate(contact string) error { return nil }
+func (c *recordingChannel) Send(ctx context.Context, n channel.Notification) (channel.Receipt, error) {
+	c.sent = append(c.sent, n)
+	return channel.Receipt{Channel: c.name, Contact: n.Contact}, nil
+}
+
+// TestRegister_DefaultChannels tests that email and whatsapp are registered by default
+func TestRegister_DefaultChannels(t *testing.T) {
+	for _, name := range []string{"email", "whatsapp"} {
+		if _, ok := registry.Lookup(name); !ok {
+			t.Errorf("Expected %s channel to be registered", name)
+		}
+	}
+}
+
+// TestProcessMessage_RegisteredChannel tests that ProcessMessage dispatches to a registered provider
+func TestProcessMessage_RegisteredChannel(t *testing.T) {
+	rc := &recordingChannel{name: "test-channel"}
+	if err := Register(rc); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	event := NotificationEvent{
+		UserID:              "user123",
+		NotificationMessage: "Test message",
+		Channels: []NotificationChannel{
+			{Type: "TEST-CHANNEL", Contact: "contact-1"},
+		},
+	}
+
+	if err := ProcessMessage(event); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(rc.sent) != 1 {
+		t.Fatalf("Expected 1 send, got: %d", len(rc.sent))
+	}
+	if rc.sent[0].Contact != "contact-1" || rc.sent[0].Body != "Test message" {
+		t.Errorf("Unexpected notification: %+v", rc.sent[0])
+	}
+}
+
+// TestRegister_Duplicate tests that a built-in channel cannot be registered twice
+func TestRegister_Duplicate(t *testing.T) {
+	if err := Register(emailChannel{}); err == nil {
+		t.Error("Expected error registering duplicate email channel, got nil")
+	}
+}
+
+// TestMessageUnmarshal_InvalidJSONIsPermanent tests that malformed payloads are classified as permanent
+func TestMessageUnmarshal_InvalidJSONIsPermanent(t *testing.T) {
+	err := MessageUnmarshal([]byte(`{"invalid json"}`))
+	if !channel.IsPermanent(err) {
+		t.Errorf("Expected permanent error, got: %v", err)
+	}
+}
+
+// TestProcessMessage_InvalidContactIsPermanent tests that invalid contacts are classified as permanent
+func TestProcessMessage_InvalidContactIsPermanent(t *testing.T) {
+	event := NotificationEvent{
+		UserID:              "user123",
+		NotificationMessage: "Test message",
+		Channels: []NotificationChannel{
+			{Type: "email", Contact: "not-an-email"},
+		},
+	}
+
+	err := ProcessMessage(event)
+	if !channel.IsPermanent(err) {
+		t.Errorf("Expected permanent error, got: %v", err)
+	}
+}
+
+// TestIsPermanentSMTPError tests classification of SMTP reply codes
+func TestIsPermanentSMTPError(t *testing.T) {
+	tests := []struct {
+		err       error
+		permanent bool
+	}{
+		{&textproto.Error{Code: 550, Msg: "mailbox unavailable"}, true},
+		{fmt.Errorf("wrapped: %w", &textproto.Error{Code: 553, Msg: "bad address"}), true},
+		{&textproto.Error{Code: 421, Msg: "try again later"}, false},
+		{&textproto.Error{Code: 554, Msg: "5.7.1 message rejected as spam"}, true},
+		{&textproto.Error{Code: 501, Msg: "5.5.4 syntax error"}, true},
+		{&textproto.Error{Code: 535, Msg: "auth failed"}, false},
+		{&textproto.Error{Code: 530, Msg: "5.7.0 authentication required"}, false},
+		{errors.New("dial tcp: i/o timeout"), false},
+	}
+
+	for _, tt := range tests {
+		if got := isPermanentSMTPError(tt.err); got != tt.permanent {
+			t.Errorf("isPermanentSMTPError(%v) = %v, want %v", tt.err, got, tt.permanent)
+		}
+	}
+}
+
+// TestProcessMessage_SkipsAlreadyDelivered tests that a redelivered event does not resend a sent channel
+func TestProcessMessage_SkipsAlreadyDelivered(t *testing.T) {
+	rc := &recordingChannel{name: "dedup-channel"}
+	if err := Register(rc); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	SetDeliveryStore(delivery.NewMemoryStore(delivery.DefaultTTL))
+
+	event := NotificationEvent{
+		NotificationID:      "notif-1",
+		UserID:              "user123",
+		NotificationMessage: "Test message",
+		Channels: []NotificationChannel{
+			{Type: "dedup-channel", Contact: "contact-1"},
+		},
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := ProcessMessage(event); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+	}
+	if len(rc.sent) != 1 {
+		t.Errorf("Expected 1 send across redeliveries, got: %d", len(rc.sent))
+	}
+
+	event.NotificationID = ""
+	ProcessMessage(event)
+	ProcessMessage(event)
+	if len(rc.sent) != 3 {
+		t.Errorf("Expected events without notificationId to always send, got: %d sends", len(rc.sent))
+	}
+}
+
+// TestProcessMessageContext_ContinuesAfterFailure tests that every channel is attempted and reported
+func TestProcessMessageContext_ContinuesAfterFailure(t *testing.T) {
+	rc := &recordingChannel{name: "results-channel"}
+	if err := Register(rc); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	event := NotificationEvent{
+		UserID:              "user123",
+		NotificationMessage: "Test message",
+		Channels: []NotificationChannel{
+			{Type: "email", Contact: "not-an-email"},
+			{Type: "results-channel", Contact: "contact-1"},
+			{Type: "carrier-pigeon", Contact: "roof"},
+		},
+	}
+
+	results, err := ProcessMessageContext(context.Background(), event)
+
+	if !channel.IsPermanent(err) {
+		t.Errorf("Expected permanent error for invalid email, got: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got: %d", len(results))
+	}
+	want := []string{channel.StatusFailed, channel.StatusSent, channel.StatusUnsupported}
+	for i, status := range want {
+		if results[i].Status != status {
+			t.Errorf("Result %d: expected status %s, got: %s", i, status, results[i].Status)
+		}
+	}
+	if len(rc.sent) != 1 {
+		t.Errorf("Expected the channel after the failure to be sent, got %d sends", len(rc.sent))
+	}
+}
@@ -0,0 +1,40 @@
+package notifier
+
+import (
+	"boh/notification-service/channel"
+	"boh/notification-service/correlation"
+	"context"
+	"log"
+	"time"
+)
+
+// correlations maps the message id of every interactive message sent to
+// its notification, so replies can be traced back.
+var correlations correlation.Store = correlation.NewMemoryStore(correlation.DefaultTTL)
+
+// SetCorrelationStore replaces the default in-memory correlation store with
+// the one /webhooks/acs looks replies up in.
+func SetCorrelationStore(s correlation.Store) {
+	correlations = s
+}
+
+// recordCorrelation stores the message id of an interactive message. A
+// failed write loses the link for the reply, not the question, so it is
+// logged and the delivery still counts as sent.
+func recordCorrelation(ctx context.Context, event NotificationEvent, result channel.DeliveryResult) {
+	if result.MessageID == "" {
+		log.Printf("No message id for interactive %s message to %s; replies cannot be correlated", result.Channel, result.Contact)
+		return
+	}
+	rec := correlation.Record{
+		MessageID:      result.MessageID,
+		NotificationID: event.NotificationID,
+		UserID:         event.UserID,
+		Channel:        result.Channel,
+		Contact:        result.Contact,
+		CreatedAt:      time.Now().UTC(),
+	}
+	if err := correlations.Put(ctx, rec); err != nil {
+		log.Printf("Error recording correlation for message %s: %v", result.MessageID, err)
+	}
+}
@@ -0,0 +1,46 @@
+package notifier
+
+import (
+	"boh/notification-service/channel"
+	"boh/notification-service/delivery"
+	"context"
+	"log"
+	"time"
+)
+
+// deliveries records which (notificationId, channel, contact) triples have
+// been sent so Service Bus redeliveries do not notify the user twice.
+var deliveries delivery.Store = delivery.NewMemoryStore(delivery.DefaultTTL)
+
+// SetDeliveryStore replaces the default in-memory delivery store, for example
+// with the file store that survives restarts.
+func SetDeliveryStore(s delivery.Store) {
+	deliveries = s
+}
+
+// alreadySent reports whether key was delivered by an earlier attempt.
+// Events without a notification id cannot be deduplicated.
+func alreadySent(ctx context.Context, key delivery.Key) (bool, error) {
+	if key.NotificationID == "" {
+		return false, nil
+	}
+	return delivery.IsSent(ctx, deliveries, key)
+}
+
+// recordSent stores a successful delivery. A failed write is logged rather
+// than returned: the other channels of the event still go out, and only a
+// redelivery of this event would repeat this one.
+func recordSent(ctx context.Context, key delivery.Key, receipt channel.Receipt) {
+	if key.NotificationID == "" {
+		return
+	}
+	rec := delivery.Record{
+		Key:       key,
+		Status:    delivery.StatusSent,
+		MessageID: receipt.MessageID,
+		UpdatedAt: time.Now().UTC(),
+	}
+	if err := deliveries.Put(ctx, rec); err != nil {
+		log.Printf("Error recording delivery %s: %v", key, err)
+	}
+}
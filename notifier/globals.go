@@ -1,24 +1,138 @@
 package notifier
 
+import "boh/notification-service/channel"
+
 type NotificationChannel struct {
-	Type    string `json:"type"`
-	Contact string `json:"contact"`
+	Type        string               `json:"type"`
+	Contact     string               `json:"contact"`
+	Template    *channel.Template    `json:"template,omitempty"`
+	Media       *channel.Media       `json:"media,omitempty"`
+	Interactive *channel.Interactive `json:"interactive,omitempty"`
+	Attachments []channel.Attachment `json:"attachments,omitempty"`
+	Cc          []string             `json:"cc,omitempty"`
+	Bcc         []string             `json:"bcc,omitempty"`
+	ReplyTo     []string             `json:"replyTo,omitempty"`
 }
 
 type NotificationEvent struct {
+	NotificationID      string                `json:"notificationId"`
 	UserID              string                `json:"userId"`
+	Brand               string                `json:"brand,omitempty"`
 	NotificationMessage string                `json:"notificationMessage"`
 	Channels            []NotificationChannel `json:"channels"`
 }
 
+// DeliveryReport is the outcome of one NotificationEvent, published to the
+// results queue so upstream services know what was delivered.
+type DeliveryReport struct {
+	NotificationID string                   `json:"notificationId"`
+	UserID         string                   `json:"userId"`
+	Results        []channel.DeliveryResult `json:"results"`
+}
+
 type OauthTokenResponse struct {
 	AccessToken string `json:"access_token"`
 	ExpiresIn   int    `json:"expires_in"`
 }
 
 type AcsMessage struct {
-	ChannelRegistrationId string   `json:"channelRegistrationId"`
-	To                    []string `json:"to"`
-	Kind                  string   `"json:"kind"`
-	Content               string   `json:"content"`
+	ChannelRegistrationId string                 `json:"channelRegistrationId"`
+	To                    []string               `json:"to"`
+	Kind                  string                 `json:"kind"`
+	Content               string                 `json:"content,omitempty"`
+	MediaUri              string                 `json:"mediaUri,omitempty"`
+	Caption               string                 `json:"caption,omitempty"`
+	FileName              string                 `json:"fileName,omitempty"`
+	Template              *AcsTemplate           `json:"template,omitempty"`
+	InteractiveMessage    *AcsInteractiveMessage `json:"interactiveMessage,omitempty"`
+}
+
+// AcsInteractiveMessage is a WhatsApp message with reply buttons.
+type AcsInteractiveMessage struct {
+	Header *AcsTextContent      `json:"header,omitempty"`
+	Body   AcsTextContent       `json:"body"`
+	Footer *AcsTextContent      `json:"footer,omitempty"`
+	Action AcsInteractiveAction `json:"action"`
+}
+
+type AcsTextContent struct {
+	Kind string `json:"kind"`
+	Text string `json:"text"`
+}
+
+type AcsInteractiveAction struct {
+	Kind    string       `json:"kind"`
+	Content AcsButtonSet `json:"content"`
+}
+
+type AcsButtonSet struct {
+	Kind    string           `json:"kind"`
+	Buttons []AcsReplyButton `json:"buttons"`
+}
+
+type AcsReplyButton struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+}
+
+// AcsTemplate is a WhatsApp template in the ACS notifications:send format:
+// every value is declared once by name and referenced from the bindings.
+type AcsTemplate struct {
+	Name     string               `json:"name"`
+	Language string               `json:"language"`
+	Values   []AcsTemplateValue   `json:"values,omitempty"`
+	Bindings *AcsTemplateBindings `json:"bindings,omitempty"`
+}
+
+type AcsTemplateValue struct {
+	Kind     string `json:"kind"`
+	Name     string `json:"name"`
+	Text     string `json:"text,omitempty"`
+	URL      string `json:"url,omitempty"`
+	Caption  string `json:"caption,omitempty"`
+	FileName string `json:"fileName,omitempty"`
+	Payload  string `json:"payload,omitempty"`
+}
+
+type AcsTemplateBindings struct {
+	Kind    string                `json:"kind"`
+	Header  []AcsBindingComponent `json:"header,omitempty"`
+	Body    []AcsBindingComponent `json:"body,omitempty"`
+	Buttons []AcsBindingButton    `json:"buttons,omitempty"`
+}
+
+type AcsBindingComponent struct {
+	RefValue string `json:"refValue"`
+}
+
+type AcsBindingButton struct {
+	SubType  string `json:"subType"`
+	RefValue string `json:"refValue"`
+}
+
+// AcsSendResponse is the body of an accepted ACS Advanced Messaging send.
+type AcsSendResponse struct {
+	Receipts []AcsReceipt `json:"receipts"`
+}
+
+// MessageID returns the ID of the first receipt, or "" if there is none.
+func (r *AcsSendResponse) MessageID() string {
+	if r == nil || len(r.Receipts) == 0 {
+		return ""
+	}
+	return r.Receipts[0].MessageID
+}
+
+type AcsReceipt struct {
+	MessageID string `json:"messageId"`
+	To        string `json:"to"`
+}
+
+// AcsErrorResponse is the error envelope returned with non-2xx responses.
+type AcsErrorResponse struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+		Target  string `json:"target"`
+	} `json:"error"`
 }
@@ -0,0 +1,169 @@
+package notifier
+
+import (
+	"boh/notification-service/channel"
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// mediaClient looks up media URLs taken from events. It only follows
+// redirects to https URLs, and its timeout keeps a slow or unresponsive
+// server from holding a worker.
+var mediaClient = &http.Client{
+	Timeout:       10 * time.Second,
+	CheckRedirect: httpsRedirectsOnly,
+}
+
+// httpsRedirectsOnly is an http.Client CheckRedirect that refuses to leave
+// https.
+func httpsRedirectsOnly(req *http.Request, via []*http.Request) error {
+	if req.URL.Scheme != "https" {
+		return fmt.Errorf("redirect to non-https url %q", req.URL.Redacted())
+	}
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	return nil
+}
+
+// mediaLimit is what WhatsApp accepts for one media kind.
+type mediaLimit struct {
+	types   []string
+	maxSize int64
+}
+
+// whatsAppMedia lists the MIME types and sizes WhatsApp accepts per kind.
+var whatsAppMedia = map[string]mediaLimit{
+	channel.MediaImage: {
+		types:   []string{"image/jpeg", "image/png"},
+		maxSize: 5 << 20,
+	},
+	channel.MediaVideo: {
+		types:   []string{"video/mp4", "video/3gpp"},
+		maxSize: 16 << 20,
+	},
+	channel.MediaDocument: {
+		types: []string{
+			"application/pdf",
+			"text/plain",
+			"application/msword",
+			"application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+			"application/vnd.ms-excel",
+			"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+			"application/vnd.ms-powerpoint",
+			"application/vnd.openxmlformats-officedocument.presentationml.presentation",
+		},
+		maxSize: 100 << 20,
+	},
+}
+
+// validateWhatsAppMedia checks m against the WhatsApp limits for its kind.
+// When the event does not give the MIME type or size they are taken from a
+// HEAD request to the media URL, which must be https. Media whose size
+// cannot be found out either way is rejected, since it cannot be checked.
+func validateWhatsAppMedia(ctx context.Context, m *channel.Media) error {
+	limit, ok := whatsAppMedia[m.Kind]
+	if !ok {
+		return channel.Permanent(fmt.Errorf("unsupported media kind %q", m.Kind))
+	}
+	u, err := url.Parse(m.URL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return channel.Permanent(fmt.Errorf("invalid media url %q, an https url is required", m.URL))
+	}
+
+	mimeType, size := m.MIMEType, m.Size
+	if mimeType == "" || size == 0 {
+		headType, headSize, err := headMedia(ctx, m.URL)
+		if err != nil {
+			return err
+		}
+		if mimeType == "" {
+			mimeType = headType
+		}
+		if size == 0 {
+			size = headSize
+		}
+	}
+
+	if mediaType, _, err := mime.ParseMediaType(mimeType); err == nil {
+		mimeType = mediaType
+	}
+	supported := false
+	for _, t := range limit.types {
+		if strings.EqualFold(t, mimeType) {
+			supported = true
+			break
+		}
+	}
+	if !supported {
+		return channel.Permanent(fmt.Errorf("unsupported %s type %q", m.Kind, mimeType))
+	}
+	if size <= 0 {
+		return channel.Permanent(fmt.Errorf("size of %s %q is unknown, set media.size", m.Kind, m.URL))
+	}
+	if size > limit.maxSize {
+		return channel.Permanent(fmt.Errorf("%s is %d bytes, larger than the %d byte limit", m.Kind, size, limit.maxSize))
+	}
+	return nil
+}
+
+// headMedia returns the Content-Type and Content-Length of the media at
+// mediaURL. The size is 0 when the server does not report it.
+func headMedia(ctx context.Context, mediaURL string) (string, int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, mediaURL, nil)
+	if err != nil {
+		return "", 0, channel.Permanent(fmt.Errorf("invalid media url %q: %w", mediaURL, err))
+	}
+
+	resp, err := mediaClient.Do(req)
+	if err != nil {
+		return "", 0, fmt.Errorf("media lookup failed: %w", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone || resp.StatusCode == http.StatusForbidden {
+		return "", 0, channel.Permanent(fmt.Errorf("media url returned status %d", resp.StatusCode))
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return "", 0, fmt.Errorf("media url returned status %d", resp.StatusCode)
+	}
+
+	size := resp.ContentLength
+	if size < 0 {
+		size = 0
+	}
+	return resp.Header.Get("Content-Type"), size, nil
+}
+
+// sendWhatsAppMedia sends an image, document or video by URL. The media's
+// caption is used if it has one, otherwise caption.
+func sendWhatsAppMedia(ctx context.Context, cfg ACSConfig, toNumber, fromNumber string, m *channel.Media, caption string) (*AcsSendResponse, error) {
+	if toNumber == "" || fromNumber == "" {
+		return nil, errWhatsAppParameters
+	}
+	if err := validateWhatsAppMedia(ctx, m); err != nil {
+		return nil, err
+	}
+	if m.Caption != "" {
+		caption = m.Caption
+	}
+
+	event := AcsMessage{
+		ChannelRegistrationId: fromNumber,
+		To:                    []string{toNumber},
+		Kind:                  m.Kind,
+		MediaUri:              m.URL,
+		Caption:               caption,
+	}
+	if m.Kind == channel.MediaDocument {
+		event.FileName = m.FileName
+	}
+
+	return sendACSMessage(ctx, cfg, event)
+}
@@ -0,0 +1,137 @@
+package notifier
+
+import (
+	"boh/notification-service/channel"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// newMediaServer serves HEAD requests for /statement.pdf over TLS with the
+// given type and size, leaving Content-Length out when size is negative.
+// mediaClient trusts it for the rest of the test.
+func newMediaServer(t *testing.T, contentType string, size int) *httptest.Server {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/statement.pdf":
+		case "/plain":
+			http.Redirect(w, r, "http://example.com/statement.pdf", http.StatusFound)
+			return
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		if size >= 0 {
+			w.Header().Set("Content-Length", strconv.Itoa(size))
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	transport := mediaClient.Transport
+	mediaClient.Transport = srv.Client().Transport
+	t.Cleanup(func() { mediaClient.Transport = transport })
+	return srv
+}
+
+// TestValidateWhatsAppMedia tests the MIME type and size checks, with and without a HEAD lookup
+func TestValidateWhatsAppMedia(t *testing.T) {
+	pdf := newMediaServer(t, "application/pdf", 1024)
+	huge := newMediaServer(t, "image/png", 6<<20)
+	unsized := newMediaServer(t, "application/pdf", -1)
+
+	tests := []struct {
+		name      string
+		media     channel.Media
+		wantErr   bool
+		permanent bool
+	}{
+		{"declared document", channel.Media{Kind: channel.MediaDocument, URL: "https://example.com/a.pdf", MIMEType: "application/pdf", Size: 1024}, false, false},
+		{"looked up document", channel.Media{Kind: channel.MediaDocument, URL: pdf.URL + "/statement.pdf"}, false, false},
+		{"looked up type wrong kind", channel.Media{Kind: channel.MediaImage, URL: pdf.URL + "/statement.pdf"}, true, true},
+		{"looked up image too large", channel.Media{Kind: channel.MediaImage, URL: huge.URL + "/statement.pdf"}, true, true},
+		{"declared video too large", channel.Media{Kind: channel.MediaVideo, URL: "https://example.com/a.mp4", MIMEType: "video/mp4", Size: 17 << 20}, true, true},
+		{"missing media", channel.Media{Kind: channel.MediaDocument, URL: pdf.URL + "/missing.pdf"}, true, true},
+		{"unsupported kind", channel.Media{Kind: "sticker", URL: "https://example.com/a.webp"}, true, true},
+		{"invalid url", channel.Media{Kind: channel.MediaImage, URL: "ftp://example.com/a.png", MIMEType: "image/png", Size: 1}, true, true},
+		{"plain http url", channel.Media{Kind: channel.MediaImage, URL: "http://example.com/a.png", MIMEType: "image/png", Size: 1}, true, true},
+		{"unknown size", channel.Media{Kind: channel.MediaDocument, URL: unsized.URL + "/statement.pdf"}, true, true},
+		{"redirect to http", channel.Media{Kind: channel.MediaDocument, URL: pdf.URL + "/plain"}, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateWhatsAppMedia(context.Background(), &tt.media)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error=%v, got %v", tt.wantErr, err)
+			}
+			if err != nil && channel.IsPermanent(err) != tt.permanent {
+				t.Errorf("Expected permanent=%v, got %v", tt.permanent, err)
+			}
+		})
+	}
+}
+
+// TestWhatsAppChannel_Media tests that a media event is sent with its URI, caption and file name
+func TestWhatsAppChannel_Media(t *testing.T) {
+	f := newFakeACS(t)
+	SetACSConfig(f.config(), nil)
+	t.Cleanup(func() { SetACSConfig(ACSConfig{}, nil) })
+	pdf := newMediaServer(t, "application/pdf", 1024)
+
+	body := []byte(`{
+		"notificationMessage": "Your statement is ready",
+		"channels": [{
+			"type": "whatsapp",
+			"contact": "+15551234567",
+			"media": {"kind": "document", "url": "` + pdf.URL + `/statement.pdf", "fileName": "statement.pdf"}
+		}]
+	}`)
+	if _, err := MessageUnmarshalContext(context.Background(), body); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	msg := f.messages[0]
+	if msg["kind"] != "document" || msg["mediaUri"] != pdf.URL+"/statement.pdf" ||
+		msg["caption"] != "Your statement is ready" || msg["fileName"] != "statement.pdf" {
+		t.Errorf("Unexpected media message: %v", msg)
+	}
+}
+
+// TestWhatsAppChannel_TemplateWithMedia tests that a template and media in one channel are rejected instead of dropping the media
+func TestWhatsAppChannel_TemplateWithMedia(t *testing.T) {
+	f := newFakeACS(t)
+	SetACSConfig(f.config(), nil)
+	t.Cleanup(func() { SetACSConfig(ACSConfig{}, nil) })
+
+	_, err := whatsAppChannel{}.Send(context.Background(), channel.Notification{
+		Contact:  "+15551234567",
+		Template: &channel.Template{Name: "statement", Language: "en_US"},
+		Media:    &channel.Media{Kind: channel.MediaDocument, URL: "https://example.com/a.pdf"},
+	})
+	if !channel.IsPermanent(err) || len(f.messages) != 0 {
+		t.Errorf("Expected a permanent error and nothing sent, got %v and %d messages", err, len(f.messages))
+	}
+}
+
+// TestACSConfig_SendURL tests the api-version chosen for each message kind
+func TestACSConfig_SendURL(t *testing.T) {
+	cfg := ACSConfig{Endpoint: "https://acs.example/"}
+	for kind, want := range map[string]string{
+		"text":        defaultACSAPIVersion,
+		"document":    defaultACSAPIVersion,
+		"video":       defaultACSAPIVersion,
+		"interactive": acsInteractiveAPIVersion,
+	} {
+		if got := cfg.sendURL(kind); got != "https://acs.example/messages/notifications:send?api-version="+want {
+			t.Errorf("sendURL(%s) = %s", kind, got)
+		}
+	}
+
+	cfg.APIVersion = "2025-06-01"
+	if got := cfg.sendURL("interactive"); got != "https://acs.example/messages/notifications:send?api-version=2025-06-01" {
+		t.Errorf("Expected ACS_API_VERSION to apply to every kind, got %s", got)
+	}
+}
@@ -0,0 +1,222 @@
+package notifier
+
+import (
+	"boh/notification-service/channel"
+	"boh/notification-service/sms"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// acsSMSAPIVersion is the ACS SMS API version, which is versioned
+// separately from Advanced Messaging.
+const acsSMSAPIVersion = "2021-03-07"
+
+var errSMSNotConfigured = errors.New("SMS provider not configured")
+
+var (
+	// smsProvider is selected by SMS_PROVIDER; nil disables the channel.
+	smsProvider sms.Provider
+	// smsFrom is the sender for providers without their own (SMS_FROM).
+	smsFrom string
+	// smsCostPerSegment prices the estimate reported with each SMS
+	// (SMS_COST_PER_SEGMENT).
+	smsCostPerSegment float64
+)
+
+// loadSMSConfig selects the SMS provider: "acs", "http", or, when
+// SMS_PROVIDER is unset, the HTTP gateway if SMS_PROVIDER_URL is set and
+// ACS if ACS_SMS_FROM is.
+func loadSMSConfig() {
+	smsFrom = os.Getenv("SMS_FROM")
+	smsCostPerSegment = 0
+	if value := os.Getenv("SMS_COST_PER_SEGMENT"); value != "" {
+		cost, err := strconv.ParseFloat(value, 64)
+		if err != nil || cost < 0 {
+			log.Printf("Invalid SMS_COST_PER_SEGMENT %q, not estimating SMS cost", value)
+		} else {
+			smsCostPerSegment = cost
+		}
+	}
+
+	kind := os.Getenv("SMS_PROVIDER")
+	if kind == "" {
+		switch {
+		case os.Getenv("SMS_PROVIDER_URL") != "":
+			kind = "http"
+		case acsConfig.SMSFrom != "":
+			kind = "acs"
+		}
+	}
+
+	switch kind {
+	case "http":
+		smsProvider = &sms.HTTPGateway{
+			URL:        os.Getenv("SMS_PROVIDER_URL"),
+			APIKey:     os.Getenv("SMS_PROVIDER_API_KEY"),
+			AuthHeader: os.Getenv("SMS_PROVIDER_AUTH_HEADER"),
+		}
+	case "acs":
+		smsProvider = acsSMSProvider{}
+	case "":
+		smsProvider = nil
+		log.Println("Warning: no SMS provider configured. SMS will be disabled.")
+	default:
+		smsProvider = nil
+		log.Printf("Warning: unknown SMS_PROVIDER %q. SMS will be disabled.", kind)
+	}
+}
+
+// SetSMSProvider replaces the provider selected by SMS_PROVIDER.
+func SetSMSProvider(p sms.Provider) {
+	smsProvider = p
+}
+
+type smsChannel struct{}
+
+func (smsChannel) Name() string { return "sms" }
+
+func (smsChannel) Validate(contact string) error {
+	return channel.ValidateE164(contact)
+}
+
+func (smsChannel) Send(ctx context.Context, n channel.Notification) (channel.Receipt, error) {
+	receipt := channel.Receipt{Channel: "sms", Contact: n.Contact}
+	if smsProvider == nil {
+		return receipt, errSMSNotConfigured
+	}
+	if n.Body == "" {
+		return receipt, channel.Permanent(fmt.Errorf("SMS body is empty"))
+	}
+
+	encoding, segments := sms.Segments(n.Body)
+	receipt.Segments = segments
+	receipt.EstimatedCost = float64(segments) * smsCostPerSegment
+
+	id, err := smsProvider.Send(ctx, sms.Message{Brand: n.Brand, From: smsFrom, To: n.Contact, Body: n.Body})
+	if err != nil {
+		return receipt, err
+	}
+	receipt.MessageID = id
+	log.Printf("SMS to %s sent through %s as %d %s segment(s)", n.Contact, smsProvider.Name(), segments, encoding)
+	return receipt, nil
+}
+
+// Retryable retries network failures and provider throttling and outages.
+func (smsChannel) Retryable(err error) bool {
+	if errors.Is(err, errSMSNotConfigured) || errors.Is(err, errACSNotConfigured) {
+		return false
+	}
+	var statusErr *sms.StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Retryable()
+	}
+	var acsErr *ACSError
+	if errors.As(err, &acsErr) {
+		return acsErr.Retryable
+	}
+	return true
+}
+
+// acsSMSProvider sends SMS through the ACS resource of the message's brand,
+// authenticating with the same Entra ID token as WhatsApp.
+type acsSMSProvider struct{}
+
+func (acsSMSProvider) Name() string { return "acs" }
+
+type acsSMSRequest struct {
+	From           string            `json:"from"`
+	SMSRecipients  []acsSMSRecipient `json:"smsRecipients"`
+	Message        string            `json:"message"`
+	SMSSendOptions struct {
+		EnableDeliveryReport bool `json:"enableDeliveryReport"`
+	} `json:"smsSendOptions"`
+}
+
+type acsSMSRecipient struct {
+	To string `json:"to"`
+}
+
+type acsSMSResponse struct {
+	Value []struct {
+		To             string `json:"to"`
+		MessageID      string `json:"messageId"`
+		HTTPStatusCode int    `json:"httpStatusCode"`
+		Successful     bool   `json:"successful"`
+		ErrorMessage   string `json:"errorMessage"`
+	} `json:"value"`
+}
+
+func (acsSMSProvider) Send(ctx context.Context, msg sms.Message) (string, error) {
+	cfg := acsConfigFor(msg.Brand)
+	if cfg.Endpoint == "" || cfg.TenantID == "" || cfg.ClientID == "" || cfg.ClientSecret == "" || cfg.SMSFrom == "" {
+		return "", errACSNotConfigured
+	}
+
+	token, err := acsTokenSource(cfg).Token(ctx)
+	if err != nil {
+		return "", fmt.Errorf("Error generating token: %w", err)
+	}
+
+	body := acsSMSRequest{From: cfg.SMSFrom, SMSRecipients: []acsSMSRecipient{{To: msg.To}}, Message: msg.Body}
+	body.SMSSendOptions.EnableDeliveryReport = true
+	data, err := json.Marshal(body)
+	if err != nil {
+		return "", err
+	}
+
+	url := strings.TrimRight(cfg.Endpoint, "/") + "/sms?api-version=" + acsSMSAPIVersion
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := acsClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		acsTokenSource(cfg).Invalidate()
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return "", newACSError(resp, respBody)
+	}
+
+	var result acsSMSResponse
+	if err := json.Unmarshal(respBody, &result); err != nil || len(result.Value) == 0 {
+		log.Printf("ACS SMS response for %s has no message id: %s", msg.To, respBody)
+		return "", nil
+	}
+
+	// A 202 can still carry a per-recipient failure.
+	r := result.Value[0]
+	if !r.Successful {
+		acsErr := &ACSError{
+			StatusCode: r.HTTPStatusCode,
+			Message:    r.ErrorMessage,
+			Target:     r.To,
+			Retryable:  r.HTTPStatusCode == http.StatusTooManyRequests || r.HTTPStatusCode >= 500,
+		}
+		if r.HTTPStatusCode == http.StatusBadRequest {
+			return "", channel.Permanent(acsErr)
+		}
+		return "", acsErr
+	}
+	return r.MessageID, nil
+}
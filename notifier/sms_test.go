@@ -0,0 +1,139 @@
+package notifier
+
+import (
+	"boh/notification-service/channel"
+	"boh/notification-service/sms"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// TestSMSChannel_ACS tests that an SMS is sent through ACS and reported with its segments and estimated cost
+func TestSMSChannel_ACS(t *testing.T) {
+	f := newFakeACS(t)
+	f.reply = `{"value":[{"to":"+15551234567","messageId":"sms-1","httpStatusCode":202,"successful":true}]}`
+	SetACSConfig(f.config(), nil)
+	SetSMSProvider(acsSMSProvider{})
+	smsCostPerSegment = 0.0079
+	t.Cleanup(func() {
+		SetACSConfig(ACSConfig{}, nil)
+		SetSMSProvider(nil)
+		smsCostPerSegment = 0
+	})
+
+	results, err := ProcessMessageContext(context.Background(), NotificationEvent{
+		NotificationMessage: strings.Repeat("a", 200),
+		Channels:            []NotificationChannel{{Type: "sms", Contact: "+15551234567"}},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	r := results[0]
+	if r.Status != channel.StatusSent || r.MessageID != "sms-1" || r.Segments != 2 || r.EstimatedCost != 2*0.0079 {
+		t.Errorf("Unexpected result: %+v", r)
+	}
+	if len(f.sendURLs) != 1 || f.sendURLs[0] != "/sms?api-version=2021-03-07" {
+		t.Errorf("Expected one SMS send, got %v", f.sendURLs)
+	}
+	if got := f.messages[0]["from"]; got != "+15550001111" {
+		t.Errorf("Expected the ACS sender number, got %v", got)
+	}
+}
+
+// TestSMSChannel_ACSRecipientFailure tests that a failed recipient in an accepted response fails the send
+func TestSMSChannel_ACSRecipientFailure(t *testing.T) {
+	f := newFakeACS(t)
+	f.reply = `{"value":[{"to":"+15551234567","httpStatusCode":400,"successful":false,"errorMessage":"Invalid recipient"}]}`
+	SetACSConfig(f.config(), nil)
+	SetSMSProvider(acsSMSProvider{})
+	t.Cleanup(func() {
+		SetACSConfig(ACSConfig{}, nil)
+		SetSMSProvider(nil)
+	})
+
+	_, err := ProcessMessageContext(context.Background(), NotificationEvent{
+		NotificationMessage: "hello",
+		Channels:            []NotificationChannel{{Type: "sms", Contact: "+15551234567"}},
+	})
+
+	var acsErr *ACSError
+	if !errors.As(err, &acsErr) || acsErr.Message != "Invalid recipient" {
+		t.Fatalf("Expected the recipient error, got %v", err)
+	}
+	if !channel.IsPermanent(err) {
+		t.Error("Expected a rejected recipient to be permanent")
+	}
+}
+
+// TestSMSChannel_InvalidNumber tests that numbers not in E.164 format are rejected before sending
+func TestSMSChannel_InvalidNumber(t *testing.T) {
+	called := false
+	SetSMSProvider(providerFunc(func(ctx context.Context, msg sms.Message) (string, error) {
+		called = true
+		return "", nil
+	}))
+	t.Cleanup(func() { SetSMSProvider(nil) })
+
+	results, err := ProcessMessageContext(context.Background(), NotificationEvent{
+		NotificationMessage: "hello",
+		Channels:            []NotificationChannel{{Type: "sms", Contact: "555-1234"}},
+	})
+	if !channel.IsPermanent(err) || results[0].Status != channel.StatusFailed {
+		t.Errorf("Expected a permanent failure, got %v", err)
+	}
+	if called {
+		t.Error("Expected the provider not to be called")
+	}
+}
+
+// TestSMSChannel_Retryable tests which SMS errors are retried
+func TestSMSChannel_Retryable(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		retryable bool
+	}{
+		{"Not configured", errSMSNotConfigured, false},
+		{"Gateway throttled", &sms.StatusError{StatusCode: http.StatusTooManyRequests}, true},
+		{"Gateway rejected", &sms.StatusError{StatusCode: http.StatusBadRequest}, false},
+		{"ACS outage", &ACSError{StatusCode: http.StatusServiceUnavailable, Retryable: true}, true},
+		{"Network", errors.New("connection reset"), true},
+	}
+
+	for _, tt := range tests {
+		if got := (smsChannel{}).Retryable(tt.err); got != tt.retryable {
+			t.Errorf("%s: expected retryable=%v, got %v", tt.name, tt.retryable, got)
+		}
+	}
+}
+
+// TestLoadSMSConfig tests that the HTTP gateway is chosen when a provider URL is set
+func TestLoadSMSConfig(t *testing.T) {
+	t.Setenv("SMS_PROVIDER_URL", "https://sms.example.com/send")
+	t.Setenv("SMS_PROVIDER_API_KEY", "key")
+	t.Setenv("SMS_COST_PER_SEGMENT", "0.01")
+	loadSMSConfig()
+	t.Cleanup(func() {
+		SetSMSProvider(nil)
+		smsCostPerSegment = 0
+	})
+
+	gw, ok := smsProvider.(*sms.HTTPGateway)
+	if !ok || gw.URL != "https://sms.example.com/send" || gw.APIKey != "key" {
+		t.Errorf("Expected the HTTP gateway, got %#v", smsProvider)
+	}
+	if smsCostPerSegment != 0.01 {
+		t.Errorf("Expected a cost of 0.01 per segment, got %v", smsCostPerSegment)
+	}
+}
+
+type providerFunc func(ctx context.Context, msg sms.Message) (string, error)
+
+func (providerFunc) Name() string { return "func" }
+
+func (f providerFunc) Send(ctx context.Context, msg sms.Message) (string, error) {
+	return f(ctx, msg)
+}
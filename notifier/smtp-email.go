@@ -1,16 +1,17 @@
 package notifier
 
 import (
-	"bytes"
+	"boh/notification-service/channel"
+	"boh/notification-service/delivery"
+	"boh/notification-service/email"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
 	"net/smtp"
-	"net/url"
 	"os"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
@@ -22,236 +23,246 @@ var (
 	smtpPassword string
 	smtpSender   string
 
-	acs_app_id     string
-	acs_app_secret string
+	// smtpTransport carries the TLS, auth and timeout settings; it is nil
+	// when SMTP is not configured.
+	smtpTransport *email.Transport
 )
 
-type loginAuth struct {
-	username, password string
-}
-
+// LoginAuth returns an smtp.Auth for the LOGIN mechanism.
 func LoginAuth(username, password string) smtp.Auth {
-	return &loginAuth{username, password}
-}
-
-func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
-	return "LOGIN", []byte{}, nil
+	return email.LoginAuth(username, password)
 }
 
-func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
-	if more {
-		switch string(fromServer) {
-		case "Username:":
-			return []byte(a.username), nil
-		case "Password:":
-			return []byte(a.password), nil
-		default:
-			return nil, errors.New("unknown fromserver")
-		}
-	}
-
-	return nil, nil
+func MessageUnmarshal(messageBody []byte) error {
+	_, err := MessageUnmarshalContext(context.Background(), messageBody)
+	return err
 }
 
-func MessageUnmarshal(messageBody []byte) error {
+// MessageUnmarshalContext is MessageUnmarshal with a context that is passed
+// on to the channel providers, so in-flight sends can be cancelled. It
+// returns the per-channel outcome alongside the summarised error.
+func MessageUnmarshalContext(ctx context.Context, messageBody []byte) (DeliveryReport, error) {
 	var event NotificationEvent
 	err := json.Unmarshal(messageBody, &event)
 	if err != nil {
 		log.Printf("Error unmarshalling message: %v", err)
-		return err
+		return DeliveryReport{}, channel.Permanent(err)
 	}
-	err = ProcessMessage(event)
+
+	report := DeliveryReport{NotificationID: event.NotificationID, UserID: event.UserID}
+	report.Results, err = ProcessMessageContext(ctx, event)
 	if err != nil {
 		log.Printf("Error processing message: %v", err)
-		return err
+		return report, err
 	}
-	return nil
+	return report, nil
 }
 
-func ProcessMessage(event NotificationEvent) error {
-	var err error
-	log.Println(event)
-	err = godotenv.Load()
+// Init loads the provider settings from the environment. It must be called
+// once before messages are processed, since ProcessMessage may run on
+// several goroutines at the same time.
+func Init() {
+	err := godotenv.Load()
 	if err != nil {
 		log.Printf(" Could not load .env file")
 	}
-	smtpHost = os.Getenv("SMTP_HOST")
-	smtpPort = os.Getenv("SMTP_PORT")
-	smtpUsername = os.Getenv("SMTP_USERNAME")
-	smtpPassword = os.Getenv("SMTP_PASSWORD")
 	smtpSender = os.Getenv("SMTP_SENDER")
 
-	acs_app_id = os.Getenv("ACS_APP_ID")
-	acs_app_secret = os.Getenv("ACS_APP_SECRET")
-
-	log.Println("Processing")
-	i := 0
-	for i < len(event.Channels) {
-
-		switch event.Channels[i].Type {
-		case "email":
-			if smtpHost == "" || smtpPassword == "" || smtpPort == "" || smtpUsername == "" {
-				log.Println(smtpHost, smtpPort, "\n", smtpUsername, "\n", smtpPassword)
-				return fmt.Errorf("SMTP not configured")
-			}
-
-			err = SendEmailSMTP(event.Channels[i].Contact, smtpSender, "Notification", event.NotificationMessage)
-
-		case "whatsapp":
-			if acs_app_id == "" || acs_app_secret == "" {
-				return fmt.Errorf("ACS WhatsApp parameters not configured")
-			}
-			err := sendWhatsAppMessage(event.Channels[i].Contact, "abc", event.NotificationMessage)
-			if err != nil {
-				fmt.Errorf("%v", err)
-			}
+	loadACSConfig()
+	loadSMTPTransport()
+	loadSMSConfig()
+	loadAttachmentConfig()
+}
 
-		default:
+func ProcessMessage(event NotificationEvent) error {
+	_, err := ProcessMessageContext(context.Background(), event)
+	return err
+}
 
-		}
-		if err != nil {
-			log.Printf("Error occurred: %v", err)
-			return err
-		}
+// ProcessMessageContext sends event on every channel, even when an earlier
+// one fails, and returns one result per channel. The error summarises the
+// failures; see channel.ResultsError.
+func ProcessMessageContext(ctx context.Context, event NotificationEvent) ([]channel.DeliveryResult, error) {
+	log.Println(event)
 
-		i++
+	log.Println("Processing")
+	results := make([]channel.DeliveryResult, 0, len(event.Channels))
+	for _, target := range event.Channels {
+		result := deliver(ctx, event, target)
+		logResult(event, result)
+		results = append(results, result)
 	}
 
-	return nil
+	return results, channel.ResultsError(results)
 }
 
-func SendEmailSMTP(toEmail, smtpSender, subject, body string) error {
-
-	address := smtpHost + ":" + smtpPort
-	// auth := smtp.PlainAuth("", smtpUsername, smtpPassword, smtpHost)
-	auth := LoginAuth(smtpUsername, smtpPassword)
-
-	msg := []byte("To: " + toEmail + "\r\n" +
-		"From: " + smtpSender + "\r\n" +
-		"Subject: " + subject + "\r\n" +
-		"Content-Type: text/html; charset=UTF-8 \r\n" +
-		"\r\n" +
-		body + "\r\n")
-	err := smtp.SendMail(address, auth, smtpSender, []string{toEmail}, msg)
+func deliver(ctx context.Context, event NotificationEvent, target NotificationChannel) channel.DeliveryResult {
+	provider, ok := registry.Lookup(target.Type)
+	if !ok {
+		log.Printf("Warning: Unknown notification type '%s'", target.Type)
+		return channel.DeliveryResult{Channel: target.Type, Contact: target.Contact, Status: channel.StatusUnsupported}
+	}
 
+	key := delivery.NewKey(event.NotificationID, provider.Name(), target.Contact)
+	sent, err := alreadySent(ctx, key)
 	if err != nil {
-		return fmt.Errorf("SMTP send mail failed: %w", err)
+		return channel.Failed(provider.Name(), target.Contact, fmt.Errorf("check delivery %s: %w", key, err))
 	}
-
-	log.Printf("Email triggered successfully to %s", toEmail)
-
-	return nil
-}
-
-func getOauthToken() (*OauthTokenResponse, error) {
-
-	var response OauthTokenResponse
-	tokenUrl := "https://login.microsoftonline.com/0d4e668b-ef12-4a0a-80af-bd78919b7c5a/oauth2/v2.0/token"
-	data := map[string]string{
-		"grant_type":    "client_credentials",
-		"client_id":     acs_app_id,
-		"client_secret": acs_app_secret,
-		"scope":         "https://communication.azure.com/.default",
+	if sent {
+		log.Printf("Skipping %s to %s, already delivered", target.Type, target.Contact)
+		return channel.DeliveryResult{Channel: provider.Name(), Contact: target.Contact, Status: channel.StatusSkipped}
 	}
 
-	values := url.Values{}
-
-	for key, value := range data {
-		values.Add(key, value)
+	attachments := target.Attachments
+	if len(attachments) > 0 {
+		if attachments, err = fetchAttachments(ctx, attachments); err != nil {
+			return channel.Failed(provider.Name(), target.Contact, err)
+		}
 	}
 
-	// jsonData, err := json.Marshal(data)
-	// if err != nil {
-	// 	return &response, fmt.Errorf("Error occured marshalling the json : %w", err)
-	// }
-	bodyBuffer := bytes.NewBuffer([]byte(values.Encode()))
-
-	resp, err := http.Post(tokenUrl, "application/x-www-form-urlencoded", bodyBuffer)
-
-	if err != nil {
-		return &response, fmt.Errorf("Error Orccured %v", err)
+	result := channel.Deliver(ctx, policies.Wrap(provider), channel.Notification{
+		UserID:      event.UserID,
+		Brand:       event.Brand,
+		Contact:     target.Contact,
+		Body:        event.NotificationMessage,
+		Template:    target.Template,
+		Media:       target.Media,
+		Interactive: target.Interactive,
+		Attachments: attachments,
+		Cc:          target.Cc,
+		Bcc:         target.Bcc,
+		ReplyTo:     target.ReplyTo,
+	})
+	if result.Status == channel.StatusSent {
+		recordSent(ctx, key, channel.Receipt{Channel: result.Channel, Contact: result.Contact, MessageID: result.MessageID})
+		if target.Interactive != nil {
+			recordCorrelation(ctx, event, result)
+		}
 	}
+	return result
+}
 
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("Request Failed \n %v", resp)
+func logResult(event NotificationEvent, result channel.DeliveryResult) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		log.Printf("Error marshalling delivery result: %v", err)
+		return
 	}
+	log.Printf("Delivery result for notification %q: %s", event.NotificationID, data)
+}
 
-	defer resp.Body.Close()
+// SendEmailSMTP sends an HTML email with optional attachments; attachments
+// with a content id are shown inline.
+func SendEmailSMTP(toEmail, smtpSender, subject, body string, attachments ...email.Attachment) error {
+	return SendEmail(email.Message{From: smtpSender, To: []string{toEmail}, Subject: subject, HTML: body, Attachments: attachments})
+}
 
-	body, err := io.ReadAll(resp.Body)
+// loadSMTPTransport reads the SMTP_* settings. SMTP_AUTH defaults to login.
+// With xoauth2 the tokens come from the ACS app registration, or the one
+// given by SMTP_OAUTH_*. It must run after loadACSConfig.
+func loadSMTPTransport() {
+	cfg, err := email.TransportConfigFromEnv()
 	if err != nil {
-		return &response, fmt.Errorf("Error Orccured %v", err)
+		log.Printf("Warning: %v", err)
 	}
+	if cfg.Auth == "" {
+		cfg.Auth = email.AuthLogin
+	}
+	if cfg.Auth == email.AuthXOAuth2 {
+		if cfg.Tokens, err = smtpTokenSource(); err != nil {
+			log.Printf("Warning: %v, email will be disabled", err)
+			cfg.Tokens = nil
+		}
+	}
+	smtpHost, smtpPort, smtpUsername, smtpPassword = cfg.Host, cfg.Port, cfg.Username, cfg.Password
 
-	log.Printf("%s", string(body))
-
-	err = json.Unmarshal(body, &response)
-
+	if smtpTransport != nil {
+		// Idle sessions still hold the old credentials; drop them.
+		smtpTransport.Close(context.Background())
+	}
+	smtpTransport = nil
+	if cfg.Host == "" {
+		return
+	}
+	smtpTransport, err = email.NewTransport(cfg)
 	if err != nil {
-		return &response, fmt.Errorf("Error Orccured %v", err)
+		log.Printf("Warning: invalid SMTP settings, email will be disabled: %v", err)
 	}
-
-	return &response, nil
-
 }
 
-func sendWhatsAppMessage(toNumber, fromNumber, body string) error {
-
-	var event AcsMessage
-
-	if toNumber == "" || fromNumber == "" || body == "" {
-		return fmt.Errorf("parameters not configured for whatsApp messaging")
+// defaultSMTPOAuthScope is the Office 365 scope for SMTP client-credentials
+// tokens.
+const defaultSMTPOAuthScope = "https://outlook.office365.com/.default"
+
+// smtpTokenSource returns the cached Entra ID tokens for XOAUTH2. The app
+// registration defaults to the ACS one; SMTP_OAUTH_TENANT_ID,
+// SMTP_OAUTH_APP_ID, SMTP_OAUTH_APP_SECRET and SMTP_OAUTH_AUTHORITY_HOST
+// override it and SMTP_OAUTH_SCOPE sets the scope.
+func smtpTokenSource() (*tokenSource, error) {
+	cfg := acsConfig.Override(ACSConfigFromEnv("SMTP_OAUTH_"))
+	if cfg.TenantID == "" || cfg.ClientID == "" || cfg.ClientSecret == "" {
+		return nil, errors.New("SMTP auth xoauth2 needs a tenant, app id and app secret")
 	}
-
-	token, err := getOauthToken()
-	if err != nil {
-		return fmt.Errorf("Error generating token %v", err)
+	scope := os.Getenv("SMTP_OAUTH_SCOPE")
+	if scope == "" {
+		scope = defaultSMTPOAuthScope
 	}
+	return newTokenSource("smtp:"+cfg.TenantID+":"+cfg.ClientID, func(ctx context.Context) (*OauthTokenResponse, error) {
+		return requestToken(ctx, cfg, scope)
+	}), nil
+}
 
-	event.ChannelRegistrationId = "4eb202d9-3c0d-4594-87a5-1ddef0b9102a"
-	event.To = []string{toNumber}
-	event.Kind = "text"
-	event.Content = body
-
-	data, err := json.Marshal(event)
-
-	if err != nil {
-		return err
+// Close ends the pooled SMTP sessions. Call it on shutdown, after the last
+// message has been processed.
+func Close(ctx context.Context) error {
+	if smtpTransport == nil {
+		return nil
 	}
+	return smtpTransport.Close(ctx)
+}
 
-	bodyBuffer := bytes.NewBuffer(data)
-
-	req, err := http.NewRequest("POST", "https://boh-communication-service.unitedstates.communication.azure.com/messages/notifications:send?api-version=2024-02-01", bodyBuffer)
+// SendEmail sends message to its To, Cc and Bcc recipients. Messages whose
+// addresses or headers are invalid fail permanently.
+func SendEmail(message email.Message) error {
+	return sendEmail(context.Background(), message)
+}
 
-	if err != nil {
-		return err
+// smtpConfigured reports whether the transport is set up with a host and
+// port, and with credentials when it logs in with a password.
+func smtpConfigured() bool {
+	if smtpTransport == nil || smtpHost == "" || smtpPort == "" {
+		return false
 	}
+	return !smtpTransport.UsesPassword() || (smtpUsername != "" && smtpPassword != "")
+}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-
+func sendEmail(ctx context.Context, message email.Message) error {
+	if !smtpConfigured() {
+		return errSMTPNotConfigured
+	}
+	msg, err := message.Bytes()
 	if err != nil {
-		return err
+		return channel.Permanent(fmt.Errorf("build email: %w", err))
 	}
+	sender, _ := message.Sender()
+	recipients, _ := message.Recipients()
+	err = smtpTransport.Send(ctx, sender, recipients, msg)
 
-	defer resp.Body.Close()
-
-	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
+		err = fmt.Errorf("SMTP send mail failed: %w", err)
+		if isPermanentSMTPError(err) {
+			return channel.Permanent(err)
+		}
 		return err
 	}
 
-	log.Println("response : ", string(respBody))
-
-	if resp.StatusCode >= http.StatusOK && resp.StatusCode <= http.StatusPermanentRedirect {
-
-		log.Printf("Request Succeeded \n %v", resp)
-	} else {
-		log.Printf("Request Failed \n %v", resp)
-	}
+	log.Printf("Email triggered successfully to %s", strings.Join(recipients, ", "))
 
 	return nil
 }
+
+// isPermanentSMTPError reports whether the server refused the message for
+// good; see email.IsPermanent.
+func isPermanentSMTPError(err error) bool {
+	return email.IsPermanent(err)
+}
@@ -1,15 +1,18 @@
 package notifier
 
 import (
+	"boh/notification-service/channel"
+	"boh/notification-service/email"
+	"context"
 	"encoding/json"
 	"errors"
 	"net/smtp"
 	"testing"
 )
 
-// TestLoginAuth_Start tests the Start method of loginAuth
+// TestLoginAuth_Start tests the Start method of LoginAuth
 func TestLoginAuth_Start(t *testing.T) {
-	auth := LoginAuth("testuser", "testpass").(*loginAuth)
+	auth := LoginAuth("testuser", "testpass")
 	
 	mechanism, initialResp, err := auth.Start(&smtp.ServerInfo{})
 	
@@ -26,7 +29,7 @@ func TestLoginAuth_Start(t *testing.T) {
 
 // TestLoginAuth_Next_Username tests the Next method when server asks for username
 func TestLoginAuth_Next_Username(t *testing.T) {
-	auth := LoginAuth("testuser", "testpass").(*loginAuth)
+	auth := LoginAuth("testuser", "testpass")
 	
 	response, err := auth.Next([]byte("Username:"), true)
 	
@@ -40,7 +43,7 @@ func TestLoginAuth_Next_Username(t *testing.T) {
 
 // TestLoginAuth_Next_Password tests the Next method when server asks for password
 func TestLoginAuth_Next_Password(t *testing.T) {
-	auth := LoginAuth("testuser", "testpass").(*loginAuth)
+	auth := LoginAuth("testuser", "testpass")
 	
 	response, err := auth.Next([]byte("Password:"), true)
 	
@@ -54,7 +57,7 @@ func TestLoginAuth_Next_Password(t *testing.T) {
 
 // TestLoginAuth_Next_UnknownServer tests the Next method with unknown server response
 func TestLoginAuth_Next_UnknownServer(t *testing.T) {
-	auth := LoginAuth("testuser", "testpass").(*loginAuth)
+	auth := LoginAuth("testuser", "testpass")
 	
 	response, err := auth.Next([]byte("Unknown:"), true)
 	
@@ -71,7 +74,7 @@ func TestLoginAuth_Next_UnknownServer(t *testing.T) {
 
 // TestLoginAuth_Next_NoMore tests the Next method when more is false
 func TestLoginAuth_Next_NoMore(t *testing.T) {
-	auth := LoginAuth("testuser", "testpass").(*loginAuth)
+	auth := LoginAuth("testuser", "testpass")
 	
 	response, err := auth.Next([]byte("test"), false)
 	
@@ -187,8 +190,7 @@ func TestProcessMessage_EmailChannel_MissingConfig(t *testing.T) {
 // TestProcessMessage_WhatsAppChannel_MissingConfig tests ProcessMessage with WhatsApp but no ACS config
 func TestProcessMessage_WhatsAppChannel_MissingConfig(t *testing.T) {
 	// Clear environment variables to ensure ACS is not configured
-	acs_app_id = ""
-	acs_app_secret = ""
+	SetACSConfig(ACSConfig{}, nil)
 	
 	event := NotificationEvent{
 		UserID:              "user123",
@@ -266,7 +268,7 @@ func TestSendWhatsAppMessage_EmptyParameters(t *testing.T) {
 	
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := sendWhatsAppMessage(tt.toNumber, tt.fromNumber, tt.body)
+			_, err := sendWhatsAppMessage(context.Background(), ACSConfig{}, tt.toNumber, tt.fromNumber, tt.body)
 			
 			if err == nil {
 				t.Error("Expected error for empty parameters, got nil")
@@ -398,3 +400,63 @@ func TestAcsMessage_JSONMarshaling(t *testing.T) {
 		t.Errorf("Content mismatch: got %s, want %s", unmarshaled.Content, original.Content)
 	}
 }
+
+// TestProcessMessageContext_EmailHeaderInjection tests that a Cc with a line break fails permanently before anything is sent
+func TestProcessMessageContext_EmailHeaderInjection(t *testing.T) {
+	smtpHost, smtpPort, smtpUsername, smtpPassword, smtpSender = "127.0.0.1", "1", "user", "pass", "Bank of Harnoor <alerts@boh.example>"
+	smtpTransport, _ = email.NewTransport(email.TransportConfig{Host: smtpHost, Port: smtpPort, Auth: email.AuthLogin, Username: "user", Password: "pass"})
+	t.Cleanup(func() {
+		smtpHost, smtpPort, smtpUsername, smtpPassword, smtpSender = "", "", "", "", ""
+		smtpTransport = nil
+	})
+
+	results, err := ProcessMessageContext(context.Background(), NotificationEvent{
+		NotificationMessage: "Your statement is ready",
+		Channels: []NotificationChannel{{
+			Type:    "email",
+			Contact: "alice@example.com",
+			Cc:      []string{"bob@example.com\r\nBcc: victim@example.com"},
+		}},
+	})
+	if !channel.IsPermanent(err) || results[0].Attempts != 1 {
+		t.Errorf("Expected one permanent failure, got %v after %d attempts", err, results[0].Attempts)
+	}
+}
+
+// TestLoadSMTPTransport_XOAuth2 tests that xoauth2 takes its tokens from the ACS app registration with the SMTP_OAUTH_* overrides
+func TestLoadSMTPTransport_XOAuth2(t *testing.T) {
+	f := newFakeACS(t)
+	SetACSConfig(f.config(), nil)
+	t.Setenv("SMTP_HOST", "smtp.office365.com")
+	t.Setenv("SMTP_PORT", "587")
+	t.Setenv("SMTP_AUTH", "xoauth2")
+	t.Setenv("SMTP_USERNAME", "alerts@boh.example")
+	t.Setenv("SMTP_OAUTH_TENANT_ID", "tenant-2")
+	t.Cleanup(func() {
+		SetACSConfig(ACSConfig{}, nil)
+		smtpHost, smtpPort, smtpUsername, smtpPassword = "", "", "", ""
+		smtpTransport = nil
+	})
+
+	loadSMTPTransport()
+	if !smtpConfigured() {
+		t.Fatal("Expected SMTP to be configured without a password")
+	}
+
+	tokens, err := smtpTokenSource()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := tokens.Token(context.Background()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(f.tokenPaths) != 1 || f.tokenPaths[0] != "/tenant-2/oauth2/v2.0/token" {
+		t.Errorf("Expected a token from tenant-2, got %v", f.tokenPaths)
+	}
+
+	SetACSConfig(ACSConfig{}, nil)
+	loadSMTPTransport()
+	if smtpConfigured() {
+		t.Error("Expected SMTP to be disabled without an app registration")
+	}
+}
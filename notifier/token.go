@@ -0,0 +1,133 @@
+package notifier
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// tokenRefreshWindow is how long before expiry a token is refreshed in
+	// the background while it keeps being served.
+	tokenRefreshWindow = 5 * time.Minute
+	// tokenExpiryMargin is how long before expiry a token stops being used
+	// at all, to allow for clock skew and request latency.
+	tokenExpiryMargin = 30 * time.Second
+	tokenFetchTimeout = 30 * time.Second
+)
+
+// tokenSource caches an OAuth access token and refreshes it shortly before
+// it expires. Concurrent callers share a single in-flight fetch.
+type tokenSource struct {
+	name  string
+	fetch func(ctx context.Context) (*OauthTokenResponse, error)
+	now   func() time.Time
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+	inflight  *tokenFetch
+	lastErr   error
+}
+
+// tokenFetch is a fetch shared by every caller that needs a token while it
+// runs; done is closed once token/err are set.
+type tokenFetch struct {
+	done  chan struct{}
+	token string
+	err   error
+}
+
+func newTokenSource(name string, fetch func(ctx context.Context) (*OauthTokenResponse, error)) *tokenSource {
+	s := &tokenSource{name: name, fetch: fetch, now: time.Now}
+	tokenHealth.Set(name, expvar.Func(func() any {
+		if err := s.Health(); err != nil {
+			return err.Error()
+		}
+		return "ok"
+	}))
+	return s
+}
+
+// tokenHealth publishes the last refresh outcome of every token source.
+var tokenHealth = expvar.NewMap("tokens")
+
+// Token returns a cached token when one is valid, starting a background
+// refresh when it is close to expiry, and otherwise waits for a new one.
+func (s *tokenSource) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	now := s.now()
+	if s.token != "" && now.Before(s.expiresAt.Add(-tokenExpiryMargin)) {
+		token := s.token
+		if now.After(s.expiresAt.Add(-tokenRefreshWindow)) {
+			s.startFetch()
+		}
+		s.mu.Unlock()
+		return token, nil
+	}
+	f := s.startFetch()
+	s.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.token, f.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// Invalidate drops the cached token, e.g. after the server rejected it.
+func (s *tokenSource) Invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token = ""
+	s.expiresAt = time.Time{}
+}
+
+// Health returns the error from the most recent refresh, or nil if it
+// succeeded.
+func (s *tokenSource) Health() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastErr
+}
+
+// startFetch returns the in-flight fetch, starting one if needed. s.mu must
+// be held.
+func (s *tokenSource) startFetch() *tokenFetch {
+	if s.inflight != nil {
+		return s.inflight
+	}
+	f := &tokenFetch{done: make(chan struct{})}
+	s.inflight = f
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), tokenFetchTimeout)
+		defer cancel()
+
+		resp, err := s.fetch(ctx)
+		if err == nil && (resp == nil || resp.AccessToken == "") {
+			err = fmt.Errorf("token response has no access token")
+		}
+
+		s.mu.Lock()
+		if err != nil {
+			log.Printf("Error refreshing %s token: %v", s.name, err)
+			s.lastErr = err
+			f.err = err
+		} else {
+			s.token = resp.AccessToken
+			s.expiresAt = s.now().Add(time.Duration(resp.ExpiresIn) * time.Second)
+			s.lastErr = nil
+			f.token = resp.AccessToken
+		}
+		s.inflight = nil
+		s.mu.Unlock()
+		close(f.done)
+	}()
+
+	return f
+}
@@ -0,0 +1,159 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+}
+
+func newTestTokenSource(fetch func(ctx context.Context) (*OauthTokenResponse, error)) (*tokenSource, *fakeClock) {
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	s := newTokenSource("test", fetch)
+	s.now = clock.now
+	return s, clock
+}
+
+// TestTokenSource_ReusesToken tests that a valid token is fetched once and reused
+func TestTokenSource_ReusesToken(t *testing.T) {
+	var fetches int32
+	s, clock := newTestTokenSource(func(ctx context.Context) (*OauthTokenResponse, error) {
+		atomic.AddInt32(&fetches, 1)
+		return &OauthTokenResponse{AccessToken: "token-1", ExpiresIn: 3600}, nil
+	})
+
+	for i := 0; i < 3; i++ {
+		token, err := s.Token(context.Background())
+		if err != nil || token != "token-1" {
+			t.Fatalf("Expected token-1, got %q err=%v", token, err)
+		}
+		clock.advance(10 * time.Minute)
+	}
+
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Errorf("Expected 1 fetch, got: %d", n)
+	}
+}
+
+// TestTokenSource_SingleFlight tests that concurrent callers share one fetch
+func TestTokenSource_SingleFlight(t *testing.T) {
+	var fetches int32
+	release := make(chan struct{})
+	s, _ := newTestTokenSource(func(ctx context.Context) (*OauthTokenResponse, error) {
+		atomic.AddInt32(&fetches, 1)
+		<-release
+		return &OauthTokenResponse{AccessToken: "shared", ExpiresIn: 3600}, nil
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if token, err := s.Token(context.Background()); err != nil || token != "shared" {
+				t.Errorf("Expected shared token, got %q err=%v", token, err)
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Errorf("Expected 1 fetch, got: %d", n)
+	}
+}
+
+// TestTokenSource_RefreshesBeforeExpiry tests that a token near expiry is served while refreshed in the background
+func TestTokenSource_RefreshesBeforeExpiry(t *testing.T) {
+	var fetches int32
+	s, clock := newTestTokenSource(func(ctx context.Context) (*OauthTokenResponse, error) {
+		n := atomic.AddInt32(&fetches, 1)
+		if n == 1 {
+			return &OauthTokenResponse{AccessToken: "old", ExpiresIn: 3600}, nil
+		}
+		return &OauthTokenResponse{AccessToken: "new", ExpiresIn: 3600}, nil
+	})
+
+	s.Token(context.Background())
+	clock.advance(time.Hour - 2*time.Minute)
+
+	token, err := s.Token(context.Background())
+	if err != nil || token != "old" {
+		t.Fatalf("Expected the still-valid token to be served, got %q err=%v", token, err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		token, _ = s.Token(context.Background())
+		if token == "new" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected background refresh to replace the token")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// TestTokenSource_FailureReportsHealth tests that refresh failures are returned and surfaced by Health
+func TestTokenSource_FailureReportsHealth(t *testing.T) {
+	fail := true
+	s, _ := newTestTokenSource(func(ctx context.Context) (*OauthTokenResponse, error) {
+		if fail {
+			return nil, errors.New("AADSTS7000215: invalid client secret")
+		}
+		return &OauthTokenResponse{AccessToken: "ok", ExpiresIn: 3600}, nil
+	})
+
+	if _, err := s.Token(context.Background()); err == nil {
+		t.Fatal("Expected fetch error, got nil")
+	}
+	if s.Health() == nil {
+		t.Error("Expected Health to report the failure")
+	}
+
+	fail = false
+	if _, err := s.Token(context.Background()); err != nil {
+		t.Fatalf("Expected recovery, got: %v", err)
+	}
+	if err := s.Health(); err != nil {
+		t.Errorf("Expected healthy after successful refresh, got: %v", err)
+	}
+}
+
+// TestTokenSource_Invalidate tests that an invalidated token is fetched again
+func TestTokenSource_Invalidate(t *testing.T) {
+	var fetches int32
+	s, _ := newTestTokenSource(func(ctx context.Context) (*OauthTokenResponse, error) {
+		atomic.AddInt32(&fetches, 1)
+		return &OauthTokenResponse{AccessToken: "t", ExpiresIn: 3600}, nil
+	})
+
+	s.Token(context.Background())
+	s.Invalidate()
+	s.Token(context.Background())
+
+	if n := atomic.LoadInt32(&fetches); n != 2 {
+		t.Errorf("Expected 2 fetches, got: %d", n)
+	}
+}
@@ -0,0 +1,143 @@
+package processor
+
+import (
+	"boh/notification-service/channel"
+	"boh/notification-service/email"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var (
+	errSMTPNotInitialized = errors.New("SMTP client is not initialized")
+	errMetaNotConfigured  = errors.New("Meta API is not configured")
+)
+
+// metaStatusError is a non-2xx response from the Meta Graph API, with the
+// fields of its error object when the body has one.
+type metaStatusError struct {
+	StatusCode int
+	Body       string
+
+	Code      int
+	Subcode   int
+	Type      string
+	Message   string
+	FBTraceID string
+}
+
+func newMetaStatusError(status int, body []byte) *metaStatusError {
+	e := &metaStatusError{StatusCode: status, Body: string(body)}
+	var resp metaErrorResponse
+	if json.Unmarshal(body, &resp) == nil {
+		e.Code = resp.Error.Code
+		e.Subcode = resp.Error.ErrorSubcode
+		e.Type = resp.Error.Type
+		e.Message = resp.Error.Message
+		e.FBTraceID = resp.Error.FBTraceID
+	}
+	return e
+}
+
+func (e *metaStatusError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("Meta API returned error status %d: %s", e.StatusCode, e.Body)
+	}
+	return fmt.Sprintf("Meta API returned error status %d: code %d: %s (fbtrace_id %s)", e.StatusCode, e.Code, e.Message, e.FBTraceID)
+}
+
+// metaRetryableCodes are Graph API error codes for throttling and temporary
+// outages, which may be returned with a 400 status.
+var metaRetryableCodes = map[int]bool{
+	1:      true, // API unknown
+	2:      true, // API service
+	4:      true, // application request limit
+	80007:  true, // WhatsApp Business account rate limit
+	130429: true, // Cloud API throughput
+	131000: true, // something went wrong
+	131016: true, // service unavailable
+	131056: true, // pair rate limit
+}
+
+// registry holds the channel providers ProcessMessage dispatches to.
+var registry = channel.NewRegistry()
+
+func init() {
+	for _, c := range []channel.Channel{emailChannel{}, whatsAppChannel{}} {
+		if err := registry.Register(c); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Register adds a channel provider next to EMAIL, WHATSAPP and SMS. It is
+// wrapped in the processor's retry and breaker policies when first used.
+func Register(c channel.Channel) error {
+	return registry.Register(c)
+}
+
+// emailChannel sends EMAIL notifications over SMTP.
+type emailChannel struct{}
+
+func (emailChannel) Name() string { return "EMAIL" }
+
+func (emailChannel) Validate(contact string) error {
+	return channel.ValidateEmail(contact)
+}
+
+// Retryable follows the notifier's email channel: an uninitialized
+// transport, a 5xx rejection or a failed login is not retried in process.
+func (emailChannel) Retryable(err error) bool {
+	if errors.Is(err, errSMTPNotInitialized) || email.IsAuthError(err) {
+		return false
+	}
+	return !email.IsPermanent(err)
+}
+
+func (emailChannel) Send(ctx context.Context, n channel.Notification) (channel.Receipt, error) {
+	receipt := channel.Receipt{Channel: "EMAIL", Contact: n.Contact}
+	return receipt, sendEmail(ctx, email.Message{
+		From:    smtpSender,
+		To:      []string{n.Contact},
+		Cc:      n.Cc,
+		Bcc:     n.Bcc,
+		ReplyTo: n.ReplyTo,
+		Subject: n.Subject,
+		Text:    n.Body,
+	})
+}
+
+// whatsAppChannel sends WHATSAPP notifications through the Meta Cloud API.
+type whatsAppChannel struct{}
+
+func (whatsAppChannel) Name() string { return "WHATSAPP" }
+
+func (whatsAppChannel) Validate(contact string) error {
+	return channel.ValidatePhone(contact)
+}
+
+func (whatsAppChannel) Send(ctx context.Context, n channel.Notification) (channel.Receipt, error) {
+	receipt := channel.Receipt{Channel: "WHATSAPP", Contact: n.Contact}
+	msg, err := newMetaMessage(n)
+	if err != nil {
+		return receipt, channel.Permanent(err)
+	}
+	receipt.MessageID, err = sendSmsViaMeta(ctx, msg)
+	return receipt, err
+}
+
+// Retryable retries network failures, throttling (429), 5xx responses and
+// the Graph API error codes for rate limits and temporary outages.
+func (whatsAppChannel) Retryable(err error) bool {
+	if errors.Is(err, errMetaNotConfigured) {
+		return false
+	}
+	var statusErr *metaStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= 500 ||
+			metaRetryableCodes[statusErr.Code]
+	}
+	return true
+}
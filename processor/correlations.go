@@ -0,0 +1,40 @@
+package processor
+
+import (
+	"boh/notification-service/channel"
+	"boh/notification-service/correlation"
+	"context"
+	"log"
+	"time"
+)
+
+// correlations maps the message id of every interactive send back to the
+// notification, so the reply webhook can tell which question was answered.
+var correlations correlation.Store = correlation.NewMemoryStore(correlation.DefaultTTL)
+
+// SetCorrelationStore replaces the default in-memory correlation store with
+// the one the Meta webhook reply handler looks button replies up in.
+func SetCorrelationStore(s correlation.Store) {
+	correlations = s
+}
+
+// recordCorrelation stores the wamid of a sent interactive message. Without
+// it a button reply reaches the webhook as an unmatched message, which is
+// logged there; the send itself is not undone.
+func recordCorrelation(ctx context.Context, event NotificationEvent, result channel.DeliveryResult) {
+	if result.MessageID == "" {
+		log.Printf("No message id for interactive %s message to %s; replies cannot be correlated\n", result.Channel, result.Contact)
+		return
+	}
+	rec := correlation.Record{
+		MessageID:      result.MessageID,
+		NotificationID: event.NotificationID,
+		UserID:         event.UserID,
+		Channel:        result.Channel,
+		Contact:        result.Contact,
+		CreatedAt:      time.Now().UTC(),
+	}
+	if err := correlations.Put(ctx, rec); err != nil {
+		log.Printf("Error recording correlation for message %s: %v\n", result.MessageID, err)
+	}
+}
@@ -0,0 +1,39 @@
+package processor
+
+import (
+	"boh/notification-service/channel"
+	"boh/notification-service/delivery"
+	"context"
+	"log"
+	"time"
+)
+
+// deliveries records the provider message id of every send, so status
+// callbacks from the webhooks can find it.
+var deliveries delivery.Store = delivery.NewMemoryStore(delivery.DefaultTTL)
+
+// SetDeliveryStore replaces the default in-memory delivery store with the
+// one the Meta webhook handler updates.
+func SetDeliveryStore(s delivery.Store) {
+	deliveries = s
+}
+
+// recordSent stores the wamid of a successful send, which the Meta status
+// callbacks look the delivery up by. Events without a notification id have
+// no key to store it under. A failed write costs those status updates, so
+// it is logged and the send still counts.
+func recordSent(ctx context.Context, event NotificationEvent, result channel.DeliveryResult) {
+	if event.NotificationID == "" {
+		return
+	}
+	key := delivery.NewKey(event.NotificationID, result.Channel, result.Contact)
+	rec := delivery.Record{
+		Key:       key,
+		Status:    delivery.StatusSent,
+		MessageID: result.MessageID,
+		UpdatedAt: time.Now().UTC(),
+	}
+	if err := deliveries.Put(ctx, rec); err != nil {
+		log.Printf("Error recording delivery %s: %v\n", key, err)
+	}
+}
@@ -0,0 +1,223 @@
+package processor
+
+import (
+	"boh/notification-service/channel"
+	"fmt"
+	"strconv"
+)
+
+// Request types for the Meta WhatsApp Cloud API /messages endpoint. Every
+// payload is built from these and encoded with encoding/json, so message
+// text can never break out of its field.
+
+type metaMessage struct {
+	MessagingProduct string           `json:"messaging_product"`
+	RecipientType    string           `json:"recipient_type,omitempty"`
+	To               string           `json:"to"`
+	Type             string           `json:"type"`
+	Text             *metaText        `json:"text,omitempty"`
+	Template         *metaTemplate    `json:"template,omitempty"`
+	Interactive      *metaInteractive `json:"interactive,omitempty"`
+	Image            *metaMedia       `json:"image,omitempty"`
+	Document         *metaMedia       `json:"document,omitempty"`
+	Video            *metaMedia       `json:"video,omitempty"`
+}
+
+type metaText struct {
+	Body       string `json:"body"`
+	PreviewURL bool   `json:"preview_url,omitempty"`
+}
+
+type metaTemplate struct {
+	Name       string          `json:"name"`
+	Language   metaLanguage    `json:"language"`
+	Components []metaComponent `json:"components,omitempty"`
+}
+
+type metaLanguage struct {
+	Code string `json:"code"`
+}
+
+type metaComponent struct {
+	Type       string          `json:"type"`
+	SubType    string          `json:"sub_type,omitempty"`
+	Index      string          `json:"index,omitempty"`
+	Parameters []metaParameter `json:"parameters"`
+}
+
+type metaParameter struct {
+	Type          string     `json:"type"`
+	ParameterName string     `json:"parameter_name,omitempty"`
+	Text          string     `json:"text,omitempty"`
+	Payload       string     `json:"payload,omitempty"`
+	Image         *metaMedia `json:"image,omitempty"`
+	Document      *metaMedia `json:"document,omitempty"`
+	Video         *metaMedia `json:"video,omitempty"`
+}
+
+type metaMedia struct {
+	Link     string `json:"link"`
+	Caption  string `json:"caption,omitempty"`
+	Filename string `json:"filename,omitempty"`
+}
+
+type metaInteractive struct {
+	Type   string                 `json:"type"`
+	Header *metaInteractiveHeader `json:"header,omitempty"`
+	Body   metaInteractiveText    `json:"body"`
+	Footer *metaInteractiveText   `json:"footer,omitempty"`
+	Action metaAction             `json:"action"`
+}
+
+type metaInteractiveHeader struct {
+	Type string `json:"type"`
+	Text string `json:"text,omitempty"`
+}
+
+type metaInteractiveText struct {
+	Text string `json:"text"`
+}
+
+type metaAction struct {
+	Buttons []metaButton `json:"buttons"`
+}
+
+type metaButton struct {
+	Type  string         `json:"type"`
+	Reply metaReplyTitle `json:"reply"`
+}
+
+type metaReplyTitle struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+}
+
+// metaResponse is the body of an accepted send.
+type metaResponse struct {
+	Messages []struct {
+		ID string `json:"id"`
+	} `json:"messages"`
+}
+
+// metaErrorResponse is the body of a rejected send.
+type metaErrorResponse struct {
+	Error struct {
+		Message      string `json:"message"`
+		Type         string `json:"type"`
+		Code         int    `json:"code"`
+		ErrorSubcode int    `json:"error_subcode"`
+		FBTraceID    string `json:"fbtrace_id"`
+	} `json:"error"`
+}
+
+// newMetaMessage builds the request for n: its template, reply buttons or
+// media when set, otherwise the configured template (META_TEMPLATE_NAME)
+// with the body as its only parameter, or plain text when no template is
+// configured.
+func newMetaMessage(n channel.Notification) (metaMessage, error) {
+	msg := metaMessage{MessagingProduct: "whatsapp", RecipientType: "individual", To: n.Contact}
+	if err := n.ValidateContent(); err != nil {
+		return msg, err
+	}
+
+	switch {
+	case n.Template != nil:
+		if err := n.Template.Validate(); err != nil {
+			return msg, err
+		}
+		msg.Type = "template"
+		msg.Template = newMetaTemplate(n.Template)
+
+	case n.Interactive != nil:
+		if err := n.Interactive.Validate(); err != nil {
+			return msg, err
+		}
+		if n.Body == "" {
+			return msg, fmt.Errorf("interactive message has no body")
+		}
+		msg.Type = "interactive"
+		msg.Interactive = &metaInteractive{Type: "button", Body: metaInteractiveText{Text: n.Body}}
+		if n.Interactive.Header != "" {
+			msg.Interactive.Header = &metaInteractiveHeader{Type: "text", Text: n.Interactive.Header}
+		}
+		if n.Interactive.Footer != "" {
+			msg.Interactive.Footer = &metaInteractiveText{Text: n.Interactive.Footer}
+		}
+		for _, b := range n.Interactive.Buttons {
+			msg.Interactive.Action.Buttons = append(msg.Interactive.Action.Buttons, metaButton{Type: "reply", Reply: metaReplyTitle{ID: b.ID, Title: b.Title}})
+		}
+
+	case n.Media != nil:
+		media := &metaMedia{Link: n.Media.URL, Caption: n.Media.Caption}
+		if media.Caption == "" {
+			media.Caption = n.Body
+		}
+		msg.Type = n.Media.Kind
+		switch n.Media.Kind {
+		case channel.MediaImage:
+			msg.Image = media
+		case channel.MediaVideo:
+			msg.Video = media
+		case channel.MediaDocument:
+			media.Filename = n.Media.FileName
+			msg.Document = media
+		default:
+			return msg, fmt.Errorf("unsupported media kind %q", n.Media.Kind)
+		}
+
+	case metaTemplateName != "":
+		msg.Type = "template"
+		msg.Template = newMetaTemplate(&channel.Template{
+			Name:     metaTemplateName,
+			Language: metaTemplateLanguage,
+			Body:     []channel.TemplateParameter{{Text: n.Body}},
+		})
+
+	default:
+		msg.Type = "text"
+		msg.Text = &metaText{Body: n.Body}
+	}
+
+	return msg, nil
+}
+
+func newMetaTemplate(t *channel.Template) *metaTemplate {
+	tmpl := &metaTemplate{Name: t.Name, Language: metaLanguage{Code: t.Language}}
+
+	if h := t.Header; h != nil {
+		p := metaParameter{Type: h.Kind}
+		media := &metaMedia{Link: h.URL}
+		switch h.Kind {
+		case channel.MediaImage:
+			p.Image = media
+		case channel.MediaVideo:
+			p.Video = media
+		case channel.MediaDocument:
+			media.Filename = h.FileName
+			p.Document = media
+		}
+		tmpl.Components = append(tmpl.Components, metaComponent{Type: "header", Parameters: []metaParameter{p}})
+	}
+
+	if len(t.Body) > 0 {
+		body := metaComponent{Type: "body"}
+		for _, v := range t.Body {
+			body.Parameters = append(body.Parameters, metaParameter{Type: "text", ParameterName: v.Name, Text: v.Text})
+		}
+		tmpl.Components = append(tmpl.Components, body)
+	}
+
+	for i, b := range t.Buttons {
+		button := metaComponent{Type: "button", Index: strconv.Itoa(i)}
+		if b.Type == channel.ButtonQuickReply {
+			button.SubType = "quick_reply"
+			button.Parameters = []metaParameter{{Type: "payload", Payload: b.Payload}}
+		} else {
+			button.SubType = "url"
+			button.Parameters = []metaParameter{{Type: "text", Text: b.Text}}
+		}
+		tmpl.Components = append(tmpl.Components, button)
+	}
+
+	return tmpl
+}
@@ -0,0 +1,241 @@
+package processor
+
+import (
+	"boh/notification-service/channel"
+	"boh/notification-service/correlation"
+	"boh/notification-service/delivery"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestNewMetaMessage_EscapesBody tests that quotes, newlines and backslashes stay inside the body parameter
+func TestNewMetaMessage_EscapesBody(t *testing.T) {
+	body := "Paid \"ACME\"\nline two \\ {\"to\":\"+15550000000\"}"
+	msg, err := newMetaMessage(channel.Notification{Contact: "+1234567890", Body: body})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatalf("Expected valid JSON, got %v", err)
+	}
+	var decoded metaMessage
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Expected payload to round-trip, got %v", err)
+	}
+	if decoded.To != "+1234567890" || decoded.Template.Name != defaultMetaTemplateName ||
+		decoded.Template.Components[0].Parameters[0].Text != body {
+		t.Errorf("Unexpected payload: %s", data)
+	}
+}
+
+// TestNewMetaMessage_Kinds tests the text, template and media request shapes
+func TestNewMetaMessage_Kinds(t *testing.T) {
+	defer func(name string) { metaTemplateName = name }(metaTemplateName)
+
+	metaTemplateName = ""
+	msg, _ := newMetaMessage(channel.Notification{Contact: "+1234567890", Body: "hi"})
+	if msg.Type != "text" || msg.Text.Body != "hi" {
+		t.Errorf("Expected a text message, got %+v", msg)
+	}
+
+	msg, _ = newMetaMessage(channel.Notification{Contact: "+1234567890", Body: "Your statement", Media: &channel.Media{Kind: channel.MediaDocument, URL: "https://example.com/s.pdf", FileName: "s.pdf"}})
+	if msg.Type != "document" || msg.Document.Link != "https://example.com/s.pdf" || msg.Document.Caption != "Your statement" || msg.Document.Filename != "s.pdf" {
+		t.Errorf("Expected a document message, got %+v", msg)
+	}
+
+	msg, _ = newMetaMessage(channel.Notification{Contact: "+1234567890", Template: &channel.Template{
+		Name:     "fraud_alert",
+		Language: "en_GB",
+		Header:   &channel.Media{Kind: channel.MediaImage, URL: "https://example.com/logo.png"},
+		Body:     []channel.TemplateParameter{{Name: "amount", Text: "10.00"}},
+		Buttons:  []channel.TemplateButton{{Type: channel.ButtonQuickReply, Payload: "yes"}, {Type: channel.ButtonURL, Text: "txn/1"}},
+	}})
+	components := msg.Template.Components
+	if msg.Template.Language.Code != "en_GB" || len(components) != 4 {
+		t.Fatalf("Expected 4 components in en_GB, got %+v", msg.Template)
+	}
+	if components[0].Parameters[0].Image.Link != "https://example.com/logo.png" ||
+		components[1].Parameters[0].ParameterName != "amount" ||
+		components[2].SubType != "quick_reply" || components[2].Index != "0" || components[2].Parameters[0].Payload != "yes" ||
+		components[3].SubType != "url" || components[3].Index != "1" || components[3].Parameters[0].Text != "txn/1" {
+		t.Errorf("Unexpected components: %+v", components)
+	}
+
+	if _, err := newMetaMessage(channel.Notification{Contact: "+1234567890", Template: &channel.Template{Name: "fraud_alert"}}); err == nil {
+		t.Error("Expected an error for a template without a language")
+	}
+}
+
+// TestSendSmsViaMeta_Response tests that the message id and error object are parsed from Meta responses
+func TestSendSmsViaMeta_Response(t *testing.T) {
+	status, reply := http.StatusOK, `{"messaging_product":"whatsapp","messages":[{"id":"wamid.123"}]}`
+	var sent metaMessage
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		json.Unmarshal(data, &sent)
+		w.WriteHeader(status)
+		w.Write([]byte(reply))
+	}))
+	defer srv.Close()
+
+	defer func(token, url string) { metaApiToken, metaApiUrl = token, url }(metaApiToken, metaApiUrl)
+	metaApiToken, metaApiUrl = "test_token", srv.URL
+
+	msg, _ := newMetaMessage(channel.Notification{Contact: "+1234567890", Body: "hi"})
+	id, err := sendSmsViaMeta(context.Background(), msg)
+	if err != nil || id != "wamid.123" {
+		t.Fatalf("Expected wamid.123, got %q err=%v", id, err)
+	}
+	if sent.MessagingProduct != "whatsapp" || sent.To != "+1234567890" {
+		t.Errorf("Unexpected request: %+v", sent)
+	}
+
+	status, reply = http.StatusBadRequest, `{"error":{"message":"(#130429) Rate limit hit","type":"OAuthException","code":130429,"fbtrace_id":"Az8or"}}`
+	_, err = sendSmsViaMeta(context.Background(), msg)
+
+	var statusErr *metaStatusError
+	if !errors.As(err, &statusErr) || statusErr.Code != 130429 || statusErr.FBTraceID != "Az8or" {
+		t.Fatalf("Expected a parsed Meta error, got %v", err)
+	}
+	if !(whatsAppChannel{}).Retryable(err) {
+		t.Error("Expected a rate limit error to be retryable")
+	}
+}
+
+// TestNewMetaMessage_Interactive tests the reply button request shape
+func TestNewMetaMessage_Interactive(t *testing.T) {
+	msg, err := newMetaMessage(channel.Notification{Contact: "+1234567890", Body: "Was this you?", Interactive: &channel.Interactive{
+		Footer:  "BOH Fraud Team",
+		Buttons: []channel.ReplyButton{{ID: "confirm", Title: "Yes, it was me"}, {ID: "block", Title: "No, block my card"}},
+	}})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	i := msg.Interactive
+	if msg.Type != "interactive" || i.Type != "button" || i.Body.Text != "Was this you?" || i.Footer.Text != "BOH Fraud Team" ||
+		len(i.Action.Buttons) != 2 || i.Action.Buttons[1].Type != "reply" || i.Action.Buttons[1].Reply.ID != "block" {
+		t.Errorf("Unexpected interactive message: %+v", i)
+	}
+
+	if _, err := newMetaMessage(channel.Notification{Contact: "+1234567890", Interactive: &channel.Interactive{Buttons: []channel.ReplyButton{{ID: "a", Title: "A"}}}}); err == nil {
+		t.Error("Expected an error for an interactive message without a body")
+	}
+}
+
+// TestProcessMessageResults_ChannelRetryPolicy tests that <CHANNEL>_RETRY_* overrides the default policy for one channel
+func TestProcessMessageResults_ChannelRetryPolicy(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	defer func(token, url string) { metaApiToken, metaApiUrl = token, url }(metaApiToken, metaApiUrl)
+	metaApiToken, metaApiUrl = "test_token", srv.URL
+	t.Setenv("RETRY_MAX_ATTEMPTS", "3")
+	t.Setenv("RETRY_BASE_DELAY", "1ms")
+	t.Setenv("WHATSAPP_RETRY_MAX_ATTEMPTS", "1")
+	policies.Reset()
+	t.Cleanup(policies.Reset)
+
+	results, _ := ProcessMessageResults(context.Background(), []byte(`{"notificationMessage":"hi","channels":[{"type":"WHATSAPP","contact":"+1234567890"}]}`))
+	if got := atomic.LoadInt32(&calls); got != 1 || results[0].Attempts != 1 {
+		t.Errorf("Expected a single attempt, got %d calls and %d attempts", got, results[0].Attempts)
+	}
+}
+
+// TestEmailChannel_Retryable tests that 4xx replies are retried and 5xx replies are not, as on the notifier path
+func TestEmailChannel_Retryable(t *testing.T) {
+	tests := []struct {
+		err       error
+		retryable bool
+	}{
+		{&textproto.Error{Code: 421, Msg: "try again later"}, true},
+		{&textproto.Error{Code: 535, Msg: "auth failed"}, false},
+		{&textproto.Error{Code: 550, Msg: "mailbox unavailable"}, false},
+		{&textproto.Error{Code: 554, Msg: "5.7.1 content rejected"}, false},
+		{errSMTPNotInitialized, false},
+	}
+	for _, tt := range tests {
+		if got := (emailChannel{}).Retryable(tt.err); got != tt.retryable {
+			t.Errorf("Retryable(%v) = %v, want %v", tt.err, got, tt.retryable)
+		}
+	}
+}
+
+// TestNewMetaMessage_ExclusiveContent tests that a template cannot be combined with media
+func TestNewMetaMessage_ExclusiveContent(t *testing.T) {
+	_, err := newMetaMessage(channel.Notification{
+		Contact:  "+1234567890",
+		Template: &channel.Template{Name: "statement", Language: "en_US"},
+		Media:    &channel.Media{Kind: channel.MediaDocument, URL: "https://example.com/a.pdf"},
+	})
+	if err == nil {
+		t.Error("Expected an error for a template with media")
+	}
+}
+
+// TestProcessMessageResults_RecordsDelivery tests that a Meta send is recorded by message id for the status webhooks
+func TestProcessMessageResults_RecordsDelivery(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"messaging_product":"whatsapp","messages":[{"id":"wamid.123"}]}`))
+	}))
+	defer srv.Close()
+
+	defer func(token, url string) { metaApiToken, metaApiUrl = token, url }(metaApiToken, metaApiUrl)
+	metaApiToken, metaApiUrl = "test_token", srv.URL
+	store := delivery.NewMemoryStore(delivery.DefaultTTL)
+	SetDeliveryStore(store)
+	t.Cleanup(func() { SetDeliveryStore(delivery.NewMemoryStore(delivery.DefaultTTL)) })
+
+	body := []byte(`{"notificationId":"n-1","notificationMessage":"hi","channels":[{"type":"WHATSAPP","contact":"+1234567890"}]}`)
+	if _, err := ProcessMessageResults(context.Background(), body); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	rec, updated, err := delivery.UpdateStatus(context.Background(), store, "wamid.123", delivery.StatusDelivered, time.Now())
+	if err != nil || !updated || rec.Key != delivery.NewKey("n-1", "WHATSAPP", "+1234567890") {
+		t.Errorf("Expected the delivery to be found by message id, got %+v updated=%v err=%v", rec, updated, err)
+	}
+}
+
+// TestProcessMessageResults_RecordsCorrelation tests that interactive sends
+// can be traced back from the reply
+func TestProcessMessageResults_RecordsCorrelation(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"messaging_product":"whatsapp","messages":[{"id":"wamid.456"}]}`))
+	}))
+	defer srv.Close()
+
+	defer func(token, url string) { metaApiToken, metaApiUrl = token, url }(metaApiToken, metaApiUrl)
+	metaApiToken, metaApiUrl = "test_token", srv.URL
+	store := correlation.NewMemoryStore(time.Hour)
+	SetCorrelationStore(store)
+	t.Cleanup(func() { SetCorrelationStore(correlation.NewMemoryStore(correlation.DefaultTTL)) })
+
+	body := []byte(`{"notificationId":"fraud-1","userId":"user123","notificationMessage":"Was this you?","channels":[
+		{"type":"WHATSAPP","contact":"+1234567890","interactive":{"buttons":[{"id":"confirm","title":"Yes, it was me"},{"id":"block","title":"No, block my card"}]}},
+		{"type":"SMS","contact":"+1234567891"}]}`)
+	if _, err := ProcessMessageResults(context.Background(), body); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	rec, ok, err := store.Get(context.Background(), "wamid.456")
+	if err != nil || !ok {
+		t.Fatalf("Expected a correlation for wamid.456, got ok=%v err=%v", ok, err)
+	}
+	if rec.NotificationID != "fraud-1" || rec.UserID != "user123" || rec.Contact != "+1234567890" {
+		t.Errorf("Unexpected correlation: %+v", rec)
+	}
+}
@@ -1,6 +1,9 @@
 package processor
 
 import (
+	"boh/notification-service/channel"
+	"boh/notification-service/email"
+	"boh/notification-service/retry"
 	"bytes"
 	"context"
 
@@ -9,23 +12,35 @@ import (
 	"fmt"
 	"log"
 	"net/http" // Used for Meta
-	"net/smtp" // <-- ADDED: For sending email via SMTP
 	"os"
+	"strings"
 )
 
 // --- Structs to match the JSON message contract ---
 
 type NotificationChannel struct {
-	Type    string `json:"type"`
-	Contact string `json:"contact"`
+	Type        string               `json:"type"`
+	Contact     string               `json:"contact"`
+	Template    *channel.Template    `json:"template,omitempty"`
+	Media       *channel.Media       `json:"media,omitempty"`
+	Interactive *channel.Interactive `json:"interactive,omitempty"`
+	Cc          []string             `json:"cc,omitempty"`
+	Bcc         []string             `json:"bcc,omitempty"`
+	ReplyTo     []string             `json:"replyTo,omitempty"`
 }
 
 type NotificationEvent struct {
+	NotificationID      string                `json:"notificationId"`
 	UserID              string                `json:"userId"`
 	NotificationMessage string                `json:"notificationMessage"`
 	Channels            []NotificationChannel `json:"channels"`
 }
 
+const (
+	defaultMetaTemplateName     = "transaction_update"
+	defaultMetaTemplateLanguage = "en_US"
+)
+
 // --- Client variables ---
 var (
 	// ACS (Email) variables - Now for SMTP
@@ -34,22 +49,61 @@ var (
 	smtpUsername string
 	smtpPassword string
 	smtpSender   string // The "From" email address
+	// TLS, auth and timeout settings, shared with the notifier through SMTP_*
+	smtpTransport *email.Transport
 
 	// Meta (WhatsApp) variables
 	metaApiToken string
 	metaApiUrl   string
+
+	// Template sent for notifications without their own template or media
+	// (META_TEMPLATE_NAME, META_TEMPLATE_LANGUAGE). An empty name sends
+	// plain text, which WhatsApp only delivers inside the 24-hour window.
+	metaTemplateName     = defaultMetaTemplateName
+	metaTemplateLanguage = defaultMetaTemplateLanguage
+
+	// policies holds the retry policy and circuit breaker of each channel.
+	// The breakers are named apart from the notifier's.
+	policies = channel.Policies{BreakerPrefix: "processor-"}
 )
 
 // Init sets up the clients (call this from main.go)
 func Init() {
 	// 1. Setup Azure Communication Services (Email via SMTP)
-	smtpHost = os.Getenv("SMTP_HOST")         // e.g., "smtp.communication.azure.com"
-	smtpPort = os.Getenv("SMTP_PORT")         // e.g., "587"
-	smtpUsername = os.Getenv("SMTP_USERNAME") // Your Client ID or full username
-	smtpPassword = os.Getenv("SMTP_PASSWORD") // Your Client Secret
-	smtpSender = os.Getenv("ACS_SENDER_EMAIL")   // e.g., "donotreply@your-domain.com"
-
-	if smtpHost == "" || smtpPort == "" || smtpUsername == "" || smtpPassword == "" || smtpSender == "" {
+	// SMTP_HOST (e.g. "smtp.communication.azure.com"), SMTP_PORT (e.g. "587"),
+	// SMTP_USERNAME and SMTP_PASSWORD, plus the optional SMTP_TLS_MODE,
+	// SMTP_AUTH (default plain), SMTP_CA_FILE, SMTP_SERVER_NAME and timeouts.
+	smtpConfig, err := email.TransportConfigFromEnv()
+	if err != nil {
+		log.Printf("Warning: %v", err)
+	}
+	if smtpConfig.Auth == "" {
+		smtpConfig.Auth = email.AuthPlain
+	}
+	if smtpConfig.Auth == email.AuthXOAuth2 {
+		// This path has no token source, so the transport cannot be built.
+		log.Println("Error: SMTP_AUTH xoauth2 is not supported by the processor. Email will be disabled; use plain, login or cram-md5.")
+		smtpConfig.Host = ""
+	}
+	smtpHost = smtpConfig.Host
+	smtpPort = smtpConfig.Port
+	smtpUsername = smtpConfig.Username
+	smtpPassword = smtpConfig.Password
+	smtpSender = os.Getenv("ACS_SENDER_EMAIL") // e.g., "donotreply@your-domain.com"
+
+	if smtpTransport != nil {
+		// Init may run again with other settings, as the tests do; close
+		// the old pool so its connections do not leak.
+		smtpTransport.Close(context.Background())
+	}
+	smtpTransport = nil
+	if smtpHost != "" {
+		smtpTransport, err = email.NewTransport(smtpConfig)
+		if err != nil {
+			log.Printf("Warning: invalid SMTP settings: %v", err)
+		}
+	}
+	if !smtpConfigured() || smtpSender == "" {
 		log.Println("Warning: SMTP variables not fully set. Email will be disabled.")
 	} else {
 		log.Println("Azure Communication Services (SMTP) client configured.")
@@ -63,115 +117,145 @@ func Init() {
 	} else {
 		log.Println("Meta (WhatsApp) API configured.")
 	}
+	metaTemplateName = defaultMetaTemplateName
+	if name, ok := os.LookupEnv("META_TEMPLATE_NAME"); ok {
+		metaTemplateName = name
+	}
+	metaTemplateLanguage = os.Getenv("META_TEMPLATE_LANGUAGE")
+	if metaTemplateLanguage == "" {
+		metaTemplateLanguage = defaultMetaTemplateLanguage
+	}
+
+	// 3. Retry policies and circuit breakers are read again on first use.
+	policies.Reset()
 }
 
 // ProcessMessage handles a single message received from Service Bus
 func ProcessMessage(ctx context.Context, messageBody []byte) error {
+	_, err := ProcessMessageResults(ctx, messageBody)
+	return err
+}
+
+// ProcessMessageResults is ProcessMessage, but also returns the outcome of
+// every channel so callers can tell which ones failed.
+func ProcessMessageResults(ctx context.Context, messageBody []byte) ([]channel.DeliveryResult, error) {
 	log.Printf("Processing message: %s\n", string(messageBody))
 
 	var event NotificationEvent
 	if err := json.Unmarshal(messageBody, &event); err != nil {
 		log.Printf("Error unmarshalling message: %v\n", err)
-		return fmt.Errorf("failed to parse message body: %w", err)
+		return nil, channel.Permanent(fmt.Errorf("failed to parse message body: %w", err))
 	}
 
 	if event.NotificationMessage == "" || len(event.Channels) == 0 {
 		log.Println("Message has no message body or channels. Skipping.")
-		return nil
+		return nil, nil
 	}
 
-	var hasError bool
+	results := make([]channel.DeliveryResult, 0, len(event.Channels))
 
-	for _, channel := range event.Channels {
-		switch channel.Type {
-		case "EMAIL":
-			// Call the new, simpler SMTP function
-			if err := sendEmailViaSMTP(ctx, channel.Contact, "Transaction Notification", event.NotificationMessage); err != nil {
-				log.Printf("Failed to send EMAIL to %s: %v\n", channel.Contact, err)
-				hasError = true
-			}
-		case "WHATSAPP":
-			if err := sendSmsViaMeta(ctx, channel.Contact, event.NotificationMessage); err != nil {
-				log.Printf("Failed to send WHATSAPP to %s: %v\n", channel.Contact, err)
-				hasError = true
+	for _, target := range event.Channels {
+		provider, ok := registry.Lookup(target.Type)
+		if !ok {
+			log.Printf("Warning: Unknown notification type '%s'\n", target.Type)
+			results = append(results, channel.DeliveryResult{Channel: target.Type, Contact: target.Contact, Status: channel.StatusUnsupported})
+			continue
+		}
+
+		result := channel.Deliver(ctx, policies.Wrap(provider), channel.Notification{
+			UserID:      event.UserID,
+			Contact:     target.Contact,
+			Subject:     "Transaction Notification",
+			Body:        event.NotificationMessage,
+			Template:    target.Template,
+			Media:       target.Media,
+			Interactive: target.Interactive,
+			Cc:          target.Cc,
+			Bcc:         target.Bcc,
+			ReplyTo:     target.ReplyTo,
+		})
+		if result.Status == channel.StatusFailed {
+			log.Printf("Failed to send %s to %s (%s, %d attempts): %s\n", result.Channel, result.Contact, result.ErrorClass, result.Attempts, result.Error)
+		}
+		if result.Status == channel.StatusSent {
+			recordSent(ctx, event, result)
+			if target.Interactive != nil {
+				recordCorrelation(ctx, event, result)
 			}
-		default:
-			log.Printf("Warning: Unknown notification type '%s'\n", channel.Type)
 		}
+		results = append(results, result)
 	}
 
-	if hasError {
-		return fmt.Errorf("failed to send one or more notifications")
+	if err := channel.ResultsError(results); err != nil {
+		return results, fmt.Errorf("failed to send one or more notifications: %w", err)
 	}
 
 	log.Println("Successfully processed message and sent all notifications.")
-	return nil
+	return results, nil
 }
 
 // --- Notification Sending Functions ---
 
 // sendEmailViaSMTP uses Go's built-in SMTP client.
 func sendEmailViaSMTP(ctx context.Context, toEmail, subject, body string) error {
-	if smtpHost == "" || smtpPassword == "" {
-		return fmt.Errorf("SMTP client is not initialized")
-	}
+	return sendEmail(ctx, email.Message{From: smtpSender, To: []string{toEmail}, Subject: subject, Text: body})
+}
 
-	// 1. Set up authentication information.
-	// We use PlainAuth, which is what most SMTP servers (including ACS) expect.
-	auth := smtp.PlainAuth("", smtpUsername, smtpPassword, smtpHost)
+// smtpConfigured reports whether the transport is set up with a host, and
+// with a password when it logs in with one.
+func smtpConfigured() bool {
+	if smtpTransport == nil || smtpHost == "" {
+		return false
+	}
+	return !smtpTransport.UsesPassword() || smtpPassword != ""
+}
 
-	// 2. Format the email message (MIME format)
-	// Note: We need to manually add headers.
-	msg := []byte(
-		"To: " + toEmail + "\r\n" +
-			"From: " + smtpSender + "\r\n" +
-			"Subject: " + subject + "\r\n" +
-			"Content-Type: text/plain; charset=UTF-8\r\n" +
-			"\r\n" + // Empty line separates headers from body
-			body + "\r\n")
+// sendEmail sends message to its To, Cc and Bcc recipients.
+func sendEmail(ctx context.Context, message email.Message) error {
+	if !smtpConfigured() {
+		return errSMTPNotInitialized
+	}
 
-	// 3. Send the email
-	// We combine the host and port for the address.
-	addr := fmt.Sprintf("%s:%s", smtpHost, smtpPort)
+	// 1. Build the MIME message, with an HTML alternative of a plain-text body.
+	// Invalid addresses and header values will not improve on retry.
+	msg, err := message.Bytes()
+	if err != nil {
+		return channel.Permanent(fmt.Errorf("build email: %w", err))
+	}
+	sender, _ := message.Sender()
+	recipients, _ := message.Recipients()
 
-	err := smtp.SendMail(addr, auth, smtpSender, []string{toEmail}, msg)
+	// 2. Send the email with the configured TLS mode and auth mechanism
+	// (PlainAuth by default, which is what most SMTP servers, including ACS,
+	// expect).
+	err = smtpTransport.Send(ctx, sender, recipients, msg)
 	if err != nil {
-		return fmt.Errorf("SMTP SendMail failed: %w", err)
+		err = fmt.Errorf("SMTP SendMail failed: %w", err)
+		if email.IsPermanent(err) {
+			return channel.Permanent(err)
+		}
+		return err
 	}
-	
 
-	log.Printf("Successfully sent EMAIL to %s\n", toEmail)
+	log.Printf("Successfully sent EMAIL to %s\n", strings.Join(recipients, ", "))
 	return nil
 }
 
-// sendSmsViaMeta... (This function remains unchanged)
-func sendSmsViaMeta(ctx context.Context, toPhone, body string) error {
+// sendSmsViaMeta posts msg to the Meta Cloud API and returns the WhatsApp
+// message id.
+func sendSmsViaMeta(ctx context.Context, msg metaMessage) (string, error) {
 	if metaApiToken == "" || metaApiUrl == "" {
-		return fmt.Errorf("Meta API is not configured")
-	}
-
-	// NOTE: This assumes a pre-approved template named 'transaction_update'
-	payload := fmt.Sprintf(`{
-        "messaging_product": "whatsapp",
-        "to": "%s",
-        "type": "template",
-        "template": {
-            "name": "transaction_update", 
-            "language": { "code": "en_US" },
-            "components": [
-                {
-                    "type": "body",
-                    "parameters": [
-                        { "type": "text", "text": "%s" }
-                    ]
-                }
-            ]
-        }
-    }`, toPhone, body)
-
-	req, err := http.NewRequestWithContext(ctx, "POST", metaApiUrl, bytes.NewBufferString(payload))
+		return "", errMetaNotConfigured
+	}
+
+	payload, err := json.Marshal(msg)
 	if err != nil {
-		return fmt.Errorf("failed to create Meta request: %w", err)
+		return "", fmt.Errorf("failed to encode Meta request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", metaApiUrl, bytes.NewReader(payload))
+	if err != nil {
+		return "", fmt.Errorf("failed to create Meta request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
@@ -180,17 +264,30 @@ func sendSmsViaMeta(ctx context.Context, toPhone, body string) error {
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to send Meta request: %w", err)
+		return "", fmt.Errorf("failed to send Meta request: %w", err)
 	}
 	defer resp.Body.Close()
 
+	var body bytes.Buffer
+	if _, err := body.ReadFrom(resp.Body); err != nil {
+		return "", fmt.Errorf("failed to read Meta response: %w", err)
+	}
+
 	if resp.StatusCode >= 300 {
-		var errResp bytes.Buffer
-		errResp.ReadFrom(resp.Body)
-		return fmt.Errorf("Meta API returned error status %d: %s", resp.StatusCode, errResp.String())
+		err := newMetaStatusError(resp.StatusCode, body.Bytes())
+		if after, ok := retry.ParseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			return "", retry.WithRetryAfter(err, after)
+		}
+		return "", err
 	}
 
-	log.Printf("Successfully sent WHATSAPP to %s\n", toPhone)
-	return nil
-}
+	var accepted metaResponse
+	if err := json.Unmarshal(body.Bytes(), &accepted); err != nil || len(accepted.Messages) == 0 {
+		// The message was accepted; only its id is missing.
+		log.Printf("Meta response for %s has no message id: %s\n", msg.To, body.String())
+		return "", nil
+	}
 
+	log.Printf("Successfully sent WHATSAPP to %s (%s)\n", msg.To, accepted.Messages[0].ID)
+	return accepted.Messages[0].ID, nil
+}
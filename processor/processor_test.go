@@ -3,7 +3,9 @@ package processor
 import (
 	"context"
 	"encoding/json"
+	"log"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -355,7 +357,7 @@ func TestSendSmsViaMeta_NotConfigured(t *testing.T) {
 	metaApiUrl = ""
 	
 	ctx := context.Background()
-	err := sendSmsViaMeta(ctx, "+1234567890", "Test message")
+	_, err := sendSmsViaMeta(ctx, metaMessage{To: "+1234567890", Type: "text", Text: &metaText{Body: "Test message"}})
 	
 	if err == nil {
 		t.Error("Expected error for unconfigured Meta API, got nil")
@@ -371,7 +373,7 @@ func TestSendSmsViaMeta_MissingToken(t *testing.T) {
 	metaApiUrl = "https://api.test.com"
 	
 	ctx := context.Background()
-	err := sendSmsViaMeta(ctx, "+1234567890", "Test message")
+	_, err := sendSmsViaMeta(ctx, metaMessage{To: "+1234567890", Type: "text", Text: &metaText{Body: "Test message"}})
 	
 	if err == nil {
 		t.Error("Expected error for missing Meta API token, got nil")
@@ -384,7 +386,7 @@ func TestSendSmsViaMeta_MissingUrl(t *testing.T) {
 	metaApiUrl = ""
 	
 	ctx := context.Background()
-	err := sendSmsViaMeta(ctx, "+1234567890", "Test message")
+	_, err := sendSmsViaMeta(ctx, metaMessage{To: "+1234567890", Type: "text", Text: &metaText{Body: "Test message"}})
 	
 	if err == nil {
 		t.Error("Expected error for missing Meta API URL, got nil")
@@ -520,3 +522,24 @@ func TestProcessMessage_NilBody(t *testing.T) {
 		t.Error("Expected error for nil message body, got nil")
 	}
 }
+
+// TestInit_XOAuth2Rejected tests that xoauth2 disables email with an error rather than silently
+func TestInit_XOAuth2Rejected(t *testing.T) {
+	t.Setenv("SMTP_HOST", "smtp.office365.com")
+	t.Setenv("SMTP_PORT", "587")
+	t.Setenv("SMTP_USERNAME", "sender@test.com")
+	t.Setenv("SMTP_AUTH", "xoauth2")
+	t.Setenv("ACS_SENDER_EMAIL", "sender@test.com")
+
+	var logs strings.Builder
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+	Init()
+
+	if smtpConfigured() {
+		t.Error("Expected email to be disabled")
+	}
+	if !strings.Contains(logs.String(), "Error: SMTP_AUTH xoauth2 is not supported by the processor") {
+		t.Errorf("Expected an error naming SMTP_AUTH, got logs: %s", logs.String())
+	}
+}
@@ -0,0 +1,43 @@
+package publisher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+)
+
+// Sender is the subset of *azservicebus.Sender used by the publisher.
+type Sender interface {
+	SendMessage(ctx context.Context, message *azservicebus.Message, options *azservicebus.SendMessageOptions) error
+}
+
+// Publisher sends JSON events to a Service Bus queue or topic.
+type Publisher struct {
+	sender Sender
+}
+
+func New(sender Sender) *Publisher {
+	return &Publisher{sender: sender}
+}
+
+// Publish marshals v as the message body. correlationID, when set, lets
+// consumers tie the event back to the message that produced it.
+func (p *Publisher) Publish(ctx context.Context, v any, correlationID string) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("marshal event: %w", err)
+	}
+
+	contentType := "application/json"
+	msg := &azservicebus.Message{Body: body, ContentType: &contentType}
+	if correlationID != "" {
+		msg.CorrelationID = &correlationID
+	}
+
+	if err := p.sender.SendMessage(ctx, msg, nil); err != nil {
+		return fmt.Errorf("send event: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package publisher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+)
+
+type fakeSender struct {
+	sent []*azservicebus.Message
+	err  error
+}
+
+func (s *fakeSender) SendMessage(ctx context.Context, message *azservicebus.Message, options *azservicebus.SendMessageOptions) error {
+	s.sent = append(s.sent, message)
+	return s.err
+}
+
+// TestPublish_MarshalsBody tests that events are sent as JSON with a correlation id
+func TestPublish_MarshalsBody(t *testing.T) {
+	s := &fakeSender{}
+	p := New(s)
+
+	event := map[string]string{"notificationId": "n1"}
+	if err := p.Publish(context.Background(), event, "n1"); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+
+	if len(s.sent) != 1 {
+		t.Fatalf("Expected 1 message, got: %d", len(s.sent))
+	}
+	msg := s.sent[0]
+	var got map[string]string
+	if err := json.Unmarshal(msg.Body, &got); err != nil || got["notificationId"] != "n1" {
+		t.Errorf("Unexpected body %s: %v", msg.Body, err)
+	}
+	if msg.CorrelationID == nil || *msg.CorrelationID != "n1" {
+		t.Errorf("Expected correlation id n1, got: %v", msg.CorrelationID)
+	}
+	if msg.ContentType == nil || *msg.ContentType != "application/json" {
+		t.Errorf("Expected JSON content type, got: %v", msg.ContentType)
+	}
+}
+
+// TestPublish_SendError tests that sender failures are returned
+func TestPublish_SendError(t *testing.T) {
+	p := New(&fakeSender{err: errors.New("link detached")})
+	if err := p.Publish(context.Background(), struct{}{}, ""); err == nil {
+		t.Error("Expected error, got nil")
+	}
+}
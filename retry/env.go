@@ -0,0 +1,28 @@
+package retry
+
+import (
+	"boh/notification-service/env"
+	"log"
+	"os"
+	"strconv"
+)
+
+// FromEnv overrides def with <prefix>RETRY_MAX_ATTEMPTS, <prefix>RETRY_BASE_DELAY,
+// <prefix>RETRY_MAX_DELAY and <prefix>RETRY_JITTER when they are set, e.g.
+// FromEnv("EMAIL_", p) reads EMAIL_RETRY_MAX_ATTEMPTS.
+func FromEnv(prefix string, def Policy) Policy {
+	p := def
+
+	p.MaxAttempts = env.Int(prefix+"RETRY_MAX_ATTEMPTS", def.MaxAttempts)
+	p.BaseDelay = env.NonNegativeDuration(prefix+"RETRY_BASE_DELAY", def.BaseDelay)
+	p.MaxDelay = env.NonNegativeDuration(prefix+"RETRY_MAX_DELAY", def.MaxDelay)
+	if v := os.Getenv(prefix + "RETRY_JITTER"); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil && f >= 0 && f <= 1 {
+			p.Jitter = f
+		} else {
+			log.Printf("Invalid %sRETRY_JITTER %q, using %g", prefix, v, def.Jitter)
+		}
+	}
+
+	return p
+}
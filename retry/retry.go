@@ -0,0 +1,129 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Policy describes how a failing operation is retried.
+type Policy struct {
+	// MaxAttempts is the total number of calls, including the first one.
+	MaxAttempts int
+	// BaseDelay is the wait before the second attempt; it doubles for each
+	// attempt after that up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Jitter randomly shortens each delay by up to this fraction (0-1) so
+	// workers that failed together do not retry together.
+	Jitter float64
+	// Retryable decides whether err is worth another attempt. Nil retries
+	// every error.
+	Retryable func(err error) bool
+}
+
+// DefaultPolicy makes three attempts over roughly a second and a half.
+var DefaultPolicy = Policy{
+	MaxAttempts: 3,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    10 * time.Second,
+	Jitter:      0.2,
+}
+
+// Do calls fn until it succeeds, returns a non-retryable error, the
+// attempts run out or ctx is done. It returns the number of calls made.
+//
+// When fn's error carries a Retry-After hint (see WithRetryAfter) the hint
+// replaces the computed backoff. A hint longer than MaxDelay stops retrying,
+// leaving the redelivery to the queue instead of holding a worker.
+func (p Policy) Do(ctx context.Context, fn func(ctx context.Context) error) (int, error) {
+	attempts := max(p.MaxAttempts, 1)
+
+	var err error
+	for n := 1; ; n++ {
+		err = fn(ctx)
+		if err == nil || n >= attempts {
+			return n, err
+		}
+		if p.Retryable != nil && !p.Retryable(err) {
+			return n, err
+		}
+
+		delay := p.Backoff(n)
+		if after, ok := RetryAfter(err); ok {
+			if p.MaxDelay > 0 && after > p.MaxDelay {
+				return n, err
+			}
+			delay = after
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return n, err
+		case <-timer.C:
+		}
+	}
+}
+
+// Backoff returns the delay after the given attempt (1-based).
+func (p Policy) Backoff(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt && (p.MaxDelay <= 0 || delay < p.MaxDelay); i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if p.Jitter > 0 {
+		delay -= time.Duration(rand.Float64() * p.Jitter * float64(delay))
+	}
+	return delay
+}
+
+// retryAfterError carries a server-provided wait before the next attempt.
+type retryAfterError struct {
+	err   error
+	after time.Duration
+}
+
+func (e *retryAfterError) Error() string { return e.err.Error() }
+func (e *retryAfterError) Unwrap() error { return e.err }
+
+// WithRetryAfter attaches a Retry-After hint to err.
+func WithRetryAfter(err error, after time.Duration) error {
+	if err == nil {
+		return nil
+	}
+	return &retryAfterError{err: err, after: after}
+}
+
+// RetryAfter returns the Retry-After hint attached to err, if any.
+func RetryAfter(err error) (time.Duration, bool) {
+	var r *retryAfterError
+	if errors.As(err, &r) {
+		return r.after, true
+	}
+	return 0, false
+}
+
+// ParseRetryAfter reads an HTTP Retry-After header, which is either a
+// number of seconds or an HTTP date.
+func ParseRetryAfter(value string) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(value); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(time.Until(t), 0), true
+	}
+	return 0, false
+}
@@ -0,0 +1,148 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+var errFlaky = errors.New("flaky")
+
+// TestDo_SucceedsAfterRetries tests that Do retries until fn succeeds
+func TestDo_SucceedsAfterRetries(t *testing.T) {
+	p := Policy{MaxAttempts: 5, BaseDelay: time.Millisecond}
+	calls := 0
+
+	attempts, err := p.Do(context.Background(), func(ctx context.Context) error {
+		calls++
+		if calls < 3 {
+			return errFlaky
+		}
+		return nil
+	})
+
+	if err != nil || attempts != 3 {
+		t.Errorf("Expected success after 3 attempts, got attempts=%d err=%v", attempts, err)
+	}
+}
+
+// TestDo_StopsAtMaxAttempts tests that Do gives up after MaxAttempts
+func TestDo_StopsAtMaxAttempts(t *testing.T) {
+	p := Policy{MaxAttempts: 3, BaseDelay: time.Millisecond}
+
+	attempts, err := p.Do(context.Background(), func(ctx context.Context) error { return errFlaky })
+
+	if !errors.Is(err, errFlaky) || attempts != 3 {
+		t.Errorf("Expected 3 failed attempts, got attempts=%d err=%v", attempts, err)
+	}
+}
+
+// TestDo_NonRetryable tests that the Retryable predicate stops retries
+func TestDo_NonRetryable(t *testing.T) {
+	p := Policy{MaxAttempts: 5, BaseDelay: time.Millisecond, Retryable: func(err error) bool { return false }}
+
+	attempts, _ := p.Do(context.Background(), func(ctx context.Context) error { return errFlaky })
+
+	if attempts != 1 {
+		t.Errorf("Expected 1 attempt, got: %d", attempts)
+	}
+}
+
+// TestDo_HonorsRetryAfter tests that a Retry-After hint replaces the backoff
+func TestDo_HonorsRetryAfter(t *testing.T) {
+	p := Policy{MaxAttempts: 2, BaseDelay: time.Hour, MaxDelay: time.Hour}
+	start := time.Now()
+
+	attempts, _ := p.Do(context.Background(), func(ctx context.Context) error {
+		return WithRetryAfter(errFlaky, 10*time.Millisecond)
+	})
+
+	if attempts != 2 {
+		t.Errorf("Expected 2 attempts, got: %d", attempts)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected Retry-After to override the 1h backoff, took %s", elapsed)
+	}
+}
+
+// TestDo_RetryAfterBeyondMaxDelay tests that a hint longer than MaxDelay stops retrying
+func TestDo_RetryAfterBeyondMaxDelay(t *testing.T) {
+	p := Policy{MaxAttempts: 5, BaseDelay: time.Millisecond, MaxDelay: time.Second}
+
+	attempts, _ := p.Do(context.Background(), func(ctx context.Context) error {
+		return WithRetryAfter(errFlaky, time.Minute)
+	})
+
+	if attempts != 1 {
+		t.Errorf("Expected 1 attempt, got: %d", attempts)
+	}
+}
+
+// TestDo_ContextCancelled tests that Do stops waiting when ctx is done
+func TestDo_ContextCancelled(t *testing.T) {
+	p := Policy{MaxAttempts: 5, BaseDelay: time.Hour}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	attempts, err := p.Do(ctx, func(ctx context.Context) error { return errFlaky })
+
+	if attempts != 1 || !errors.Is(err, errFlaky) {
+		t.Errorf("Expected 1 attempt with the last error, got attempts=%d err=%v", attempts, err)
+	}
+}
+
+// TestBackoff tests exponential growth, the MaxDelay cap and jitter bounds
+func TestBackoff(t *testing.T) {
+	p := Policy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	want := []time.Duration{100, 200, 400, 800, 1000, 1000}
+	for i, w := range want {
+		if got := p.Backoff(i + 1); got != w*time.Millisecond {
+			t.Errorf("Backoff(%d) = %s, want %s", i+1, got, w*time.Millisecond)
+		}
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		got := p.Backoff(2)
+		if got < 100*time.Millisecond || got > 200*time.Millisecond {
+			t.Fatalf("Backoff with jitter out of range: %s", got)
+		}
+	}
+}
+
+// TestParseRetryAfter tests both Retry-After header formats
+func TestParseRetryAfter(t *testing.T) {
+	if d, ok := ParseRetryAfter("30"); !ok || d != 30*time.Second {
+		t.Errorf("Expected 30s, got %s ok=%v", d, ok)
+	}
+
+	date := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	if d, ok := ParseRetryAfter(date); !ok || d <= 0 || d > time.Minute {
+		t.Errorf("Expected about 1m, got %s ok=%v", d, ok)
+	}
+
+	for _, v := range []string{"", "soon", "-5"} {
+		if _, ok := ParseRetryAfter(v); ok {
+			t.Errorf("Expected %q to be rejected", v)
+		}
+	}
+}
+
+// TestFromEnv tests per-prefix overrides
+func TestFromEnv(t *testing.T) {
+	t.Setenv("EMAIL_RETRY_MAX_ATTEMPTS", "7")
+	t.Setenv("EMAIL_RETRY_BASE_DELAY", "2s")
+	t.Setenv("EMAIL_RETRY_JITTER", "bogus")
+
+	p := FromEnv("EMAIL_", DefaultPolicy)
+
+	if p.MaxAttempts != 7 || p.BaseDelay != 2*time.Second {
+		t.Errorf("Expected overrides to apply, got: %+v", p)
+	}
+	if p.MaxDelay != DefaultPolicy.MaxDelay || p.Jitter != DefaultPolicy.Jitter {
+		t.Errorf("Expected unset and invalid values to keep defaults, got: %+v", p)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"boh/notification-service/delivery"
+	"boh/notification-service/notifier"
+	"boh/notification-service/webhook"
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+const readHeaderTimeout = 10 * time.Second
+
+// startWebhookServer serves provider callbacks on addr until Shutdown is
+// called on the returned server. onMessage, when set, receives inbound
+// messages. The ACS route is only served when its secret is set, since
+// anyone could otherwise forge status updates and replies.
+func startWebhookServer(addr string, store delivery.Store, onMessage webhook.MessageFunc) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", serviceHealthHandler)
+	// Consumer, breaker and token metrics are published with expvar.
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	if secret := os.Getenv("WEBHOOK_ACS_SECRET"); secret == "" {
+		log.Println("Error: WEBHOOK_ACS_SECRET not set. /webhooks/acs will not be served.")
+	} else {
+		acs := webhook.NewACSHandler(store, secret)
+		acs.OnMessage = onMessage
+		mux.Handle("/webhooks/acs", acs)
+	}
+
+	// /webhooks/meta is not served: this service sends WhatsApp through
+	// ACS, so no delivery or correlation record has a Meta message id.
+
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: readHeaderTimeout}
+	go func() {
+		log.Printf("Webhook server listening on %s", addr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Webhook server failed: %v", err)
+		}
+	}()
+	return srv
+}
+
+// serviceHealthHandler answers 503 while the last refresh of an ACS token
+// has failed, so the failure shows up before the cached token expires.
+func serviceHealthHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := notifier.ACSTokenHealth(); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]string{"status": "unhealthy", "error": err.Error()})
+		return
+	}
+	w.Write([]byte(`{"status":"okay"}`))
+}
+
+// shutdownWebhookServer stops accepting callbacks and waits for the ones in
+// progress.
+func shutdownWebhookServer(srv *http.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("Error shutting down webhook server: %v", err)
+	}
+}
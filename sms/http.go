@@ -0,0 +1,81 @@
+package sms
+
+import (
+	"boh/notification-service/channel"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// HTTPGateway sends SMS through a generic HTTP API that accepts
+//
+//	POST <URL>
+//	{"from": "...", "to": "+15551234567", "message": "..."}
+//
+// and answers 2xx with an optional {"messageId": "..."} or {"id": "..."}.
+type HTTPGateway struct {
+	URL    string
+	APIKey string
+	// AuthHeader carries APIKey; "Authorization" (the default) sends it as
+	// a bearer token, any other header sends it as is.
+	AuthHeader string
+	Client     *http.Client
+}
+
+func (g *HTTPGateway) Name() string { return "http" }
+
+func (g *HTTPGateway) Send(ctx context.Context, msg Message) (string, error) {
+	payload, err := json.Marshal(map[string]string{"from": msg.From, "to": msg.To, "message": msg.Body})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.URL, bytes.NewReader(payload))
+	if err != nil {
+		return "", fmt.Errorf("create SMS request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if g.APIKey != "" {
+		switch g.AuthHeader {
+		case "", "Authorization":
+			req.Header.Set("Authorization", "Bearer "+g.APIKey)
+		default:
+			req.Header.Set(g.AuthHeader, g.APIKey)
+		}
+	}
+
+	client := g.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("send SMS request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("read SMS response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		statusErr := &StatusError{Provider: g.Name(), StatusCode: resp.StatusCode, Body: string(body)}
+		if statusErr.Permanent() {
+			return "", channel.Permanent(statusErr)
+		}
+		return "", statusErr
+	}
+
+	var accepted struct {
+		MessageID string `json:"messageId"`
+		ID        string `json:"id"`
+	}
+	json.Unmarshal(body, &accepted)
+	if accepted.MessageID != "" {
+		return accepted.MessageID, nil
+	}
+	return accepted.ID, nil
+}
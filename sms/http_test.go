@@ -0,0 +1,72 @@
+package sms
+
+import (
+	"boh/notification-service/channel"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestHTTPGateway_Send tests that the message is posted with the API key and the returned id is reported
+func TestHTTPGateway_Send(t *testing.T) {
+	var got map[string]string
+	var apiKey string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiKey = r.Header.Get("X-API-Key")
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte(`{"messageId":"sms-1"}`))
+	}))
+	defer srv.Close()
+
+	g := &HTTPGateway{URL: srv.URL, APIKey: "key", AuthHeader: "X-API-Key"}
+	id, err := g.Send(context.Background(), Message{From: "BOH", To: "+15551234567", Body: "hello"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if id != "sms-1" {
+		t.Errorf("Expected message id sms-1, got %q", id)
+	}
+	if apiKey != "key" {
+		t.Errorf("Expected the API key in X-API-Key, got %q", apiKey)
+	}
+	if got["from"] != "BOH" || got["to"] != "+15551234567" || got["message"] != "hello" {
+		t.Errorf("Unexpected request body: %v", got)
+	}
+}
+
+// TestHTTPGateway_StatusError tests that non-2xx responses are returned as a StatusError
+func TestHTTPGateway_StatusError(t *testing.T) {
+	tests := []struct {
+		status               int
+		retryable, permanent bool
+	}{
+		{http.StatusBadRequest, false, true},
+		{http.StatusUnauthorized, false, true},
+		{http.StatusUnprocessableEntity, false, true},
+		{http.StatusRequestTimeout, true, false},
+		{http.StatusTooManyRequests, true, false},
+		{http.StatusBadGateway, true, false},
+	}
+
+	for _, tt := range tests {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tt.status)
+		}))
+		_, err := (&HTTPGateway{URL: srv.URL}).Send(context.Background(), Message{To: "+15551234567", Body: "hello"})
+		srv.Close()
+
+		var statusErr *StatusError
+		if !errors.As(err, &statusErr) || statusErr.StatusCode != tt.status {
+			t.Fatalf("Status %d: expected *StatusError, got %v", tt.status, err)
+		}
+		if statusErr.Retryable() != tt.retryable {
+			t.Errorf("Status %d: expected retryable=%v", tt.status, tt.retryable)
+		}
+		if channel.IsPermanent(err) != tt.permanent {
+			t.Errorf("Status %d: expected permanent=%v, got %v", tt.status, tt.permanent, err)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package sms
+
+import (
+	"strings"
+	"unicode/utf16"
+)
+
+// Encodings an SMS body is sent in.
+const (
+	GSM7 = "GSM-7"
+	UCS2 = "UCS-2"
+)
+
+// Segment sizes: a single message, and each part of a concatenated one,
+// whose user data header takes 7 septets (GSM-7) or 3 UTF-16 units (UCS-2).
+const (
+	gsm7Single    = 160
+	gsm7Multipart = 153
+	ucs2Single    = 70
+	ucs2Multipart = 67
+)
+
+// gsm7Basic is the GSM 03.38 default alphabet; each character takes one
+// septet. gsm7Extension characters are escaped and take two.
+const (
+	gsm7Basic = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?" +
+		"¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+	gsm7Extension = "\f^{}\\[~]|€"
+)
+
+// Segments returns the encoding body will be sent in and the number of
+// segments it is billed as. Bodies with any character outside GSM-7 are
+// sent as UCS-2. An empty body is one segment.
+func Segments(body string) (encoding string, count int) {
+	if units, ok := gsm7Units(body); ok {
+		return GSM7, countSegments(units, gsm7Single, gsm7Multipart)
+	}
+	return UCS2, countSegments(ucs2Units(body), ucs2Single, ucs2Multipart)
+}
+
+// gsm7Units returns the septets taken by each character of body, or false
+// if body cannot be encoded in GSM-7.
+func gsm7Units(body string) ([]int, bool) {
+	units := make([]int, 0, len(body))
+	for _, r := range body {
+		switch {
+		case strings.ContainsRune(gsm7Basic, r):
+			units = append(units, 1)
+		case strings.ContainsRune(gsm7Extension, r):
+			units = append(units, 2)
+		default:
+			return nil, false
+		}
+	}
+	return units, true
+}
+
+// ucs2Units returns the UTF-16 code units taken by each character, so
+// characters outside the BMP count as a surrogate pair.
+func ucs2Units(body string) []int {
+	units := make([]int, 0, len(body))
+	for _, r := range body {
+		if utf16.RuneLen(r) == 2 {
+			units = append(units, 2)
+		} else {
+			units = append(units, 1)
+		}
+	}
+	return units
+}
+
+// countSegments packs characters into segments without splitting an escaped
+// character or surrogate pair across two of them.
+func countSegments(units []int, single, multipart int) int {
+	total := 0
+	for _, u := range units {
+		total += u
+	}
+	if total <= single {
+		return 1
+	}
+
+	count, used := 1, 0
+	for _, u := range units {
+		if used+u > multipart {
+			count++
+			used = 0
+		}
+		used += u
+	}
+	return count
+}
@@ -0,0 +1,40 @@
+package sms
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestSegments tests the encoding and segment count at the single and multipart boundaries
+func TestSegments(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		encoding string
+		count    int
+	}{
+		{"Empty", "", GSM7, 1},
+		{"Short GSM-7", "Your code is 1234", GSM7, 1},
+		{"GSM-7 single limit", strings.Repeat("a", 160), GSM7, 1},
+		{"GSM-7 over single limit", strings.Repeat("a", 161), GSM7, 2},
+		{"GSM-7 two parts", strings.Repeat("a", 306), GSM7, 2},
+		{"GSM-7 three parts", strings.Repeat("a", 307), GSM7, 3},
+		{"Extension characters take two septets", strings.Repeat("€", 80), GSM7, 1},
+		{"Extension character not split across parts", strings.Repeat("a", 152) + "€" + strings.Repeat("a", 10), GSM7, 2},
+		{"UCS-2 single limit", strings.Repeat("ä", 69) + "ł", UCS2, 1},
+		{"UCS-2 over single limit", strings.Repeat("ł", 71), UCS2, 2},
+		{"UCS-2 two parts", strings.Repeat("ł", 134), UCS2, 2},
+		{"UCS-2 three parts", strings.Repeat("ł", 135), UCS2, 3},
+		{"Emoji takes two units", strings.Repeat("😀", 35), UCS2, 1},
+		{"Emoji over single limit", strings.Repeat("😀", 36), UCS2, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoding, count := Segments(tt.body)
+			if encoding != tt.encoding || count != tt.count {
+				t.Errorf("Expected %s with %d segment(s), got %s with %d", tt.encoding, tt.count, encoding, count)
+			}
+		})
+	}
+}
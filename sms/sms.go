@@ -0,0 +1,48 @@
+// Package sms holds what every SMS provider shares: the Provider
+// interface, segment counting and a generic HTTP gateway provider.
+package sms
+
+import (
+	"context"
+	"fmt"
+)
+
+// Message is one SMS to send.
+type Message struct {
+	// Brand selects brand-specific provider settings; empty uses the defaults.
+	Brand string
+	From  string
+	To    string
+	Body  string
+}
+
+// Provider sends SMS messages. Implementations return the provider's
+// message id, or "" when it does not report one.
+type Provider interface {
+	Name() string
+	Send(ctx context.Context, msg Message) (string, error)
+}
+
+// StatusError is a non-2xx response from an HTTP SMS provider.
+type StatusError struct {
+	Provider   string
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s SMS request failed with status %d: %s", e.Provider, e.StatusCode, e.Body)
+}
+
+// Retryable reports whether the request may succeed later: throttling,
+// timeouts and server errors.
+func (e *StatusError) Retryable() bool {
+	return e.StatusCode == 408 || e.StatusCode == 429 || e.StatusCode >= 500
+}
+
+// Permanent reports whether the request can never succeed as sent: a 4xx
+// other than a timeout or throttling, e.g. a bad number or a rejected API
+// key.
+func (e *StatusError) Permanent() bool {
+	return e.StatusCode >= 400 && e.StatusCode < 500 && !e.Retryable()
+}
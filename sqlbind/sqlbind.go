@@ -0,0 +1,27 @@
+// Package sqlbind adapts queries written with ? placeholders to drivers
+// that expect numbered ones.
+package sqlbind
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Bind rewrites the ? placeholders in query as $1, $2, ... when numbered is
+// set, as PostgreSQL drivers expect, and returns query unchanged otherwise.
+func Bind(query string, numbered bool) string {
+	if !numbered {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			fmt.Fprintf(&b, "$%d", n)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,14 @@
+package sqlbind
+
+import "testing"
+
+// TestBind tests that placeholders are numbered in order only when asked to
+func TestBind(t *testing.T) {
+	query := "UPDATE t SET a = ? WHERE b = ? AND c = ?"
+	if got := Bind(query, true); got != "UPDATE t SET a = $1 WHERE b = $2 AND c = $3" {
+		t.Errorf("Unexpected query: %s", got)
+	}
+	if got := Bind(query, false); got != query {
+		t.Errorf("Expected query unchanged, got: %s", got)
+	}
+}
@@ -0,0 +1,224 @@
+package webhook
+
+import (
+	"boh/notification-service/delivery"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Event Grid event types handled by ACSHandler.
+const (
+	EventDeliveryStatusUpdated  = "Microsoft.Communication.AdvancedMessageDeliveryStatusUpdated"
+	EventMessageReceived        = "Microsoft.Communication.AdvancedMessageReceived"
+	eventSubscriptionValidation = "Microsoft.EventGrid.SubscriptionValidationEvent"
+)
+
+// eventGridEvent is one event in the Event Grid schema.
+type eventGridEvent struct {
+	ID        string          `json:"id"`
+	EventType string          `json:"eventType"`
+	EventTime time.Time       `json:"eventTime"`
+	Data      json.RawMessage `json:"data"`
+}
+
+type acsStatusData struct {
+	MessageID         string    `json:"messageId"`
+	Status            string    `json:"status"`
+	ChannelType       string    `json:"channelType"`
+	To                string    `json:"to"`
+	ReceivedTimestamp time.Time `json:"receivedTimestamp"`
+	Error             *struct {
+		Code    any    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type acsReceivedData struct {
+	MessageID         string    `json:"messageId"`
+	Content           string    `json:"content"`
+	ChannelType       string    `json:"channelType"`
+	From              string    `json:"from"`
+	To                string    `json:"to"`
+	ReceivedTimestamp time.Time `json:"receivedTimestamp"`
+	Context           *struct {
+		From string `json:"from"`
+		ID   string `json:"id"`
+	} `json:"context"`
+	Button *struct {
+		Text    string `json:"text"`
+		Payload string `json:"payload"`
+	} `json:"button"`
+	// InteractiveContent carries the answer to an interactive message.
+	InteractiveContent *struct {
+		Type        string `json:"type"`
+		ButtonReply *struct {
+			ID    string `json:"id"`
+			Title string `json:"title"`
+		} `json:"buttonReply"`
+	} `json:"interactiveContent"`
+}
+
+// ACSHandler receives Event Grid (not CloudEvents) deliveries for ACS
+// Advanced Messaging: status updates for messages we sent and messages
+// users sent us.
+type ACSHandler struct {
+	store  delivery.Store
+	secret string
+
+	// OnMessage, when set, is called for every inbound message.
+	OnMessage MessageFunc
+}
+
+// NewACSHandler updates records in store from delivery status events. When
+// secret is set every request must carry it in the code query parameter,
+// which is added to the Event Grid subscription's endpoint URL.
+func NewACSHandler(store delivery.Store, secret string) *ACSHandler {
+	return &ACSHandler{store: store, secret: secret}
+}
+
+func (h *ACSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.secret != "" && !equalSecret(r.URL.Query().Get("code"), h.secret) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if r.Method == http.MethodOptions {
+		// Abuse protection handshake for CloudEvents subscriptions.
+		w.Header().Set("WebHook-Allowed-Origin", r.Header.Get("WebHook-Request-Origin"))
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	if err != nil {
+		http.Error(w, "bad request: unreadable body", http.StatusBadRequest)
+		return
+	}
+
+	var events []eventGridEvent
+	if err := json.Unmarshal(body, &events); err != nil {
+		http.Error(w, "bad request: expected an array of Event Grid events", http.StatusBadRequest)
+		return
+	}
+
+	for _, event := range events {
+		if event.EventType == eventSubscriptionValidation {
+			var data struct {
+				ValidationCode string `json:"validationCode"`
+			}
+			if err := json.Unmarshal(event.Data, &data); err != nil || data.ValidationCode == "" {
+				http.Error(w, "bad request: invalid validation event", http.StatusBadRequest)
+				return
+			}
+			log.Printf("Validating Event Grid subscription (event %s)", event.ID)
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"validationResponse": data.ValidationCode})
+			return
+		}
+
+		if err := h.handle(r.Context(), event); err != nil {
+			log.Printf("Error handling ACS event %s (%s): %v", event.ID, event.EventType, err)
+			// Event Grid retries anything but a 2xx or 400/413.
+			http.Error(w, "failed to handle event", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *ACSHandler) handle(ctx context.Context, event eventGridEvent) error {
+	switch event.EventType {
+	case EventDeliveryStatusUpdated:
+		var data acsStatusData
+		if err := json.Unmarshal(event.Data, &data); err != nil {
+			return fmt.Errorf("decode status update: %w", err)
+		}
+		return h.updateStatus(ctx, event, data)
+
+	case EventMessageReceived:
+		var data acsReceivedData
+		if err := json.Unmarshal(event.Data, &data); err != nil {
+			return fmt.Errorf("decode received message: %w", err)
+		}
+		return h.receive(ctx, event, data)
+
+	default:
+		log.Printf("Ignoring ACS event %s of type %s", event.ID, event.EventType)
+		return nil
+	}
+}
+
+func (h *ACSHandler) updateStatus(ctx context.Context, event eventGridEvent, data acsStatusData) error {
+	status := strings.ToLower(data.Status)
+	switch status {
+	case delivery.StatusSent, delivery.StatusDelivered, delivery.StatusRead, delivery.StatusFailed:
+	default:
+		log.Printf("Ignoring unknown ACS status %q for message %s", data.Status, data.MessageID)
+		return nil
+	}
+	if data.Error != nil {
+		log.Printf("ACS message %s to %s failed: %v %s", data.MessageID, data.To, data.Error.Code, data.Error.Message)
+	}
+
+	rec, updated, err := delivery.UpdateStatus(ctx, h.store, data.MessageID, status, eventTime(data.ReceivedTimestamp, event.EventTime))
+	if err != nil {
+		return err
+	}
+	if updated {
+		log.Printf("Delivery %s is now %s", rec.Key, rec.Status)
+	}
+	return nil
+}
+
+func (h *ACSHandler) receive(ctx context.Context, event eventGridEvent, data acsReceivedData) error {
+	m := InboundMessage{
+		Channel:    strings.ToLower(data.ChannelType),
+		MessageID:  data.MessageID,
+		From:       data.From,
+		To:         data.To,
+		Content:    data.Content,
+		ReceivedAt: eventTime(data.ReceivedTimestamp, event.EventTime),
+	}
+	if data.Context != nil {
+		m.ReplyTo = data.Context.ID
+	}
+	if data.Button != nil {
+		m.ButtonPayload = data.Button.Payload
+		if m.Content == "" {
+			m.Content = data.Button.Text
+		}
+	}
+	if data.InteractiveContent != nil && data.InteractiveContent.ButtonReply != nil {
+		m.ButtonPayload = data.InteractiveContent.ButtonReply.ID
+		if m.Content == "" {
+			m.Content = data.InteractiveContent.ButtonReply.Title
+		}
+	}
+
+	log.Printf("Received %s message from %s", m.Channel, m.From)
+	if h.OnMessage == nil {
+		return nil
+	}
+	return h.OnMessage(ctx, m)
+}
+
+// eventTime returns the first time that is set, or now.
+func eventTime(times ...time.Time) time.Time {
+	for _, t := range times {
+		if !t.IsZero() {
+			return t
+		}
+	}
+	return time.Now()
+}
@@ -0,0 +1,148 @@
+package webhook
+
+import (
+	"boh/notification-service/delivery"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func postACS(h http.Handler, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+// TestACSHandler_SubscriptionValidation tests the Event Grid validation handshake
+func TestACSHandler_SubscriptionValidation(t *testing.T) {
+	h := NewACSHandler(delivery.NewMemoryStore(delivery.DefaultTTL), "s3cret")
+
+	body := `[{"id":"1","eventType":"Microsoft.EventGrid.SubscriptionValidationEvent","data":{"validationCode":"abc-123"}}]`
+	w := postACS(h, "/webhooks/acs?code=s3cret", body)
+
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"validationResponse":"abc-123"`) {
+		t.Errorf("Unexpected response %d: %s", w.Code, w.Body.String())
+	}
+}
+
+// TestACSHandler_RejectsWrongSecret tests that requests without the shared secret are refused
+func TestACSHandler_RejectsWrongSecret(t *testing.T) {
+	h := NewACSHandler(delivery.NewMemoryStore(delivery.DefaultTTL), "s3cret")
+
+	for _, target := range []string{"/webhooks/acs", "/webhooks/acs?code=wrong"} {
+		if w := postACS(h, target, `[]`); w.Code != http.StatusUnauthorized {
+			t.Errorf("%s: expected 401, got %d", target, w.Code)
+		}
+	}
+}
+
+// TestACSHandler_DeliveryStatus tests that status updates move the matching delivery record on
+func TestACSHandler_DeliveryStatus(t *testing.T) {
+	ctx := context.Background()
+	store := delivery.NewMemoryStore(delivery.DefaultTTL)
+	key := delivery.NewKey("n1", "whatsapp", "+15551234567")
+	store.Put(ctx, delivery.Record{Key: key, Status: delivery.StatusSent, MessageID: "msg-1"})
+	h := NewACSHandler(store, "")
+
+	body := `[
+		{"id":"1","eventType":"Microsoft.Communication.AdvancedMessageDeliveryStatusUpdated","eventTime":"2025-01-01T10:00:02Z",
+		 "data":{"messageId":"msg-1","status":"Read","channelType":"whatsapp","to":"+15551234567","receivedTimestamp":"2025-01-01T10:00:01Z"}},
+		{"id":"2","eventType":"Microsoft.Communication.AdvancedMessageDeliveryStatusUpdated",
+		 "data":{"messageId":"msg-1","status":"Delivered","channelType":"whatsapp"}},
+		{"id":"3","eventType":"Microsoft.Communication.AdvancedMessageDeliveryStatusUpdated",
+		 "data":{"messageId":"other","status":"Delivered","channelType":"whatsapp"}}
+	]`
+	if w := postACS(h, "/webhooks/acs", body); w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	rec, _, _ := store.Get(ctx, key)
+	if rec.Status != delivery.StatusRead || rec.UpdatedAt.Format("15:04:05") != "10:00:01" {
+		t.Errorf("Expected read at 10:00:01, got %+v", rec)
+	}
+}
+
+// TestACSHandler_MessageReceived tests that inbound messages are passed to OnMessage
+func TestACSHandler_MessageReceived(t *testing.T) {
+	h := NewACSHandler(delivery.NewMemoryStore(delivery.DefaultTTL), "")
+	var got []InboundMessage
+	h.OnMessage = func(ctx context.Context, m InboundMessage) error {
+		got = append(got, m)
+		return nil
+	}
+
+	body := `[{"id":"1","eventType":"Microsoft.Communication.AdvancedMessageReceived",
+		"data":{"channelType":"whatsapp","from":"+15551234567","to":"registration-1",
+		        "context":{"id":"msg-1"},"button":{"text":"Not me","payload":"not-me"}}}]`
+	if w := postACS(h, "/webhooks/acs", body); w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+
+	if len(got) != 1 {
+		t.Fatalf("Expected 1 message, got %d", len(got))
+	}
+	m := got[0]
+	if m.Channel != "whatsapp" || m.From != "+15551234567" || m.ReplyTo != "msg-1" || m.ButtonPayload != "not-me" || m.Content != "Not me" {
+		t.Errorf("Unexpected message: %+v", m)
+	}
+}
+
+// TestACSHandler_InteractiveReply tests a button reply as Event Grid delivers it for ACS Advanced Messaging
+func TestACSHandler_InteractiveReply(t *testing.T) {
+	h := NewACSHandler(delivery.NewMemoryStore(delivery.DefaultTTL), "")
+	var got []InboundMessage
+	h.OnMessage = func(ctx context.Context, m InboundMessage) error {
+		got = append(got, m)
+		return nil
+	}
+
+	body := `[{
+		"id": "3e6b2a2c-8a1f-4a9e-9d1b-4b7f8c2d1e0a",
+		"topic": "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/notifications/providers/microsoft.communication/communicationservices/boh-acs",
+		"subject": "advancedMessage/sender/15551234567/recipient/11111111-2222-3333-4444-555555555555",
+		"data": {
+			"channelType": "whatsapp",
+			"from": "15551234567",
+			"to": "11111111-2222-3333-4444-555555555555",
+			"receivedTimestamp": "2024-06-24T19:10:12.4237201+00:00",
+			"messageId": "reply-1",
+			"context": {
+				"from": "15550001111",
+				"id": "a1b2c3d4-0000-1111-2222-333344445555"
+			},
+			"interactiveContent": {
+				"type": "buttonReply",
+				"buttonReply": {
+					"id": "block",
+					"title": "No, block my card"
+				}
+			}
+		},
+		"eventType": "Microsoft.Communication.AdvancedMessageReceived",
+		"dataVersion": "1.0",
+		"metadataVersion": "1",
+		"eventTime": "2024-06-24T19:10:12.4237201Z"
+	}]`
+	if w := postACS(h, "/webhooks/acs", body); w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+
+	if len(got) != 1 {
+		t.Fatalf("Expected 1 message, got %d", len(got))
+	}
+	m := got[0]
+	if m.ReplyTo != "a1b2c3d4-0000-1111-2222-333344445555" || m.ButtonPayload != "block" || m.Content != "No, block my card" || m.MessageID != "reply-1" {
+		t.Errorf("Unexpected message: %+v", m)
+	}
+}
+
+// TestACSHandler_BadBody tests that malformed bodies are rejected so Event Grid does not retry them
+func TestACSHandler_BadBody(t *testing.T) {
+	h := NewACSHandler(delivery.NewMemoryStore(delivery.DefaultTTL), "")
+	if w := postACS(h, "/webhooks/acs", `{"not":"an array"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400, got %d", w.Code)
+	}
+}
@@ -0,0 +1,247 @@
+package webhook
+
+import (
+	"boh/notification-service/delivery"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// metaNotification is the body of a WhatsApp Cloud API webhook call.
+type metaNotification struct {
+	Object string `json:"object"`
+	Entry  []struct {
+		ID      string `json:"id"`
+		Changes []struct {
+			Field string     `json:"field"`
+			Value metaChange `json:"value"`
+		} `json:"changes"`
+	} `json:"entry"`
+}
+
+type metaChange struct {
+	Metadata struct {
+		DisplayPhoneNumber string `json:"display_phone_number"`
+		PhoneNumberID      string `json:"phone_number_id"`
+	} `json:"metadata"`
+	Statuses []metaStatus         `json:"statuses"`
+	Messages []metaInboundMessage `json:"messages"`
+}
+
+type metaStatus struct {
+	ID          string `json:"id"`
+	Status      string `json:"status"`
+	Timestamp   string `json:"timestamp"`
+	RecipientID string `json:"recipient_id"`
+	Errors      []struct {
+		Code  int    `json:"code"`
+		Title string `json:"title"`
+	} `json:"errors"`
+}
+
+type metaInboundMessage struct {
+	ID        string `json:"id"`
+	From      string `json:"from"`
+	Timestamp string `json:"timestamp"`
+	Type      string `json:"type"`
+	Text      *struct {
+		Body string `json:"body"`
+	} `json:"text"`
+	Context *struct {
+		ID string `json:"id"`
+	} `json:"context"`
+	Button *struct {
+		Text    string `json:"text"`
+		Payload string `json:"payload"`
+	} `json:"button"`
+	Interactive *struct {
+		Type        string `json:"type"`
+		ButtonReply *struct {
+			ID    string `json:"id"`
+			Title string `json:"title"`
+		} `json:"button_reply"`
+	} `json:"interactive"`
+}
+
+// MetaHandler receives WhatsApp Cloud API webhooks: status updates for
+// messages we sent and messages users sent us.
+type MetaHandler struct {
+	store       delivery.Store
+	verifyToken string
+	appSecret   string
+
+	// OnMessage, when set, is called for every inbound message.
+	OnMessage MessageFunc
+}
+
+// NewMetaHandler updates records in store from status callbacks.
+// verifyToken answers the subscription handshake and appSecret checks the
+// X-Hub-Signature-256 header; when appSecret is empty signatures are not
+// checked.
+func NewMetaHandler(store delivery.Store, verifyToken, appSecret string) *MetaHandler {
+	return &MetaHandler{store: store, verifyToken: verifyToken, appSecret: appSecret}
+}
+
+func (h *MetaHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.verify(w, r)
+	case http.MethodPost:
+		h.notify(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// verify answers the hub.challenge handshake Meta sends when the callback
+// URL is configured.
+func (h *MetaHandler) verify(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("hub.mode") != "subscribe" || h.verifyToken == "" || !equalSecret(q.Get("hub.verify_token"), h.verifyToken) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	io.WriteString(w, q.Get("hub.challenge"))
+}
+
+func (h *MetaHandler) notify(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	if err != nil {
+		http.Error(w, "bad request: unreadable body", http.StatusBadRequest)
+		return
+	}
+	if h.appSecret != "" && !validSignature(body, r.Header.Get("X-Hub-Signature-256"), h.appSecret) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var n metaNotification
+	if err := json.Unmarshal(body, &n); err != nil {
+		http.Error(w, "bad request: invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	// Statuses of the whole callback are applied before any message is
+	// passed on, so a store failure can still be retried without passing
+	// the same messages on twice.
+	for _, entry := range n.Entry {
+		for _, change := range entry.Changes {
+			if change.Field != "messages" {
+				continue
+			}
+			if err := h.updateStatuses(r.Context(), change.Value); err != nil {
+				log.Printf("Error handling Meta webhook for account %s: %v", entry.ID, err)
+				// Meta retries callbacks that do not get a 200.
+				http.Error(w, "failed to handle notification", http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+	for _, entry := range n.Entry {
+		for _, change := range entry.Changes {
+			if change.Field == "messages" {
+				h.passMessages(r.Context(), change.Value)
+			}
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// updateStatuses applies the delivery statuses of change. Applying one
+// again does nothing, so the callback may be retried when it fails.
+func (h *MetaHandler) updateStatuses(ctx context.Context, change metaChange) error {
+	for _, s := range change.Statuses {
+		status := strings.ToLower(s.Status)
+		switch status {
+		case delivery.StatusSent, delivery.StatusDelivered, delivery.StatusRead, delivery.StatusFailed:
+		default:
+			log.Printf("Ignoring unknown Meta status %q for message %s", s.Status, s.ID)
+			continue
+		}
+		for _, e := range s.Errors {
+			log.Printf("Meta message %s to %s failed: %d %s", s.ID, s.RecipientID, e.Code, e.Title)
+		}
+
+		rec, updated, err := delivery.UpdateStatus(ctx, h.store, s.ID, status, unixTime(s.Timestamp))
+		if err != nil {
+			return fmt.Errorf("update message %s: %w", s.ID, err)
+		}
+		if updated {
+			log.Printf("Delivery %s is now %s", rec.Key, rec.Status)
+		}
+	}
+	return nil
+}
+
+// passMessages hands the inbound messages of change to OnMessage. A failure
+// is only logged: answering 500 would make Meta send the whole callback
+// again, and the messages before it would be passed on twice.
+func (h *MetaHandler) passMessages(ctx context.Context, change metaChange) {
+	for _, msg := range change.Messages {
+		m := InboundMessage{
+			Channel:    "whatsapp",
+			MessageID:  msg.ID,
+			From:       msg.From,
+			To:         change.Metadata.DisplayPhoneNumber,
+			ReceivedAt: unixTime(msg.Timestamp),
+		}
+		if msg.Text != nil {
+			m.Content = msg.Text.Body
+		}
+		if msg.Context != nil {
+			m.ReplyTo = msg.Context.ID
+		}
+		if msg.Button != nil {
+			m.ButtonPayload = msg.Button.Payload
+			m.Content = msg.Button.Text
+		}
+		if msg.Interactive != nil && msg.Interactive.ButtonReply != nil {
+			m.ButtonPayload = msg.Interactive.ButtonReply.ID
+			m.Content = msg.Interactive.ButtonReply.Title
+		}
+
+		log.Printf("Received %s message from %s", msg.Type, m.From)
+		if h.OnMessage == nil {
+			continue
+		}
+		if err := h.OnMessage(ctx, m); err != nil {
+			log.Printf("Error handling Meta message %s from %s: %v", msg.ID, m.From, err)
+		}
+	}
+}
+
+// validSignature checks header, "sha256=<hex>", against the HMAC-SHA256 of
+// body keyed with secret.
+func validSignature(body []byte, header, secret string) bool {
+	sig, ok := strings.CutPrefix(header, "sha256=")
+	if !ok {
+		return false
+	}
+	got, err := hex.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// unixTime parses Meta's string Unix timestamps, falling back to now.
+func unixTime(s string) time.Time {
+	sec, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Now()
+	}
+	return time.Unix(sec, 0)
+}
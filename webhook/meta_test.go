@@ -0,0 +1,141 @@
+package webhook
+
+import (
+	"boh/notification-service/delivery"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func postMeta(h http.Handler, body, secret string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/meta", strings.NewReader(body))
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+// TestMetaHandler_Verify tests the hub.challenge handshake
+func TestMetaHandler_Verify(t *testing.T) {
+	h := NewMetaHandler(delivery.NewMemoryStore(delivery.DefaultTTL), "verify-me", "app-secret")
+
+	tests := []struct {
+		query string
+		code  int
+		body  string
+	}{
+		{"?hub.mode=subscribe&hub.verify_token=verify-me&hub.challenge=1158201444", http.StatusOK, "1158201444"},
+		{"?hub.mode=subscribe&hub.verify_token=wrong&hub.challenge=1158201444", http.StatusForbidden, ""},
+		{"?hub.mode=unsubscribe&hub.verify_token=verify-me&hub.challenge=1158201444", http.StatusForbidden, ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/webhooks/meta"+tt.query, nil))
+		if w.Code != tt.code || (tt.body != "" && w.Body.String() != tt.body) {
+			t.Errorf("%s: got %d %q", tt.query, w.Code, w.Body.String())
+		}
+	}
+}
+
+// TestMetaHandler_Signature tests that unsigned or wrongly signed callbacks are refused
+func TestMetaHandler_Signature(t *testing.T) {
+	h := NewMetaHandler(delivery.NewMemoryStore(delivery.DefaultTTL), "verify-me", "app-secret")
+
+	if w := postMeta(h, `{"object":"whatsapp_business_account"}`, "other-secret"); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for a wrong signature, got %d", w.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/meta", strings.NewReader(`{}`))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without a signature, got %d", w.Code)
+	}
+}
+
+// TestMetaHandler_StatusesAndMessages tests that statuses update delivery records and messages reach OnMessage
+func TestMetaHandler_StatusesAndMessages(t *testing.T) {
+	ctx := context.Background()
+	store := delivery.NewMemoryStore(delivery.DefaultTTL)
+	key := delivery.NewKey("n1", "whatsapp", "+15551234567")
+	store.Put(ctx, delivery.Record{Key: key, Status: delivery.StatusSent, MessageID: "wamid.1"})
+
+	h := NewMetaHandler(store, "verify-me", "app-secret")
+	var got []InboundMessage
+	h.OnMessage = func(ctx context.Context, m InboundMessage) error {
+		got = append(got, m)
+		return nil
+	}
+
+	body := `{"object":"whatsapp_business_account","entry":[{"id":"waba-1","changes":[{"field":"messages","value":{
+		"messaging_product":"whatsapp",
+		"metadata":{"display_phone_number":"15550000000","phone_number_id":"123"},
+		"statuses":[{"id":"wamid.1","status":"delivered","timestamp":"1700000000","recipient_id":"15551234567"}],
+		"messages":[{"id":"wamid.in","from":"15551234567","timestamp":"1700000100","type":"button",
+		             "context":{"id":"wamid.1"},"button":{"text":"Yes","payload":"confirm"}}]
+	}}]}]}`
+	if w := postMeta(h, body, "app-secret"); w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	rec, _, _ := store.Get(ctx, key)
+	if rec.Status != delivery.StatusDelivered || rec.UpdatedAt.Unix() != 1700000000 {
+		t.Errorf("Expected delivered at 1700000000, got %+v", rec)
+	}
+	if len(got) != 1 || got[0].ReplyTo != "wamid.1" || got[0].ButtonPayload != "confirm" || got[0].From != "15551234567" {
+		t.Errorf("Unexpected inbound messages: %+v", got)
+	}
+}
+
+// TestMetaHandler_InteractiveReply tests that the id of the pressed reply button is passed on
+func TestMetaHandler_InteractiveReply(t *testing.T) {
+	h := NewMetaHandler(delivery.NewMemoryStore(delivery.DefaultTTL), "", "")
+	var got []InboundMessage
+	h.OnMessage = func(ctx context.Context, m InboundMessage) error {
+		got = append(got, m)
+		return nil
+	}
+
+	body := `{"object":"whatsapp_business_account","entry":[{"id":"waba-1","changes":[{"field":"messages","value":{
+		"messages":[{"id":"wamid.in","from":"15551234567","timestamp":"1700000100","type":"interactive",
+		             "context":{"id":"wamid.1"},"interactive":{"type":"button_reply","button_reply":{"id":"block","title":"No, block my card"}}}]
+	}}]}]}`
+	if w := postMeta(h, body, ""); w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+	if len(got) != 1 || got[0].ButtonPayload != "block" || got[0].ReplyTo != "wamid.1" {
+		t.Errorf("Unexpected inbound messages: %+v", got)
+	}
+}
+
+// TestMetaHandler_MessageFailure tests that a failing message is logged, not retried, and does not stop the others
+func TestMetaHandler_MessageFailure(t *testing.T) {
+	h := NewMetaHandler(delivery.NewMemoryStore(delivery.DefaultTTL), "", "")
+	var got []string
+	h.OnMessage = func(ctx context.Context, m InboundMessage) error {
+		got = append(got, m.MessageID)
+		if m.MessageID == "wamid.in1" {
+			return errors.New("queue unavailable")
+		}
+		return nil
+	}
+
+	body := `{"object":"whatsapp_business_account","entry":[{"id":"waba-1","changes":[{"field":"messages","value":{
+		"messages":[{"id":"wamid.in1","from":"15551234567","timestamp":"1700000100","type":"text","text":{"body":"yes"}},
+		            {"id":"wamid.in2","from":"15551234567","timestamp":"1700000101","type":"text","text":{"body":"no"}}]
+	}}]}]}`
+	if w := postMeta(h, body, ""); w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+	if len(got) != 2 || got[1] != "wamid.in2" {
+		t.Errorf("Expected both messages to be passed on, got %v", got)
+	}
+}
@@ -0,0 +1,35 @@
+// Package webhook receives provider callbacks: delivery status updates,
+// which move delivery records on from "sent", and inbound replies.
+package webhook
+
+import (
+	"context"
+	"crypto/subtle"
+	"time"
+)
+
+// maxBodyBytes caps the size of a callback body.
+const maxBodyBytes = 1 << 20
+
+// InboundMessage is a message a user sent to one of our channels.
+type InboundMessage struct {
+	Channel   string
+	MessageID string
+	From      string
+	To        string
+	Content   string
+	// ReplyTo is the provider id of the message being replied to, if any.
+	ReplyTo string
+	// ButtonPayload is the payload of the quick-reply button pressed, if any.
+	ButtonPayload string
+	ReceivedAt    time.Time
+}
+
+// MessageFunc handles an inbound message. Returning an error makes the
+// provider deliver the callback again.
+type MessageFunc func(ctx context.Context, m InboundMessage) error
+
+// equalSecret compares secrets in constant time.
+func equalSecret(got, want string) bool {
+	return subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}